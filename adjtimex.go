@@ -0,0 +1,169 @@
+package tsc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// KernelClock is the discipline state of the kernel clock (e.g., by NTP/chrony), read by adjtimex(2).
+type KernelClock struct {
+	Synchronized bool          // STA_UNSYNC isn't set and the state isn't TIME_ERROR.
+	Freq         float64       // Frequency adjustment in ppm.
+	EstError     time.Duration // Estimated error.
+	MaxError     time.Duration // Max error.
+	TAIOffset    time.Duration // TAI - UTC, 0 means unknown (it's set by NTP/chrony).
+}
+
+// kernelClockReader reads the kernel clock state, it's replaced by a fake one in testing.
+var kernelClockReader = readKernelClock
+
+// ReadKernelClock reads the kernel clock state (read-only, nothing will be adjusted).
+//
+// Only Linux is supported.
+func ReadKernelClock() (KernelClock, error) {
+	return kernelClockReader()
+}
+
+// KernelWatchConfig is the config of RunKernelWatch.
+type KernelWatchConfig struct {
+	// Interval is the polling interval of kernel clock state.
+	Interval time.Duration
+	// FreqThreshold is the max change (ppm) of the kernel frequency adjustment without recalibrating.
+	FreqThreshold float64
+}
+
+// DefaultKernelWatchConfig polls faster than NTP/chrony (64s at least by default).
+var DefaultKernelWatchConfig = KernelWatchConfig{
+	Interval:      16 * time.Second,
+	FreqThreshold: 0.01,
+}
+
+// Validate checks c is valid or not.
+func (c KernelWatchConfig) Validate() error {
+
+	if c.Interval <= 0 {
+		return fmt.Errorf("%w: interval must be > 0: %s", ErrInvalidConfig, c.Interval)
+	}
+	if !(c.FreqThreshold >= 0) || math.IsInf(c.FreqThreshold, 0) {
+		return fmt.Errorf("%w: frequency threshold must be >= 0: %v", ErrInvalidConfig, c.FreqThreshold)
+	}
+	return nil
+}
+
+// kernelClockState is the kernel clock state applied to calibration blocks.
+type kernelClockState struct {
+	unsync bool
+	maxErr int64
+}
+
+// kernelState is guarded by calibrationMu.
+var kernelState kernelClockState
+
+// recalibrate is invoked when the kernel clock is disciplined, it's replaced in testing.
+var recalibrate = Calibrate
+
+// kernelWatcher checks kernel clock state.
+type kernelWatcher struct {
+	cfg     KernelWatchConfig
+	started bool
+	freq    float64
+	synced  bool
+}
+
+// check reads the kernel clock state, applies it to calibration blocks,
+// and returns whether it needs recalibrating:
+// the frequency adjustment has been changed, or the kernel clock becomes synchronized.
+func (w *kernelWatcher) check() (bool, error) {
+
+	kc, err := ReadKernelClock()
+	if err != nil {
+		return false, err
+	}
+	setKernelState(!kc.Synchronized, int64(kc.MaxError))
+
+	need := w.started &&
+		(math.Abs(kc.Freq-w.freq) > w.cfg.FreqThreshold || (kc.Synchronized && !w.synced))
+	w.started, w.freq, w.synced = true, kc.Freq, kc.Synchronized
+	return need, nil
+}
+
+// RunKernelWatch polls the kernel clock state (see ReadKernelClock) until ctx is done:
+//  1. Calibrate when the kernel frequency adjustment changes (NTP/chrony disciplined the system clock)
+//  2. Mark timestamps as unsynchronized (see Synchronized)
+//  3. Fold the kernel max error into error bounds (see UnixNanoWithError)
+//
+// It returns ErrInvalidConfig if cfg is invalid.
+func RunKernelWatch(ctx context.Context, cfg KernelWatchConfig) error {
+
+	if !Supported() {
+		return ErrUnsupported
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	w := &kernelWatcher{cfg: cfg}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		need, err := w.check()
+		if err != nil {
+			return err
+		}
+		if need {
+			recalibrate()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// setKernelState applies the kernel clock state to calibration blocks.
+func setKernelState(unsync bool, maxErr int64) {
+	calibrationMu.Lock()
+	defer calibrationMu.Unlock()
+
+	if kernelState.unsync == unsync && kernelState.maxErr == maxErr {
+		return
+	}
+	kernelState.unsync, kernelState.maxErr = unsync, maxErr
+
+	if isSubscribed() {
+		return
+	}
+	b := loadBlock(offsetCoeffAddr())
+	if !b.isValid() {
+		return
+	}
+	applyKernelState(&b)
+	storeBlock(offsetCoeffAddr(), &b)
+	shmPublish(calibration, &b)
+}
+
+// applyKernelState applies the kernel clock state to b.
+// It must be invoked with calibrationMu held.
+func applyKernelState(b *block) {
+	b.flags &^= blockFlagUnsync
+	if kernelState.unsync {
+		b.flags |= blockFlagUnsync
+	}
+	b.kernelErr = kernelState.maxErr
+}
+
+// Synchronized returns false if the kernel clock (the reference clock of calibration)
+// has been found unsynchronized by RunKernelWatch (or the publisher's after Subscribe),
+// timestamps made by UnixNano may be far away from the real time then.
+//
+// It's true if RunKernelWatch isn't running.
+func Synchronized() bool {
+	b := loadBlock(offsetCoeffAddr())
+	return b.flags&blockFlagUnsync == 0
+}
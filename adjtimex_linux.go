@@ -0,0 +1,24 @@
+package tsc
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func readKernelClock() (KernelClock, error) {
+
+	var tx unix.Timex // Modes is 0: read-only.
+	state, err := unix.Adjtimex(&tx)
+	if err != nil {
+		return KernelClock{}, fmt.Errorf("tsc: failed to read adjtimex: %w", err)
+	}
+	return KernelClock{
+		Synchronized: tx.Status&unix.STA_UNSYNC == 0 && state != unix.TIME_ERROR,
+		Freq:         float64(tx.Freq) / (1 << 16), // Scaled ppm with 16-bit fraction.
+		EstError:     time.Duration(tx.Esterror) * time.Microsecond,
+		MaxError:     time.Duration(tx.Maxerror) * time.Microsecond,
+		TAIOffset:    time.Duration(tx.Tai) * time.Second,
+	}, nil
+}
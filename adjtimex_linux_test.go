@@ -0,0 +1,14 @@
+package tsc
+
+import "testing"
+
+func TestReadKernelClock(t *testing.T) {
+
+	kc, err := ReadKernelClock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kc.MaxError < 0 || kc.EstError < 0 {
+		t.Fatalf("unexpected kernel clock: %+v", kc)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package tsc
+
+// readKernelClock returns ErrUnsupported on non-Linux.
+func readKernelClock() (KernelClock, error) {
+	return KernelClock{}, ErrUnsupported
+}
@@ -0,0 +1,154 @@
+package tsc
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// fakeKernelClock replaces the kernel clock reader & recalibrate in testing.
+type fakeKernelClock struct {
+	kc             KernelClock
+	err            error
+	recalibrated   int
+	oldReader      func() (KernelClock, error)
+	oldRecalibrate func()
+}
+
+func newFakeKernelClock() *fakeKernelClock {
+	f := &fakeKernelClock{
+		kc:             KernelClock{Synchronized: true},
+		oldReader:      kernelClockReader,
+		oldRecalibrate: recalibrate,
+	}
+	kernelClockReader = func() (KernelClock, error) { return f.kc, f.err }
+	recalibrate = func() { f.recalibrated++ }
+	return f
+}
+
+func (f *fakeKernelClock) close() {
+	kernelClockReader = f.oldReader
+	recalibrate = f.oldRecalibrate
+	setKernelState(false, 0)
+}
+
+func TestKernelWatcher(t *testing.T) {
+
+	f := newFakeKernelClock()
+	defer f.close()
+
+	w := &kernelWatcher{cfg: DefaultKernelWatchConfig}
+	check := func(expNeed bool) {
+		t.Helper()
+		need, err := w.check()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if need != expNeed {
+			t.Fatalf("mismatched need of recalibrating: exp: %t, got: %t", expNeed, need)
+		}
+	}
+
+	f.kc.Freq = 12.5
+	check(false) // First one is the baseline.
+	f.kc.Freq += DefaultKernelWatchConfig.FreqThreshold / 2
+	check(false)
+	f.kc.Freq += DefaultKernelWatchConfig.FreqThreshold * 2
+	check(true)
+	check(false)
+
+	f.kc.Synchronized = false
+	check(false)
+	f.kc.Synchronized = true
+	check(true) // Synchronized again.
+
+	f.err = errors.New("fake error")
+	if _, err := w.check(); !errors.Is(err, f.err) {
+		t.Fatalf("error should be returned, got: %v", err)
+	}
+}
+
+func TestKernelState(t *testing.T) {
+
+	if !Supported() {
+		t.Skip("tsc is unsupported")
+	}
+
+	defer restoreCalibration(t, Current())
+
+	f := newFakeKernelClock()
+	defer f.close()
+
+	w := &kernelWatcher{cfg: DefaultKernelWatchConfig}
+
+	f.kc = KernelClock{Synchronized: false, MaxError: 16 * time.Millisecond}
+	if _, err := w.check(); err != nil {
+		t.Fatal(err)
+	}
+	if Synchronized() {
+		t.Fatal("should be unsynchronized")
+	}
+	if u := Uncertainty(); u < f.kc.MaxError {
+		t.Fatalf("kernel max error should be folded into uncertainty: %s", u)
+	}
+
+	CalibrateWithCoeff(Current().Coeff) // Kernel state must be kept after calibrating.
+	if Synchronized() || Uncertainty() < f.kc.MaxError {
+		t.Fatalf("kernel state is lost after calibrating: synchronized: %t, uncertainty: %s", Synchronized(), Uncertainty())
+	}
+
+	f.kc = KernelClock{Synchronized: true}
+	if _, err := w.check(); err != nil {
+		t.Fatal(err)
+	}
+	if !Synchronized() {
+		t.Fatal("should be synchronized")
+	}
+	if u := Uncertainty(); u >= 16*time.Millisecond {
+		t.Fatalf("kernel max error should be cleared: %s", u)
+	}
+}
+
+func TestRunKernelWatch(t *testing.T) {
+
+	f := newFakeKernelClock()
+	defer f.close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := RunKernelWatch(ctx, DefaultKernelWatchConfig)
+	if !Supported() {
+		if !errors.Is(err, ErrUnsupported) {
+			t.Fatalf("should be unsupported, got: %v", err)
+		}
+		return
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("should be canceled, got: %v", err)
+	}
+}
+
+func TestKernelWatchConfigValidate(t *testing.T) {
+
+	if err := DefaultKernelWatchConfig.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, cfg := range []KernelWatchConfig{
+		{Interval: 0, FreqThreshold: 0.01},
+		{Interval: -time.Second, FreqThreshold: 0.01},
+		{Interval: time.Second, FreqThreshold: -1},
+		{Interval: time.Second, FreqThreshold: math.NaN()},
+	} {
+		if err := cfg.Validate(); !errors.Is(err, ErrInvalidConfig) {
+			t.Fatalf("should be invalid: %+v, got: %v", cfg, err)
+		}
+		if Supported() {
+			if err := RunKernelWatch(context.Background(), cfg); !errors.Is(err, ErrInvalidConfig) {
+				t.Fatalf("RunKernelWatch should return invalid config: %+v, got: %v", cfg, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,7 @@
+package tsc
+
+// AuxCPU returns the CPU & NUMA node in aux (IA32_TSC_AUX returned by RDTSCP),
+// Linux sets it to (node << 12) | cpu for each CPU.
+func AuxCPU(aux uint32) (cpu, node int) {
+	return int(aux & 0xfff), int(aux >> 12)
+}
@@ -0,0 +1,42 @@
+package tsc
+
+import (
+	"testing"
+
+	"github.com/klauspost/cpuid/v2"
+	"github.com/templexxx/tsc/internal/affinity"
+)
+
+func TestRDTSCP(t *testing.T) {
+
+	if !cpuid.CPU.Has(cpuid.RDTSCP) {
+		t.Skip("rdtscp is unsupported")
+	}
+
+	cpus, err := affinity.CPUs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cpu := range cpus {
+		errs := make(chan error, 1)
+		go func() {
+			if err := affinity.Pin(cpu); err != nil {
+				errs <- err
+				return
+			}
+			t0 := RDTSC()
+			t1, aux := RDTSCP()
+			if t1 < t0 {
+				t.Errorf("tsc goes backwards: %d -> %d", t0, t1)
+			}
+			if got, _ := AuxCPU(aux); got != cpu {
+				t.Errorf("cpu mismatched: exp: %d, got: %d", cpu, got)
+			}
+			errs <- nil
+		}()
+		if err = <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
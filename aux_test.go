@@ -0,0 +1,21 @@
+package tsc
+
+import "testing"
+
+func TestAuxCPU(t *testing.T) {
+
+	for _, c := range []struct {
+		aux       uint32
+		cpu, node int
+	}{
+		{0, 0, 0},
+		{5, 5, 0},
+		{1<<12 | 63, 63, 1},
+		{3<<12 | 4095, 4095, 3},
+	} {
+		cpu, node := AuxCPU(c.aux)
+		if cpu != c.cpu || node != c.node {
+			t.Fatalf("aux: %#x, exp: cpu %d node %d, got: cpu %d node %d", c.aux, c.cpu, c.node, cpu, node)
+		}
+	}
+}
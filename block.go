@@ -0,0 +1,169 @@
+package tsc
+
+import (
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+// block is the calibration block used by UnixNano (see OffsetCoeff for details).
+//
+// Layout (each field is 8 Bytes):
+// [0]  seq: seqlock, odd means writing
+// [1]  version: layout version
+// [2]  flags
+// [3]  coeff
+// [4]  offset: unix_nano_timestamp = tsc * coeff + offset
+// [5]  offsetF: float64(offset), for FMA
+// [6]  baseTSC: the tsc when it's stored
+// [7]  baseNs: unix_nano_timestamp = (tsc - baseTSC) * coeff + baseNs, for better precision
+// [8]  errBound: error bound (ns) at baseTSC
+// [9]  freqErr: relative error of coeff, error bound grows freqErr ns per ns after baseTSC
+// [10] drift: quadratic term (ns/tick²), see EnableDriftCompensation
+// [11] kernelErr: max error (ns) of the kernel clock (the reference clock), see RunKernelWatch
+// [12, 16) reserved
+//
+// Writers must be serialized, and readers (in Go or assembly) retry on a torn read:
+// 1. Load seq, retry if it's odd
+// 2. Load fields
+// 3. Load seq again, retry if it's changed
+//
+// There is no reordering between loads or between stores on x86 (TSO),
+// so it's just plain MOVs in assembly.
+type block struct {
+	seq       uint64
+	version   uint64
+	flags     uint64
+	coeff     float64
+	offset    int64
+	offsetF   float64
+	baseTSC   int64
+	baseNs    int64
+	errBound  int64
+	freqErr   float64
+	drift     float64
+	kernelErr int64
+	_         [4]uint64
+}
+
+const (
+	blockVersion = 1
+	blockWords   = 16
+	blockSize    = blockWords * 8
+)
+
+const (
+	blockFlagValid  = 1 << iota // It has been calibrated.
+	blockFlagUnsync             // The kernel clock isn't synchronized (by NTP), see Synchronized.
+)
+
+// newBlock makes a block at baseTSC.
+func newBlock(offset int64, coeff float64, baseTSC int64) block {
+	return block{
+		version: blockVersion,
+		flags:   blockFlagValid,
+		coeff:   coeff,
+		offset:  offset,
+		offsetF: float64(offset),
+		baseTSC: baseTSC,
+		baseNs:  offset + int64(float64(baseTSC)*coeff),
+	}
+}
+
+func (b *block) isValid() bool {
+	return b.flags&blockFlagValid != 0
+}
+
+// blockMaxRetries is the max retries of a reader on a torn read (about several milliseconds in assembly),
+// it won't be reached unless the writer stalls in writing or dies in writing.
+//
+// In-process writers (storeBlock) can't be abandoned, but the publisher of the shared calibration page
+// (see Publish) is another process, it may die between the two seq updates & leave seq odd
+// until the next publisher repairs it. After giving up:
+// 1. Readers in assembly (UnixNano) fall back to the system clock, see unixNanoFallback.
+// 2. loadBlock falls back to the local calibration block (OffsetCoeff), which is consistent but may be stale.
+//
+// The odd seq is remembered as stuckSeq, readers give up at once when they meet it again,
+// so a dead writer costs the retries only once.
+const blockMaxRetries = 1 << 16
+
+// stuckSeq is the odd seq which readers have given up on (0 means none), it's read in assembly.
+var stuckSeq uint64
+
+// loadBlock loads block from src with retrying on a torn read,
+// it falls back to the local calibration block if the writer of src died in writing (see blockMaxRetries).
+func loadBlock(src *byte) block {
+
+	for {
+		if b, ok := tryLoadBlock(src); ok {
+			return b
+		}
+		src = &OffsetCoeff[0] // In-process writers can't be abandoned, it's just a stalled writer if src is it.
+	}
+}
+
+// tryLoadBlock loads block from src with retrying on a torn read (at most blockMaxRetries times).
+func tryLoadBlock(src *byte) (b block, ok bool) {
+
+	words := (*[blockWords]uint64)(unsafe.Pointer(src))
+	dst := (*[blockWords]uint64)(unsafe.Pointer(&b))
+	for i := 0; i < blockMaxRetries; i++ {
+		seq := atomic.LoadUint64(&words[0])
+		if seq&1 == 1 {
+			if seq == atomic.LoadUint64(&stuckSeq) {
+				return b, false
+			}
+			runtime.Gosched()
+			continue
+		}
+		for j := 1; j < blockWords; j++ {
+			dst[j] = atomic.LoadUint64(&words[j])
+		}
+		if atomic.LoadUint64(&words[0]) == seq {
+			dst[0] = seq
+			return b, true
+		}
+	}
+	markStuck(src)
+	return b, false
+}
+
+// markStuck remembers seq of the block at src as stuckSeq if it's odd.
+func markStuck(src *byte) {
+
+	seq := atomic.LoadUint64((*uint64)(unsafe.Pointer(src)))
+	if seq&1 == 1 {
+		atomic.StoreUint64(&stuckSeq, seq)
+	}
+}
+
+// offsetCoeffAddr loads OffsetCoeffAddr atomically, it could be swapped by Subscribe.
+func offsetCoeffAddr() *byte {
+	return (*byte)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&OffsetCoeffAddr))))
+}
+
+// storeOffsetCoeffAddr points OffsetCoeffAddr (& OffsetCoeffFAddr) to the calibration block at addr atomically.
+// Readers in assembly load the pointer by a single aligned MOVQ, which is atomic on x86.
+func storeOffsetCoeffAddr(addr *byte) {
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&OffsetCoeffAddr)), unsafe.Pointer(addr))
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&OffsetCoeffFAddr)), unsafe.Pointer(addr))
+}
+
+// storeOffsetCoeff stores offset & coefficient to dst with baseTSC = 0.
+func storeOffsetCoeff(dst *byte, offset int64, coeff float64) {
+	b := newBlock(offset, coeff, 0)
+	storeBlock(dst, &b)
+}
+
+// LoadOffsetCoeff loads offset & coefficient from the calibration block at src
+// (e.g., OffsetCoeffAddr) with retrying on a torn read.
+func LoadOffsetCoeff(src *byte) (offset int64, coeff float64) {
+	b := loadBlock(src)
+	return b.offset, b.coeff
+}
+
+// loadOffsetFCoeff loads float64 offset & coefficient from the calibration block at src.
+func loadOffsetFCoeff(src *byte) (offset, coeff float64) {
+	b := loadBlock(src)
+	return b.offsetF, b.coeff
+}
@@ -0,0 +1,85 @@
+package tsc
+
+import (
+	"testing"
+	"time"
+)
+
+// makeStressBlockForUnixNano makes a block whose timestamp is tsc + m (m = i mod 2^19):
+// ns = (tsc - base_tsc) * coeff + base_ns = (tsc - m*2^20) * 1 + m*2^20 + m.
+//
+// Mixing base_tsc & base_ns from different i makes a delta which is far away from [0, 2^19).
+func makeStressBlockForUnixNano(i int64) block {
+	m := i & (1<<19 - 1)
+	return block{
+		version: blockVersion,
+		flags:   blockFlagValid,
+		coeff:   1,
+		offsetF: float64(m),
+		baseTSC: m << 20,
+		baseNs:  m<<20 + m,
+	}
+}
+
+// TestUnixNanoTornRead checks the readers in assembly with the stress harness,
+// every timestamp must be made by a consistent block.
+func TestUnixNanoTornRead(t *testing.T) {
+
+	if !Supported() {
+		t.Skip("tsc is unsupported")
+	}
+
+	for _, fn := range []struct {
+		name string
+		fn   func() int64
+	}{
+		{"unixNanoTSC16B", unixNanoTSC16B},
+		{"unixNanoTSC16Bfence", unixNanoTSC16Bfence},
+		{"unixNanoTSCFMA", unixNanoTSCFMA},
+		{"unixNanoTSCDrift", unixNanoTSCDrift},
+		{"unixNanoTSCDriftFence", unixNanoTSCDriftFence},
+	} {
+		t.Run(fn.name, func(t *testing.T) {
+			origin := OffsetCoeffAddr
+			defer func() { OffsetCoeffAddr = origin }()
+
+			stressBlock(t, 100000, makeStressBlockForUnixNano, func(dst *byte) {
+				OffsetCoeffAddr = dst
+			}, func(dst *byte) bool {
+				before := GetInOrder()
+				ns := fn.fn()
+				after := GetInOrder()
+				return ns-before >= 0 && ns-after < 1<<19
+			})
+		})
+	}
+}
+
+// TestUnixNanoDeadWriter checks the readers in assembly fall back to the system clock
+// if the writer died in writing.
+func TestUnixNanoDeadWriter(t *testing.T) {
+
+	if !Supported() {
+		t.Skip("tsc is unsupported")
+	}
+
+	for _, fn := range implementations() {
+		t.Run(fn.Name, func(t *testing.T) {
+			origin := OffsetCoeffAddr
+			defer func() { OffsetCoeffAddr = origin }()
+			OffsetCoeffAddr = makeDeadWriterBlock(t)
+
+			for i := 0; i < 2; i++ {
+				start := time.Now()
+				ns := fn.Func()
+				cost := time.Since(start)
+				if d := ns - start.UnixNano(); d < 0 || d > int64(time.Second) {
+					t.Fatalf("should fall back to the system clock, but got delta: %d", d)
+				}
+				if i == 1 && cost > time.Millisecond {
+					t.Fatalf("should give up at once on a stuck seq, but cost: %s", cost)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package tsc
+
+import (
+	"flag"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/templexxx/tsc/internal/xbytes"
+)
+
+var blockStress = flag.Duration("block_stress", 0,
+	"run concurrent block store & load for the duration (e.g., -block_stress 1m), 0 means a quick run")
+
+func TestBlockLayout(t *testing.T) {
+
+	var b block
+	if unsafe.Sizeof(b) != blockSize {
+		t.Fatalf("mismatched block size: exp: %d, got: %d", blockSize, unsafe.Sizeof(b))
+	}
+	// Offsets are hard-coded in assembly.
+	offsets := []struct {
+		name string
+		exp  uintptr
+		act  uintptr
+	}{
+		{"seq", 0, unsafe.Offsetof(b.seq)},
+		{"coeff", 24, unsafe.Offsetof(b.coeff)},
+		{"offsetF", 40, unsafe.Offsetof(b.offsetF)},
+		{"baseTSC", 48, unsafe.Offsetof(b.baseTSC)},
+		{"baseNs", 56, unsafe.Offsetof(b.baseNs)},
+		{"drift", 80, unsafe.Offsetof(b.drift)},
+	}
+	for _, o := range offsets {
+		if o.exp != o.act {
+			t.Fatalf("mismatched offset of %s: exp: %d, got: %d", o.name, o.exp, o.act)
+		}
+	}
+	if len(OffsetCoeff) < blockSize {
+		t.Fatal("OffsetCoeff is too small")
+	}
+}
+
+func TestNewBlock(t *testing.T) {
+
+	offset, coeff, base := int64(1745054585295363584), 0.2380924250227700, int64(1<<50)
+	b := newBlock(offset, coeff, base)
+	if !b.isValid() || b.version != blockVersion {
+		t.Fatal("block should be valid")
+	}
+	tsc := base + 4200049623
+	exp := offset + int64(float64(tsc)*coeff)
+	act := b.baseNs + int64(float64(tsc-b.baseTSC)*b.coeff)
+	if d := act - exp; d > 1 || d < -1 {
+		t.Fatalf("mismatched timestamp: exp: %d, got: %d", exp, act)
+	}
+}
+
+// makeStressBlock makes a block whose fields are derived from i,
+// so a torn read could be found.
+func makeStressBlock(i int64) block {
+	return block{
+		version:  blockVersion,
+		flags:    blockFlagValid,
+		coeff:    float64(i),
+		offset:   i,
+		offsetF:  float64(i),
+		baseTSC:  i << 1,
+		baseNs:   i << 2,
+		errBound: -i,
+	}
+}
+
+func checkStressBlock(b block) bool {
+	i := b.offset
+	exp := makeStressBlock(i)
+	exp.seq = b.seq
+	return b == exp
+}
+
+// stressBlock runs a writer (storing blocks made by mk) & readers concurrently
+// until n loads per reader or blockStress passed.
+func stressBlock(t *testing.T, n int, mk func(i int64) block, setup func(dst *byte), read func(dst *byte) bool) {
+
+	dst := xbytes.MakeAlignedBlock(blockSize, blockSize)
+	b := mk(0)
+	storeBlock(&dst[0], &b)
+	if setup != nil {
+		setup(&dst[0])
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := int64(1); ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			b := mk(i)
+			storeBlock(&dst[0], &b)
+		}
+	}()
+	defer wg.Wait()
+	defer close(done)
+
+	deadline := time.Now().Add(*blockStress)
+	readers := runtime.GOMAXPROCS(0)
+	var rwg sync.WaitGroup
+	rwg.Add(readers)
+	for r := 0; r < readers; r++ {
+		go func() {
+			defer rwg.Done()
+			for j := 0; j < n || time.Now().Before(deadline); j++ {
+				if !read(&dst[0]) {
+					t.Error("torn read")
+					return
+				}
+			}
+		}()
+	}
+	rwg.Wait()
+}
+
+func TestStoreLoadBlockConcurrently(t *testing.T) {
+
+	stressBlock(t, 100000, makeStressBlock, nil, func(dst *byte) bool {
+		return checkStressBlock(loadBlock(dst))
+	})
+}
+
+// makeDeadWriterBlock makes a block whose writer died in writing (seq is odd forever).
+func makeDeadWriterBlock(t *testing.T) *byte {
+
+	t.Cleanup(func() { stuckSeq = 0 })
+
+	dst := &xbytes.MakeAlignedBlock(blockSize, blockSize)[0]
+	b := newBlock(0, 1, 0)
+	storeBlock(dst, &b)
+	*(*uint64)(unsafe.Pointer(dst)) += 1
+	return dst
+}
+
+func TestLoadBlockDeadWriter(t *testing.T) {
+
+	dst := makeDeadWriterBlock(t)
+	local := &OffsetCoeff[0]
+	calibrationMu.Lock() // No calibration meanwhile.
+	defer calibrationMu.Unlock()
+	origin := loadBlock(local)
+	defer storeBlock(local, &origin)
+	exp := newBlock(1, 2, 3)
+	storeBlock(local, &exp)
+
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		b := loadBlock(dst)
+		cost := time.Since(start)
+		if b.coeff != exp.coeff || b.offset != exp.offset || b.baseTSC != exp.baseTSC {
+			t.Fatalf("should fall back to the local block: exp: %+v, got: %+v", exp, b)
+		}
+		if i == 1 && cost > time.Millisecond {
+			t.Fatalf("should give up at once on a stuck seq, but cost: %s", cost)
+		}
+	}
+}
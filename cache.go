@@ -0,0 +1,187 @@
+package tsc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// CacheEnv is the environment variable for enabling calibration cache in init:
+// "1" means using DefaultCachePath, others are regarded as the cache file path.
+//
+// With cache, a new process loads the frequency from cache,
+// makes a quick offset fix and refines the calibration in background,
+// instead of calibrating about 2s in init.
+const CacheEnv = "TSC_CACHE"
+
+// MaxCacheAge is the max age of the calibration in cache file.
+var MaxCacheAge = 24 * time.Hour
+
+// SourceCache means the frequency is loaded from cache file (with a quick offset fix).
+const SourceCache = "cache"
+
+var (
+	ErrCacheCorrupted  = errors.New("tsc: cache corrupted")
+	ErrCacheMismatched = errors.New("tsc: cache mismatched")
+	ErrCacheStale      = errors.New("tsc: cache is stale")
+)
+
+const cacheVersion = 1
+
+var linuxBootIDPath = "/proc/sys/kernel/random/boot_id"
+
+// cacheEntry is the content of cache file.
+// The frequency is only meaningful on the same CPU, boot & clock source.
+type cacheEntry struct {
+	Version     int         `json:"version"`
+	BootID      string      `json:"boot_id"`
+	ClockSource string      `json:"clock_source"`
+	Calibration Calibration `json:"calibration"`
+	Checksum    uint32      `json:"checksum"`
+}
+
+func (e *cacheEntry) checksum() uint32 {
+	b, _ := e.Calibration.MarshalBinary()
+	h := crc32.NewIEEE()
+	_, _ = fmt.Fprintf(h, "%d|%s|%s|", e.Version, e.BootID, e.ClockSource)
+	_, _ = h.Write(b)
+	return h.Sum32()
+}
+
+// DefaultCachePath returns the default cache file path:
+// $XDG_CACHE_HOME/tsc/calibration.json (or the same thing on other OS, see os.UserCacheDir).
+func DefaultCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "tsc", "calibration.json")
+}
+
+// cachePathFromEnv returns cache file path set by CacheEnv.
+// Empty means cache is disabled.
+func cachePathFromEnv() string {
+	p := os.Getenv(CacheEnv)
+	if p == "1" {
+		return DefaultCachePath()
+	}
+	return p
+}
+
+// SaveCache saves the current calibration to the cache file at path.
+//
+// It's safe to save the same path concurrently (even in multi processes),
+// because it writes a temporary file and renames it.
+func SaveCache(path string) error {
+
+	c := Current()
+	if !(c.Coeff > 0) {
+		return ErrInvalidCalibration
+	}
+	if c.Source == SourceCache {
+		return fmt.Errorf("%w: the frequency hasn't been refined after loading from cache", ErrInvalidCalibration)
+	}
+
+	e := &cacheEntry{
+		Version:     cacheVersion,
+		BootID:      getBootID(),
+		ClockSource: GetCurrentClockSource(),
+		Calibration: c,
+	}
+	e.Checksum = e.checksum()
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // It's a no-op after renaming.
+
+	if _, err = f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// LoadCache loads the frequency from cache file at path,
+// and makes a quick offset fix.
+//
+// It's a good practice that runs Calibrate (and SaveCache) in background after loading,
+// for refining the calibration.
+func LoadCache(path string) error {
+
+	if !Supported() {
+		return ErrUnsupported
+	}
+
+	c, err := readCache(path)
+	if err != nil {
+		return err
+	}
+	calibrateOffset(c.Coeff, c.FreqError, SourceCache)
+	return nil
+}
+
+// readCache reads & validates cache file.
+func readCache(path string) (Calibration, error) {
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Calibration{}, err
+	}
+
+	e := new(cacheEntry)
+	if err = json.Unmarshal(b, e); err != nil {
+		return Calibration{}, fmt.Errorf("%w: %s", ErrCacheCorrupted, err.Error())
+	}
+	if e.Version != cacheVersion || e.Checksum != e.checksum() {
+		return Calibration{}, ErrCacheCorrupted
+	}
+
+	c := e.Calibration
+	if c.CPUSignature != cpuSignature() || e.BootID != getBootID() || e.ClockSource != GetCurrentClockSource() {
+		return Calibration{}, ErrCacheMismatched
+	}
+	if time.Duration(time.Now().UnixNano()-c.Timestamp) > MaxCacheAge {
+		return Calibration{}, ErrCacheStale
+	}
+	if !(c.Coeff > 0) {
+		return Calibration{}, ErrCacheCorrupted
+	}
+	return c, nil
+}
+
+// getBootID gets boot ID on Linux.
+func getBootID() string {
+
+	if runtime.GOOS != "linux" {
+		return ""
+	}
+
+	d, err := os.ReadFile(linuxBootIDPath)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(d))
+}
@@ -0,0 +1,162 @@
+package tsc
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeTestCacheEntry(t *testing.T, path string, e *cacheEntry) {
+	e.Checksum = e.checksum()
+	b, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func makeTestCacheEntry() *cacheEntry {
+	return &cacheEntry{
+		Version:     cacheVersion,
+		BootID:      getBootID(),
+		ClockSource: GetCurrentClockSource(),
+		Calibration: makeTestCalibration(),
+	}
+}
+
+func TestReadCache(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "calibration.json")
+
+	e := makeTestCacheEntry()
+	writeTestCacheEntry(t, path, e)
+	c, err := readCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != e.Calibration {
+		t.Fatalf("mismatched calibration: exp: %+v, got: %+v", e.Calibration, c)
+	}
+
+	e = makeTestCacheEntry()
+	e.BootID += "-"
+	writeTestCacheEntry(t, path, e)
+	if _, err = readCache(path); !errors.Is(err, ErrCacheMismatched) {
+		t.Fatalf("should be mismatched, but got: %v", err)
+	}
+
+	e = makeTestCacheEntry()
+	e.Calibration.CPUSignature += "_"
+	writeTestCacheEntry(t, path, e)
+	if _, err = readCache(path); !errors.Is(err, ErrCacheMismatched) {
+		t.Fatalf("should be mismatched, but got: %v", err)
+	}
+
+	e = makeTestCacheEntry()
+	e.Calibration.Timestamp -= int64(MaxCacheAge + time.Second)
+	writeTestCacheEntry(t, path, e)
+	if _, err = readCache(path); !errors.Is(err, ErrCacheStale) {
+		t.Fatalf("should be stale, but got: %v", err)
+	}
+
+	e = makeTestCacheEntry()
+	writeTestCacheEntry(t, path, e)
+	b, _ := os.ReadFile(path)
+	for _, corrupted := range [][]byte{b[:len(b)/2], append([]byte("x"), b...), []byte("")} {
+		if err = os.WriteFile(path, corrupted, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = readCache(path); !errors.Is(err, ErrCacheCorrupted) {
+			t.Fatalf("should be corrupted, but got: %v", err)
+		}
+	}
+
+	e.Calibration.Coeff *= 2 // Without updating checksum.
+	b, _ = json.Marshal(e)
+	if err = os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = readCache(path); !errors.Is(err, ErrCacheCorrupted) {
+		t.Fatalf("should be corrupted, but got: %v", err)
+	}
+}
+
+func TestSaveLoadCache(t *testing.T) {
+
+	if !Supported() {
+		t.Skip("tsc is unsupported")
+	}
+
+	origin := Current()
+	defer func() {
+		origin.Timestamp = time.Now().UnixNano()
+		if err := Apply(origin); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	path := filepath.Join(t.TempDir(), "tsc", "calibration.json")
+	if err := SaveCache(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadCache(path); err != nil {
+		t.Fatal(err)
+	}
+	c := Current()
+	if c.Source != SourceCache || c.Coeff != origin.Coeff {
+		t.Fatalf("unexpected calibration after loading: %+v", c)
+	}
+	if err := SaveCache(path); !errors.Is(err, ErrInvalidCalibration) {
+		t.Fatalf("should not save calibration loaded from cache, but got: %v", err)
+	}
+}
+
+func TestSaveCacheConcurrently(t *testing.T) {
+
+	if !Supported() {
+		t.Skip("tsc is unsupported")
+	}
+
+	path := filepath.Join(t.TempDir(), "calibration.json")
+	if err := SaveCache(path); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 64; j++ {
+				if err := SaveCache(path); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 64; j++ {
+				if _, err := readCache(path); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("temporary files left: %d", len(entries)-1)
+	}
+}
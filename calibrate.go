@@ -0,0 +1,169 @@
+package tsc
+
+import "math"
+
+// Calibrate calibrates tsc clock.
+//
+// It's a good practice that runs Calibrate periodically (e.g., 5 min is a good start).
+func Calibrate() {
+
+	if !isHardwareSupported() || isSubscribed() {
+		return
+	}
+
+	r := fitAgainst(nil)
+	c := makeCalibration(r.offset, r.coeff, SourceCalibrate)
+	c.ErrorBound, c.FreqError = r.errBound, r.freqErr
+	storeFitted(c, r)
+}
+
+// CalibrateAgainst calibrates tsc clock against the reference clock (e.g., Clock(ClockMonotonicRaw)),
+// and returns the result without applying it:
+// reference_clock_ns = tsc_register_value * Coeff + Offset.
+func CalibrateAgainst(ref ReferenceClock) (Calibration, error) {
+
+	if !isHardwareSupported() {
+		return Calibration{}, ErrUnsupported
+	}
+
+	r := fitAgainst(ref)
+	c := makeCalibration(r.offset, r.coeff, SourceCalibrate)
+	c.ErrorBound, c.FreqError = r.errBound, r.freqErr
+	return c, nil
+}
+
+// fitAgainst samples tsc & the reference clock (the system clock if ref is nil), and fits them.
+func fitAgainst(ref ReferenceClock) fitResult {
+
+	cnt := samples
+
+	tscs := make([]int64, cnt*2)
+	refs := make([]int64, cnt*2)
+	window := int64(0)
+
+	for j := 0; j < cnt; j++ {
+		md0, tsc0, ref0 := getClosestTSCRef(getClosestTSCSysRetries, ref)
+		sleep(sampleDuration)
+		md1, tsc1, ref1 := getClosestTSCRef(getClosestTSCSysRetries, ref)
+
+		tscs[j*2] = tsc0
+		tscs[j*2+1] = tsc1
+
+		refs[j*2] = ref0
+		refs[j*2+1] = ref1
+
+		window = max(window, md0, md1)
+	}
+
+	return fit(tscs, refs, window)
+}
+
+// CalibrateWithCoeff calibrates coefficient to wall_clock by variables.
+//
+// Not thread safe, only for testing.
+func CalibrateWithCoeff(c float64) {
+
+	if !Supported() {
+		return
+	}
+
+	calibrateOffset(c, 0, SourceCoeff)
+}
+
+// calibrateOffset calibrates offset with coefficient (and its relative error) by a single sample.
+func calibrateOffset(coeff, freqErr float64, source string) {
+
+	md, tsc, sys := getClosestTSCSys(getClosestTSCSysRetries)
+	off := sys - int64(float64(tsc)*coeff)
+	c := makeCalibration(off, coeff, source)
+	c.ErrorBound = int64(math.Ceil(float64(md) * coeff / 2))
+	c.FreqError = freqErr
+	storeCalibration(c)
+}
+
+// getClosestTSCSys tries to get the closest tsc register value nearby the system clock in a loop.
+func getClosestTSCSys(n int) (minDelta, tscClock, sys int64) {
+	return getClosestTSCRef(n, nil)
+}
+
+// getClosestTSCRef tries to get the closest tsc register value nearby the reference clock
+// (the system clock if ref is nil) in a loop.
+func getClosestTSCRef(n int, ref ReferenceClock) (minDelta, tscClock, sys int64) {
+
+	// 256 is enough for finding the lowest sys clock cost in most cases.
+	// Although time.Now() is using VDSO to get time, but it's unstable,
+	// sometimes it will take more than 1000ns,
+	// we have to use a big loop(e.g. 256) to get the "real" clock.
+	// And it won't take a long time to finish a calibrating job, only about 20µs.
+	// [tscClock, wc, tscClock, wc, ..., tscClock]
+	timeline := make([]int64, n+n+1)
+
+	sampleTimeline(timeline, ref)
+
+	// The minDelta is the smallest gap between two adjacent tscs,
+	// which means the smallest gap between sys clock and tscClock too.
+	minDelta = int64(math.MaxInt64)
+	minIndex := 1 // minIndex is sys clock index where has minDelta.
+
+	// time.Now()'s precision is only µs (on macOS),
+	// which means we will get the multi-same sys clock in timeline,
+	// and the middle one is closer to the real time in statistics.
+	// Try to find the minimum delta when sys clock is in the "middle".
+	for i := 1; i < len(timeline)-1; i += 2 {
+		last := timeline[i]
+		for j := i + 2; j < len(timeline)-1; j += 2 {
+			if timeline[j] != last {
+				mid := (i + j - 2) >> 1
+				if isEven(mid) {
+					mid++
+				}
+
+				delta := timeline[mid+1] - timeline[mid-1]
+				if delta < minDelta {
+					minDelta = delta
+					minIndex = mid
+				}
+
+				i = j
+				last = timeline[j]
+			}
+		}
+	}
+
+	tscClock = (timeline[minIndex+1] + timeline[minIndex-1]) >> 1
+	sys = timeline[minIndex]
+
+	return
+}
+
+// sampleTimeline fills timeline by reading tsc & ref (the system clock if ref is nil) in turn.
+//
+// The tsc register & the system clock are read by direct calls unless the source is simulated (see SetSource),
+// calls by function values take longer and widen the sampling window.
+func sampleTimeline(timeline []int64, ref ReferenceClock) {
+
+	if simulated {
+		if ref == nil {
+			ref = wallClock
+		}
+		timeline[0] = rdtsc()
+		for i := 1; i < len(timeline)-1; i += 2 {
+			timeline[i] = ref()
+			timeline[i+1] = rdtsc()
+		}
+		return
+	}
+
+	timeline[0] = RDTSC()
+	if ref == nil {
+		for i := 1; i < len(timeline)-1; i += 2 {
+			timeline[i] = sysClock()
+			timeline[i+1] = RDTSC()
+		}
+		return
+	}
+	for i := 1; i < len(timeline)-1; i += 2 {
+		timeline[i] = ref()
+		timeline[i+1] = RDTSC()
+	}
+}
@@ -0,0 +1,267 @@
+package tsc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/templexxx/cpu"
+)
+
+// Sources of Calibration.
+const (
+	SourceCalibrate = "calibrate" // Made by Calibrate.
+	SourceCoeff     = "coeff"     // Made by CalibrateWithCoeff.
+)
+
+// MaxCalibrationAge is the max age of a Calibration which could be applied by Apply.
+// The offset drifts away from the wall clock after calibrating,
+// it's meaningless to apply a too old one.
+var MaxCalibrationAge = time.Hour
+
+var (
+	ErrUnsupported         = errors.New("tsc: unsupported")
+	ErrInvalidCalibration  = errors.New("tsc: invalid calibration")
+	ErrCPUMismatch         = errors.New("tsc: cpu signature mismatched")
+	ErrCalibrationTooOld   = errors.New("tsc: calibration is too old")
+	ErrCalibrationTooShort = errors.New("tsc: calibration binary is too short")
+	ErrInvalidConfig       = errors.New("tsc: invalid config")
+)
+
+// Calibration is a snapshot of calibration parameters.
+//
+// unix_nano_timestamp = tsc_register_value * Coeff + Offset.
+type Calibration struct {
+	Coeff        float64 `json:"coeff"`
+	Offset       int64   `json:"offset"`
+	Frequency    float64 `json:"frequency"`     // TSC frequency in Hz, 1e9 / Coeff.
+	Timestamp    int64   `json:"timestamp"`     // When it's made, Unix nanoseconds.
+	CPUSignature string  `json:"cpu_signature"` // DisplayFamily_DisplayModel_SteppingID.
+	Source       string  `json:"source"`        // Who made it.
+	ErrorBound   int64   `json:"error_bound"`   // Error bound (ns) at Timestamp.
+	FreqError    float64 `json:"freq_error"`    // Relative error of Coeff, see UnixNanoWithError.
+	Drift        float64 `json:"drift"`         // Quadratic term (ns/tick²) since Timestamp, see EnableDriftCompensation.
+}
+
+var (
+	calibrationMu sync.Mutex
+	calibration   Calibration // Last applied.
+)
+
+// Current returns the Calibration in using.
+//
+// It returns zero Calibration if TSC is unsupported.
+func Current() Calibration {
+	if c, ok := shmLoad(); ok {
+		return c
+	}
+
+	calibrationMu.Lock()
+	defer calibrationMu.Unlock()
+
+	return calibration
+}
+
+// Apply applies c as the current calibration after validation:
+// 1. CPU signature must be as same as this machine
+// 2. c must be made within MaxCalibrationAge
+func Apply(c Calibration) error {
+
+	if !Supported() {
+		return ErrUnsupported
+	}
+	if isSubscribed() {
+		return ErrShmReadOnly
+	}
+
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	storeCalibration(c)
+	return nil
+}
+
+// Validate checks c could be applied on this machine or not.
+func (c Calibration) Validate() error {
+
+	if !(c.Coeff > 0) || math.IsInf(c.Coeff, 0) {
+		return ErrInvalidCalibration
+	}
+	if c.CPUSignature != cpuSignature() {
+		return fmt.Errorf("%w: exp: %s, got: %s", ErrCPUMismatch, cpuSignature(), c.CPUSignature)
+	}
+	age := time.Duration(wallClock() - c.Timestamp)
+	if age > MaxCalibrationAge {
+		return fmt.Errorf("%w: age: %s", ErrCalibrationTooOld, age)
+	}
+	return nil
+}
+
+// UnixNano converts tsc register value to Unix nanoseconds by c.
+//
+// Offset is added in int64, it's precise in nanoseconds (float64 Unix nanoseconds are in 256ns).
+// It's the linear model: Drift isn't applied (there is no tsc of Timestamp in c to apply it from),
+// so it differs from UnixNano with EnableDriftCompensation by Drift * (tsc - tsc_at_timestamp)².
+func (c Calibration) UnixNano(tsc int64) int64 {
+	return c.Offset + int64(math.Round(float64(tsc)*c.Coeff))
+}
+
+// ConvertBatch converts tsc register values in src to Unix nanoseconds in dst by c (as same as UnixNano).
+//
+// dst must be at least as long as src.
+func (c Calibration) ConvertBatch(dst, src []int64) {
+
+	if len(dst) < len(src) {
+		panic("tsc: dst is shorter than src")
+	}
+	for i, v := range src {
+		dst[i] = c.UnixNano(v)
+	}
+}
+
+const calibrationBinaryVersion = 3
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+//
+// Layout (little-endian):
+// version(1) | coeff(8) | offset(8) | frequency(8) | timestamp(8) |
+// error_bound(8) | freq_error(8) | drift(8) |
+// len(cpu_signature)(2) | cpu_signature | len(source)(2) | source
+//
+// Version 1 has no error_bound, freq_error & drift.
+// Version 2 has no drift.
+func (c Calibration) MarshalBinary() ([]byte, error) {
+
+	if len(c.CPUSignature) > math.MaxUint16 || len(c.Source) > math.MaxUint16 {
+		return nil, ErrInvalidCalibration
+	}
+
+	b := make([]byte, 0, 1+8*7+2+len(c.CPUSignature)+2+len(c.Source))
+	b = append(b, calibrationBinaryVersion)
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(c.Coeff))
+	b = binary.LittleEndian.AppendUint64(b, uint64(c.Offset))
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(c.Frequency))
+	b = binary.LittleEndian.AppendUint64(b, uint64(c.Timestamp))
+	b = binary.LittleEndian.AppendUint64(b, uint64(c.ErrorBound))
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(c.FreqError))
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(c.Drift))
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(c.CPUSignature)))
+	b = append(b, c.CPUSignature...)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(c.Source)))
+	b = append(b, c.Source...)
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (c *Calibration) UnmarshalBinary(data []byte) error {
+
+	if len(data) < 1 {
+		return ErrCalibrationTooShort
+	}
+	version := data[0]
+	fixed := 8 * 4
+	switch version {
+	case 1:
+	case 2:
+		fixed += 8 * 2
+	case calibrationBinaryVersion:
+		fixed += 8 * 3
+	default:
+		return fmt.Errorf("%w: unknown version: %d", ErrInvalidCalibration, version)
+	}
+	data = data[1:]
+	if len(data) < fixed {
+		return ErrCalibrationTooShort
+	}
+
+	var r Calibration
+	r.Coeff = math.Float64frombits(binary.LittleEndian.Uint64(data[0:]))
+	r.Offset = int64(binary.LittleEndian.Uint64(data[8:]))
+	r.Frequency = math.Float64frombits(binary.LittleEndian.Uint64(data[16:]))
+	r.Timestamp = int64(binary.LittleEndian.Uint64(data[24:]))
+	if version >= 2 {
+		r.ErrorBound = int64(binary.LittleEndian.Uint64(data[32:]))
+		r.FreqError = math.Float64frombits(binary.LittleEndian.Uint64(data[40:]))
+	}
+	if version >= 3 {
+		r.Drift = math.Float64frombits(binary.LittleEndian.Uint64(data[48:]))
+	}
+	data = data[fixed:]
+
+	for _, s := range []*string{&r.CPUSignature, &r.Source} {
+		if len(data) < 2 {
+			return ErrCalibrationTooShort
+		}
+		n := int(binary.LittleEndian.Uint16(data))
+		data = data[2:]
+		if len(data) < n {
+			return ErrCalibrationTooShort
+		}
+		*s = string(data[:n])
+		data = data[n:]
+	}
+
+	*c = r
+	return nil
+}
+
+// storeCalibration stores c's offset & coefficient to the blocks which used by UnixNano,
+// saves c as the current calibration (recorded in History) and publishes it if there is a Publisher.
+//
+// It does nothing after Subscribe.
+func storeCalibration(c Calibration) {
+	storeFitted(c, fitResult{})
+}
+
+// storeFitted is storeCalibration with the fitting result r (made by Calibrate) recorded in History,
+// and c.Drift is estimated from the fitted calibrations in History (see driftOf).
+func storeFitted(c Calibration, r fitResult) {
+
+	tai, taiOK := sampleTAI() // Sampling is slow, calibrationMu only guards publishing.
+
+	calibrationMu.Lock()
+	defer calibrationMu.Unlock()
+
+	if isSubscribed() {
+		return
+	}
+
+	if r.base != 0 {
+		c.Drift = driftOf(driftPoint{tsc: r.base, coeff: c.Coeff})
+	}
+
+	b := newBlock(c.Offset, c.Coeff, rdtsc())
+	age := float64(wallClock() - c.Timestamp)
+	b.errBound = c.ErrorBound + int64(math.Ceil(math.Abs(age)*c.FreqError))
+	b.freqErr = c.FreqError
+	b.drift = c.Drift
+	applyKernelState(&b)
+	ob := loadBlock(offsetCoeffAddr())
+	storeBlock(offsetCoeffAddr(), &b)
+	calibration = c
+	addRecord(Record{Calibration: c, Residual: r.residual, OffsetJump: offsetJump(&ob, &b), BaseTSC: r.base})
+	if taiOK {
+		storeTAI(tai, c.Coeff, c.FreqError)
+	}
+	shmPublish(c, &b)
+}
+
+// makeCalibration makes a Calibration on this machine now.
+func makeCalibration(offset int64, coeff float64, source string) Calibration {
+	return Calibration{
+		Coeff:        coeff,
+		Offset:       offset,
+		Frequency:    1e9 / coeff,
+		Timestamp:    wallClock(),
+		CPUSignature: cpuSignature(),
+		Source:       source,
+	}
+}
+
+func cpuSignature() string {
+	return fmt.Sprintf("%s_%d", cpu.X86.Signature, cpu.X86.SteppingID)
+}
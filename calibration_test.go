@@ -0,0 +1,179 @@
+package tsc
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// restoreCalibration applies c (refreshed) back after tests which change the current calibration.
+func restoreCalibration(t *testing.T, c Calibration) {
+	c.Timestamp = time.Now().UnixNano()
+	if err := Apply(c); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func makeTestCalibration() Calibration {
+	return Calibration{
+		Coeff:        0.2380924250227700,
+		Offset:       1745054585295363584,
+		Frequency:    4200049623.1846308708190918,
+		Timestamp:    time.Now().UnixNano(),
+		CPUSignature: cpuSignature(),
+		Source:       SourceCalibrate,
+		ErrorBound:   69,
+		FreqError:    7.089814914024094e-10,
+		Drift:        -1.2e-20,
+	}
+}
+
+func TestCalibrationMarshalJSON(t *testing.T) {
+
+	c := makeTestCalibration()
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var act Calibration
+	if err = json.Unmarshal(b, &act); err != nil {
+		t.Fatal(err)
+	}
+	if act != c {
+		t.Fatalf("mismatched calibration: exp: %+v, got: %+v", c, act)
+	}
+}
+
+func TestCalibrationMarshalBinary(t *testing.T) {
+
+	c := makeTestCalibration()
+	b, err := c.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var act Calibration
+	if err = act.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if act != c {
+		t.Fatalf("mismatched calibration: exp: %+v, got: %+v", c, act)
+	}
+
+	for i := 0; i < len(b); i++ {
+		if err = act.UnmarshalBinary(b[:i]); !errors.Is(err, ErrCalibrationTooShort) {
+			t.Fatalf("should be too short with %d bytes, but got: %v", i, err)
+		}
+	}
+
+	// Version 1 has no error bound & freq error.
+	v1 := append([]byte{1}, b[1:33]...)
+	v1 = append(v1, b[57:]...)
+	if err = act.UnmarshalBinary(v1); err != nil {
+		t.Fatal(err)
+	}
+	exp := c
+	exp.ErrorBound, exp.FreqError, exp.Drift = 0, 0, 0
+	if act != exp {
+		t.Fatalf("mismatched calibration: exp: %+v, got: %+v", exp, act)
+	}
+
+	b[0]++
+	if err = act.UnmarshalBinary(b); !errors.Is(err, ErrInvalidCalibration) {
+		t.Fatalf("should be invalid with unknown version, but got: %v", err)
+	}
+}
+
+func TestCalibrationValidate(t *testing.T) {
+
+	c := makeTestCalibration()
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	c2 := c
+	c2.CPUSignature += "_"
+	if err := c2.Validate(); !errors.Is(err, ErrCPUMismatch) {
+		t.Fatalf("should be cpu mismatched, but got: %v", err)
+	}
+
+	c2 = c
+	c2.Timestamp -= int64(MaxCalibrationAge + time.Second)
+	if err := c2.Validate(); !errors.Is(err, ErrCalibrationTooOld) {
+		t.Fatalf("should be too old, but got: %v", err)
+	}
+
+	c2 = c
+	c2.Coeff = 0
+	if err := c2.Validate(); !errors.Is(err, ErrInvalidCalibration) {
+		t.Fatalf("should be invalid, but got: %v", err)
+	}
+}
+
+// TestCalibrationUnixNano tests UnixNano & ConvertBatch are precise in nanoseconds
+// (float64 Unix nanoseconds are in 256ns).
+func TestCalibrationUnixNano(t *testing.T) {
+
+	c := Calibration{Coeff: 1, Offset: 1.8e18}
+	src := make([]int64, 1031)
+	for i := range src {
+		src[i] = 1<<40 + int64(i)
+	}
+	dst := make([]int64, len(src))
+	c.ConvertBatch(dst, src)
+	for i, v := range src {
+		if exp := c.Offset + v; c.UnixNano(v) != exp || dst[i] != exp {
+			t.Fatalf("mismatched at %d: exp: %d, got: %d (UnixNano), %d (ConvertBatch)", i, exp, c.UnixNano(v), dst[i])
+		}
+	}
+
+	c = makeTestCalibration()
+	for _, v := range []int64{0, 1, 4200049623, 1 << 40, 1 << 52} {
+		if exp := c.Offset + int64(math.Round(float64(v)*c.Coeff)); c.UnixNano(v) != exp {
+			t.Fatalf("mismatched tsc: %d, exp: %d, got: %d", v, exp, c.UnixNano(v))
+		}
+	}
+}
+
+func TestCurrentApply(t *testing.T) {
+
+	if !Supported() {
+		if err := Apply(makeTestCalibration()); !errors.Is(err, ErrUnsupported) {
+			t.Fatalf("should be unsupported, but got: %v", err)
+		}
+		t.Skip("tsc is unsupported")
+	}
+
+	origin := Current()
+	defer func() {
+		origin.Timestamp = time.Now().UnixNano()
+		if err := Apply(origin); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if origin.Source != SourceCalibrate || origin.CPUSignature != cpuSignature() {
+		t.Fatalf("unexpected current calibration: %+v", origin)
+	}
+
+	c := origin
+	c.Offset += int64(time.Second)
+	c.Timestamp = time.Now().UnixNano()
+	if err := Apply(c); err != nil {
+		t.Fatal(err)
+	}
+	if Current() != c {
+		t.Fatalf("mismatched calibration: exp: %+v, got: %+v", c, Current())
+	}
+	offset, coeff := LoadOffsetCoeff(OffsetCoeffAddr)
+	if offset != c.Offset || coeff != c.Coeff {
+		t.Fatalf("mismatched offset & coeff: exp: %d %v, got: %d %v", c.Offset, c.Coeff, offset, coeff)
+	}
+
+	tscc := RDTSC()
+	delta := c.UnixNano(tscc) - origin.UnixNano(tscc)
+	if delta != int64(time.Second) {
+		t.Fatalf("mismatched delta: exp: %d, got: %d", int64(time.Second), delta)
+	}
+}
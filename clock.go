@@ -0,0 +1,80 @@
+package tsc
+
+import "fmt"
+
+// ReferenceClock returns nanoseconds of the reference clock which tsc is calibrated against.
+type ReferenceClock func() int64
+
+// ClockID is the ID of built-in reference clocks (see Clock).
+type ClockID int
+
+// Built-in reference clocks.
+const (
+	ClockRealtime     ClockID = iota // Wall clock (time.Now), default.
+	ClockMonotonic                   // CLOCK_MONOTONIC, slewed by NTP but never steps.
+	ClockMonotonicRaw                // CLOCK_MONOTONIC_RAW, the hardware clock without NTP adjustments.
+	ClockBoottime                    // CLOCK_BOOTTIME, CLOCK_MONOTONIC including suspend.
+	ClockTAI                         // CLOCK_TAI, CLOCK_REALTIME + TAI offset (without leap seconds).
+)
+
+// SourceTwoStage means the calibration is made by CalibrateTwoStage.
+const SourceTwoStage = "two-stage"
+
+func (id ClockID) String() string {
+	switch id {
+	case ClockRealtime:
+		return "realtime"
+	case ClockMonotonic:
+		return "monotonic"
+	case ClockMonotonicRaw:
+		return "monotonic_raw"
+	case ClockBoottime:
+		return "boottime"
+	case ClockTAI:
+		return "tai"
+	default:
+		return fmt.Sprintf("clock(%d)", int(id))
+	}
+}
+
+// Clock returns the built-in reference clock of id.
+//
+// On Linux, others are read from the vDSO data as clock_gettime(2) does (amd64 only),
+// or by the system call which is several times slower (so the ErrorBound made by CalibrateAgainst is wider).
+//
+// Only ClockRealtime is supported on non-Linux (others return ErrUnsupported).
+func Clock(id ClockID) (ReferenceClock, error) {
+	if id == ClockRealtime {
+		return sysClock, nil
+	}
+	return clockGettime(id)
+}
+
+// CalibrateTwoStage calibrates in two stages:
+//  1. Frequency against CLOCK_MONOTONIC_RAW, which is immune to NTP slewing
+//  2. Offset against the wall clock (CLOCK_REALTIME)
+//
+// So the frequency is the real TSC frequency, timestamps won't follow the NTP frequency adjustment
+// (the offset will be fixed by the next calibration).
+//
+// Only Linux is supported.
+func CalibrateTwoStage() error {
+
+	if !Supported() {
+		return ErrUnsupported
+	}
+	if isSubscribed() {
+		return ErrShmReadOnly
+	}
+
+	raw, err := Clock(ClockMonotonicRaw)
+	if err != nil {
+		return err
+	}
+	c, err := CalibrateAgainst(raw)
+	if err != nil {
+		return err
+	}
+	calibrateOffset(c.Coeff, c.FreqError, SourceTwoStage)
+	return nil
+}
@@ -0,0 +1,39 @@
+package tsc
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+var clockIDs = map[ClockID]int32{
+	ClockMonotonic:    unix.CLOCK_MONOTONIC,
+	ClockMonotonicRaw: unix.CLOCK_MONOTONIC_RAW,
+	ClockBoottime:     unix.CLOCK_BOOTTIME,
+	ClockTAI:          unix.CLOCK_TAI,
+}
+
+// clockGettime returns the reference clock read through the vDSO data (see vdsoReferenceClock),
+// it falls back to clock_gettime(2) system call if the vDSO data is unsupported.
+func clockGettime(id ClockID) (ReferenceClock, error) {
+
+	cid, ok := clockIDs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown clock: %s", ErrUnsupported, id)
+	}
+
+	var ts unix.Timespec
+	if err := unix.ClockGettime(cid, &ts); err != nil {
+		return nil, fmt.Errorf("%w: clock %s: %s", ErrUnsupported, id, err.Error())
+	}
+
+	sys := func() int64 {
+		var ts unix.Timespec
+		_ = unix.ClockGettime(cid, &ts) // It's checked above.
+		return ts.Nano()
+	}
+	if ref, err := vdsoReferenceClock(id, sys); err == nil {
+		return ref, nil
+	}
+	return sys, nil
+}
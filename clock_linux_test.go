@@ -0,0 +1,72 @@
+package tsc
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestClockGettime(t *testing.T) {
+
+	for _, id := range []ClockID{ClockMonotonic, ClockMonotonicRaw, ClockBoottime, ClockTAI} {
+		ref, err := Clock(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a := ref()
+		time.Sleep(time.Millisecond)
+		b := ref()
+		if a <= 0 || b-a < int64(time.Millisecond) || b-a > int64(time.Second) {
+			t.Fatalf("unexpected clock %s: %d -> %d", id, a, b)
+		}
+	}
+
+	tai, _ := Clock(ClockTAI)
+	if d := tai() - time.Now().UnixNano(); d < -int64(time.Millisecond) || d > int64(time.Minute) { // TAI offset is 37s at present (or 0 if unset).
+		t.Fatalf("unexpected TAI offset: %d", d)
+	}
+
+	if _, err := Clock(ClockID(100)); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("unknown clock should be unsupported, got: %v", err)
+	}
+}
+
+func TestCalibrateAgainst(t *testing.T) {
+
+	if !Supported() {
+		t.Skip("tsc is unsupported")
+	}
+
+	raw, _ := Clock(ClockMonotonicRaw)
+	c, err := CalibrateAgainst(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// TSC & MONOTONIC_RAW are the same oscillator on most machines, NTP adjustment is less than 500ppm.
+	if d := math.Abs(c.Coeff-Current().Coeff) / c.Coeff; d > 500e-6 {
+		t.Fatalf("coeff is too different from the realtime one: %v vs %v", c.Coeff, Current().Coeff)
+	}
+	if d := c.Offset + int64(float64(RDTSC())*c.Coeff) - raw(); math.Abs(float64(d)) > float64(100*time.Microsecond) {
+		t.Fatalf("delta to monotonic_raw is too big: %d", d)
+	}
+}
+
+func TestCalibrateTwoStage(t *testing.T) {
+
+	if !Supported() {
+		t.Skip("tsc is unsupported")
+	}
+	defer restoreCalibration(t, Current())
+
+	if err := CalibrateTwoStage(); err != nil {
+		t.Fatal(err)
+	}
+	c := Current()
+	if c.Source != SourceTwoStage || c.FreqError <= 0 {
+		t.Fatalf("unexpected calibration: %+v", c)
+	}
+	if d := UnixNano() - time.Now().UnixNano(); math.Abs(float64(d)) > float64(100*time.Microsecond) {
+		t.Fatalf("delta to realtime is too big: %d", d)
+	}
+}
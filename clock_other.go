@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package tsc
+
+import "fmt"
+
+// clockGettime returns ErrUnsupported on non-Linux.
+func clockGettime(id ClockID) (ReferenceClock, error) {
+	return nil, fmt.Errorf("%w: clock %s", ErrUnsupported, id)
+}
@@ -0,0 +1,25 @@
+package tsc
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestClockIDString(t *testing.T) {
+
+	if ClockMonotonicRaw.String() != "monotonic_raw" || ClockID(100).String() != "clock(100)" {
+		t.Fatal("mismatched clock names")
+	}
+}
+
+func TestClockRealtime(t *testing.T) {
+
+	ref, err := Clock(ClockRealtime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := ref() - time.Now().UnixNano(); math.Abs(float64(d)) > float64(time.Millisecond) {
+		t.Fatalf("realtime clock is far away from time.Now: %d", d)
+	}
+}
@@ -0,0 +1,44 @@
+package tsc
+
+// ConvertBatch converts raw tsc register values (e.g., collected by RDTSC) in src
+// to Unix nanoseconds in dst with the current calibration.
+//
+// It's using the same math as FromTSC: ns = (tsc - baseTSC) * coeff + baseNs,
+// which is precise in nanoseconds (tsc * coeff + offset in float64 is in 256ns),
+// and it's vectorized by AVX-512/AVX2 if possible.
+// The calibration block will be loaded only once for the whole batch.
+//
+// It's the linear model even if drift compensation is enabled (see EnableDriftCompensation),
+// use FromTSCWithDrift for the quadratic model.
+//
+// dst must be at least as long as src.
+func ConvertBatch(dst, src []int64) {
+	b := loadBlock(offsetCoeffAddr())
+	convertBatchChecked(dst, src, b.baseTSC, b.baseNs, b.coeff)
+}
+
+// ConvertBatchWithOffsetCoeff is as same as ConvertBatch,
+// but using the provided snapshot of offset & coefficient
+// (e.g., saved by LoadOffsetCoeff when the raw tsc values were collected):
+// ns = tsc * coeff + offset (offset is added in int64).
+//
+// dst must be at least as long as src.
+func ConvertBatchWithOffsetCoeff(dst, src []int64, offset int64, coeff float64) {
+	convertBatchChecked(dst, src, 0, offset, coeff)
+}
+
+func convertBatchChecked(dst, src []int64, baseTSC, baseNs int64, coeff float64) {
+	if len(dst) < len(src) {
+		panic("tsc: dst is shorter than src")
+	}
+	convertBatch(dst[:len(src)], src, baseTSC, baseNs, coeff)
+}
+
+// convertBatchGeneric is the reference implementation of convertBatch.
+//
+// It's as same as unixNanoTSC16B: only the product is in float64, the bases are in int64.
+func convertBatchGeneric(dst, src []int64, baseTSC, baseNs int64, coeff float64) {
+	for i, v := range src {
+		dst[i] = baseNs + int64(float64(v-baseTSC)*coeff)
+	}
+}
@@ -0,0 +1,34 @@
+package tsc
+
+import "github.com/templexxx/cpu"
+
+// convertBatch converts src to dst by SIMD kernels,
+// the tail (or everything if there is no AVX2) is handled by convertBatchGeneric.
+func convertBatch(dst, src []int64, baseTSC, baseNs int64, coeff float64) {
+
+	n := len(src)
+	done := 0
+	switch {
+	case cpu.X86.HasAVX512F && cpu.X86.HasAVX512DQ:
+		done = n &^ 7
+		if done > 0 {
+			convertBatchAVX512(&dst[0], &src[0], done, baseTSC, baseNs, coeff)
+		}
+	case cpu.X86.HasAVX2:
+		done = n &^ 3
+		if done > 0 {
+			convertBatchAVX2(&dst[0], &src[0], done, baseTSC, baseNs, coeff)
+		}
+	}
+	convertBatchGeneric(dst[done:n], src[done:n], baseTSC, baseNs, coeff)
+}
+
+// convertBatchAVX512 converts n (must be multiple of 8) values.
+//
+//go:noescape
+func convertBatchAVX512(dst, src *int64, n int, baseTSC, baseNs int64, coeff float64)
+
+// convertBatchAVX2 converts n (must be multiple of 4) values.
+//
+//go:noescape
+func convertBatchAVX2(dst, src *int64, n int, baseTSC, baseNs int64, coeff float64)
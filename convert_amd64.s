@@ -0,0 +1,146 @@
+#include "textflag.h"
+
+// Constants for converting between int64 & float64 with AVX2 (which has no VCVTQQ2PD & VCVTTPD2QQ).
+DATA cvtHiMagic<>+0x00(SB)/8, $0x4438000000000000 // 3*2^67
+DATA cvtHiMagic<>+0x08(SB)/8, $0x4438000000000000
+DATA cvtHiMagic<>+0x10(SB)/8, $0x4438000000000000
+DATA cvtHiMagic<>+0x18(SB)/8, $0x4438000000000000
+GLOBL cvtHiMagic<>(SB), RODATA|NOPTR, $32
+
+DATA cvtAllMagic<>+0x00(SB)/8, $0x4438001000000000 // 3*2^67 + 2^52
+DATA cvtAllMagic<>+0x08(SB)/8, $0x4438001000000000
+DATA cvtAllMagic<>+0x10(SB)/8, $0x4438001000000000
+DATA cvtAllMagic<>+0x18(SB)/8, $0x4438001000000000
+GLOBL cvtAllMagic<>(SB), RODATA|NOPTR, $32
+
+DATA cvtLoMagic<>+0x00(SB)/8, $0x4330000000000000 // 2^52
+DATA cvtLoMagic<>+0x08(SB)/8, $0x4330000000000000
+DATA cvtLoMagic<>+0x10(SB)/8, $0x4330000000000000
+DATA cvtLoMagic<>+0x18(SB)/8, $0x4330000000000000
+GLOBL cvtLoMagic<>(SB), RODATA|NOPTR, $32
+
+DATA cvtExpMask<>+0x00(SB)/8, $0x00000000000007ff
+DATA cvtExpMask<>+0x08(SB)/8, $0x00000000000007ff
+DATA cvtExpMask<>+0x10(SB)/8, $0x00000000000007ff
+DATA cvtExpMask<>+0x18(SB)/8, $0x00000000000007ff
+GLOBL cvtExpMask<>(SB), RODATA|NOPTR, $32
+
+DATA cvtMantMask<>+0x00(SB)/8, $0x000fffffffffffff
+DATA cvtMantMask<>+0x08(SB)/8, $0x000fffffffffffff
+DATA cvtMantMask<>+0x10(SB)/8, $0x000fffffffffffff
+DATA cvtMantMask<>+0x18(SB)/8, $0x000fffffffffffff
+GLOBL cvtMantMask<>(SB), RODATA|NOPTR, $32
+
+DATA cvtImplicitBit<>+0x00(SB)/8, $0x0010000000000000
+DATA cvtImplicitBit<>+0x08(SB)/8, $0x0010000000000000
+DATA cvtImplicitBit<>+0x10(SB)/8, $0x0010000000000000
+DATA cvtImplicitBit<>+0x18(SB)/8, $0x0010000000000000
+GLOBL cvtImplicitBit<>(SB), RODATA|NOPTR, $32
+
+DATA cvtExpBias<>+0x00(SB)/8, $1075 // 1023 + 52
+DATA cvtExpBias<>+0x08(SB)/8, $1075
+DATA cvtExpBias<>+0x10(SB)/8, $1075
+DATA cvtExpBias<>+0x18(SB)/8, $1075
+GLOBL cvtExpBias<>(SB), RODATA|NOPTR, $32
+
+DATA cvtAbsMask<>+0x00(SB)/8, $0x7fffffffffffffff
+DATA cvtAbsMask<>+0x08(SB)/8, $0x7fffffffffffffff
+DATA cvtAbsMask<>+0x10(SB)/8, $0x7fffffffffffffff
+DATA cvtAbsMask<>+0x18(SB)/8, $0x7fffffffffffffff
+GLOBL cvtAbsMask<>(SB), RODATA|NOPTR, $32
+
+DATA cvtTwo63<>+0x00(SB)/8, $0x43e0000000000000 // 2^63
+DATA cvtTwo63<>+0x08(SB)/8, $0x43e0000000000000
+DATA cvtTwo63<>+0x10(SB)/8, $0x43e0000000000000
+DATA cvtTwo63<>+0x18(SB)/8, $0x43e0000000000000
+GLOBL cvtTwo63<>(SB), RODATA|NOPTR, $32
+
+DATA cvtIndefinite<>+0x00(SB)/8, $0x8000000000000000 // Same as VCVTTSD2SIQ's result of NaN & overflow.
+DATA cvtIndefinite<>+0x08(SB)/8, $0x8000000000000000
+DATA cvtIndefinite<>+0x10(SB)/8, $0x8000000000000000
+DATA cvtIndefinite<>+0x18(SB)/8, $0x8000000000000000
+GLOBL cvtIndefinite<>(SB), RODATA|NOPTR, $32
+
+// func convertBatchAVX512(dst, src *int64, n int, baseTSC, baseNs int64, coeff float64)
+TEXT ·convertBatchAVX512(SB), NOSPLIT, $0
+	MOVQ         dst+0(FP), DI
+	MOVQ         src+8(FP), SI
+	MOVQ         n+16(FP), CX
+	VPBROADCASTQ baseTSC+24(FP), Z15
+	VPBROADCASTQ baseNs+32(FP), Z13
+	VBROADCASTSD coeff+40(FP), Z14
+
+loop:
+	VMOVDQU64  (SI), Z0
+	VPSUBQ     Z15, Z0, Z0 // tsc -= base_tsc
+	VCVTQQ2PD  Z0, Z0      // ftsc = float64(tsc)
+	VMULPD     Z14, Z0, Z0 // ns = coeff * ftsc
+	VCVTTPD2QQ Z0, Z1      // un = int64(ns)
+	VPADDQ     Z13, Z1, Z1 // un += base_ns
+	VMOVDQU64  Z1, (DI)
+	ADDQ       $64, SI
+	ADDQ       $64, DI
+	SUBQ       $8, CX
+	JNZ        loop
+
+	VZEROUPPER
+	RET
+
+// func convertBatchAVX2(dst, src *int64, n int, baseTSC, baseNs int64, coeff float64)
+TEXT ·convertBatchAVX2(SB), NOSPLIT, $0
+	MOVQ         dst+0(FP), DI
+	MOVQ         src+8(FP), SI
+	MOVQ         n+16(FP), CX
+	VPBROADCASTQ baseTSC+24(FP), Y5
+	VPBROADCASTQ baseNs+32(FP), Y15
+	VBROADCASTSD coeff+40(FP), Y14
+	VPXOR        Y13, Y13, Y13
+	VMOVDQU      cvtHiMagic<>(SB), Y12
+	VMOVDQU      cvtAllMagic<>(SB), Y11
+	VMOVDQU      cvtLoMagic<>(SB), Y10
+	VMOVDQU      cvtExpMask<>(SB), Y9
+	VMOVDQU      cvtMantMask<>(SB), Y8
+	VMOVDQU      cvtImplicitBit<>(SB), Y7
+	VMOVDQU      cvtExpBias<>(SB), Y6
+
+loop:
+	// int64 -> float64:
+	// float64(high 48bits) + float64(low 16bits) with only one rounding in the final add.
+	VMOVDQU  (SI), Y0
+	VPSUBQ   Y5, Y0, Y0          // tsc -= base_tsc
+	VPSRAD   $16, Y0, Y1
+	VPBLENDW $0x33, Y13, Y1, Y1
+	VPADDQ   Y12, Y1, Y1
+	VPBLENDW $0x88, Y10, Y0, Y0
+	VSUBPD   Y11, Y1, Y1
+	VADDPD   Y0, Y1, Y0          // ftsc = float64(tsc)
+
+	VMULPD Y14, Y0, Y0 // ns = coeff * ftsc
+
+	// float64 -> int64 (truncated):
+	// shift the mantissa (with implicit bit) by exponent, then apply the sign.
+	VPSRLQ    $52, Y0, Y1
+	VPAND     Y9, Y1, Y1            // exp
+	VPAND     Y8, Y0, Y2
+	VPOR      Y7, Y2, Y2            // mantissa
+	VPSUBQ    Y6, Y1, Y3            // exp - 1075
+	VPSLLVQ   Y3, Y2, Y4            // it's 0 if exp < 1075
+	VPSUBQ    Y1, Y6, Y3            // 1075 - exp
+	VPSRLVQ   Y3, Y2, Y2            // it's 0 if exp > 1075
+	VPOR      Y4, Y2, Y2            // abs(int64(ns))
+	VPCMPGTQ  Y0, Y13, Y1           // sign mask
+	VPXOR     Y1, Y2, Y2
+	VPSUBQ    Y1, Y2, Y2
+	VANDPD    cvtAbsMask<>(SB), Y0, Y0
+	VCMPPD    $0x15, cvtTwo63<>(SB), Y0, Y0 // abs(ns) >= 2^63 or NaN
+	VPBLENDVB Y0, cvtIndefinite<>(SB), Y2, Y2
+	VPADDQ    Y15, Y2, Y2           // un += base_ns
+
+	VMOVDQU Y2, (DI)
+	ADDQ    $32, SI
+	ADDQ    $32, DI
+	SUBQ    $4, CX
+	JNZ     loop
+
+	VZEROUPPER
+	RET
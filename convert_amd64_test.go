@@ -0,0 +1,131 @@
+package tsc
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/templexxx/cpu"
+)
+
+// makeConvertCases makes raw tsc values & bases/coeff covering normal cases & edge cases.
+func makeConvertCases(n int) (srcs [][]int64, baseTSCs, baseNss []int64, coeffs []float64) {
+
+	rand.Seed(time.Now().UnixNano())
+
+	src := make([]int64, n)
+	for i := range src {
+		switch i % 4 {
+		case 0:
+			src[i] = rand.Int63()
+		case 1:
+			src[i] = -rand.Int63()
+		case 2:
+			src[i] = rand.Int63n(1 << 53)
+		default:
+			src[i] = RDTSC() + int64(i)
+		}
+	}
+	edges := []int64{0, 1, -1, 1 << 52, 1<<52 + 1, 1<<53 + 1, 1<<63 - 1, -1 << 63, 1<<62 + 1023, 1<<62 + 1024, 1<<62 + 1025}
+	for len(edges)%8 != 0 {
+		edges = append(edges, rand.Int63())
+	}
+	srcs = [][]int64{src, edges}
+
+	baseTSCs = []int64{0, RDTSC(), -1 << 62, 1<<63 - 1}
+	baseNss = []int64{0, 1745054585295363584, -1745054585295363584, 1<<63 - 1}
+	coeffs = []float64{0.2380924250227700, 1, 0.5, -0.3, 1e-9, 4, math.Inf(1)}
+	return
+}
+
+func testConvertKernel(t *testing.T, kernel func(dst, src *int64, n int, baseTSC, baseNs int64, coeff float64)) {
+
+	srcs, baseTSCs, baseNss, coeffs := makeConvertCases(4096)
+	for _, src := range srcs {
+		for _, baseTSC := range baseTSCs {
+			for _, baseNs := range baseNss {
+				for _, coeff := range coeffs {
+					exp := make([]int64, len(src))
+					convertBatchGeneric(exp, src, baseTSC, baseNs, coeff)
+					act := make([]int64, len(src))
+					kernel(&act[0], &src[0], len(src), baseTSC, baseNs, coeff)
+					for i := range exp {
+						if exp[i] != act[i] {
+							t.Fatalf("mismatched tsc: %d, base_tsc: %d, base_ns: %d, coeff: %v, exp: %d, got: %d",
+								src[i], baseTSC, baseNs, coeff, exp[i], act[i])
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestConvertBatchAVX512(t *testing.T) {
+
+	if !cpu.X86.HasAVX512F || !cpu.X86.HasAVX512DQ {
+		t.Skip("AVX-512 is unsupported")
+	}
+	testConvertKernel(t, convertBatchAVX512)
+}
+
+func TestConvertBatchAVX2(t *testing.T) {
+
+	if !cpu.X86.HasAVX2 {
+		t.Skip("AVX2 is unsupported")
+	}
+	testConvertKernel(t, convertBatchAVX2)
+}
+
+func TestLoadOffsetFCoeff(t *testing.T) {
+
+	if !Supported() {
+		t.Skip("tsc is unsupported")
+	}
+
+	offset, coeff := LoadOffsetCoeff(OffsetCoeffAddr)
+	offsetF, coeffF := loadOffsetFCoeff(OffsetCoeffFAddr)
+	if coeffF != coeff || offsetF != float64(offset) {
+		t.Fatalf("mismatched offset & coeff: exp: %d %v, got: %v %v", offset, coeff, offsetF, coeffF)
+	}
+}
+
+func benchConvertKernel(b *testing.B, kernel func(dst, src *int64, n int, baseTSC, baseNs int64, coeff float64)) {
+
+	src := make([]int64, 4096)
+	for i := range src {
+		src[i] = RDTSC()
+	}
+	dst := make([]int64, len(src))
+
+	b.SetBytes(int64(len(src) * 8))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		kernel(&dst[0], &src[0], len(src), src[0], 1745054585295363584, 0.2380924250227700)
+	}
+}
+
+func BenchmarkConvertBatchAVX512(b *testing.B) {
+
+	if !cpu.X86.HasAVX512F || !cpu.X86.HasAVX512DQ {
+		b.Skip("AVX-512 is unsupported")
+	}
+	benchConvertKernel(b, convertBatchAVX512)
+}
+
+func BenchmarkConvertBatchAVX2(b *testing.B) {
+
+	if !cpu.X86.HasAVX2 {
+		b.Skip("AVX2 is unsupported")
+	}
+	benchConvertKernel(b, convertBatchAVX2)
+}
+
+func BenchmarkConvertBatchGeneric(b *testing.B) {
+
+	benchConvertKernel(b, func(dst, src *int64, n int, baseTSC, baseNs int64, coeff float64) {
+		convertBatchGeneric(unsafe.Slice(dst, n), unsafe.Slice(src, n), baseTSC, baseNs, coeff)
+	})
+}
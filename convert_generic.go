@@ -0,0 +1,8 @@
+//go:build !amd64
+// +build !amd64
+
+package tsc
+
+func convertBatch(dst, src []int64, baseTSC, baseNs int64, coeff float64) {
+	convertBatchGeneric(dst, src, baseTSC, baseNs, coeff)
+}
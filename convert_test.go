@@ -0,0 +1,104 @@
+package tsc
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConvertBatch(t *testing.T) {
+
+	rand.Seed(time.Now().UnixNano())
+
+	for _, n := range []int{0, 1, 3, 4, 7, 8, 9, 31, 1024, 1031} {
+		src := make([]int64, n)
+		for i := range src {
+			src[i] = RDTSC() + rand.Int63n(1<<40)
+		}
+		dst := make([]int64, n)
+		exp := make([]int64, n)
+		// The calibration may be changed by Calibrate in background, retry if FromTSC changes.
+		for {
+			fromTSC(exp, src)
+			ConvertBatch(dst, src)
+			again := make([]int64, n)
+			fromTSC(again, src)
+			if reflect.DeepEqual(exp, again) {
+				break
+			}
+		}
+		for i := range exp {
+			if dst[i] != exp[i] {
+				t.Fatalf("mismatched FromTSC at %d/%d: exp: %d, got: %d", i, n, exp[i], dst[i])
+			}
+		}
+	}
+}
+
+func fromTSC(dst, src []int64) {
+	for i, v := range src {
+		dst[i] = FromTSC(v)
+	}
+}
+
+func TestConvertBatchWithOffsetCoeff(t *testing.T) {
+
+	offset, coeff := int64(1745054585295363584), 0.2380924250227700
+
+	src := []int64{0, 1, 4200049623, 1 << 40, 1 << 52, 1<<52 + 1, 1 << 62}
+	dst := make([]int64, len(src)+1)
+	ConvertBatchWithOffsetCoeff(dst, src, offset, coeff)
+	for i, v := range src {
+		exp := offset + int64(float64(v)*coeff)
+		if dst[i] != exp {
+			t.Fatalf("mismatched at %d: exp: %d, got: %d", i, exp, dst[i])
+		}
+	}
+	if dst[len(src)] != 0 {
+		t.Fatal("should not touch dst beyond len(src)")
+	}
+}
+
+// TestConvertBatchPrecision tests the results are precise in nanoseconds,
+// float64 Unix nanoseconds (around 1.8e18) are in 256ns.
+func TestConvertBatchPrecision(t *testing.T) {
+
+	offset := int64(1.8e18)
+	src := make([]int64, 1031)
+	for i := range src {
+		src[i] = 1<<40 + int64(i)
+	}
+	dst := make([]int64, len(src))
+	ConvertBatchWithOffsetCoeff(dst, src, offset, 1)
+	for i, v := range src {
+		if exp := offset + v; dst[i] != exp {
+			t.Fatalf("mismatched at %d: exp: %d, got: %d", i, exp, dst[i])
+		}
+	}
+}
+
+func TestConvertBatchShortDst(t *testing.T) {
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("should panic if dst is shorter than src")
+		}
+	}()
+	ConvertBatch(make([]int64, 1), make([]int64, 2))
+}
+
+func BenchmarkConvertBatch(b *testing.B) {
+
+	src := make([]int64, 4096)
+	for i := range src {
+		src[i] = RDTSC()
+	}
+	dst := make([]int64, len(src))
+
+	b.SetBytes(int64(len(src) * 8))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ConvertBatch(dst, src)
+	}
+}
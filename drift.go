@@ -0,0 +1,106 @@
+package tsc
+
+import "math"
+
+// Drift compensation adds a quadratic term to the linear model:
+// unix_nano_timestamp = base_ns + coeff * d + drift * d², d = tsc - base_tsc.
+//
+// The drift (half of the change rate of coeff) is estimated from the calibration history,
+// so the timestamp could follow the slow frequency wander (e.g., caused by temperature) between calibrations.
+var driftCompensation int64 = 0
+
+// driftHistorySize is the max number of calibrations (the last fitted ones in History) for estimating drift.
+const driftHistorySize = 8
+
+// driftPoint is a calibrated coefficient at tsc.
+type driftPoint struct {
+	tsc   int64
+	coeff float64
+}
+
+// EnableDriftCompensation makes UnixNano using the quadratic model.
+// It needs at least 3 calibrations (by Calibrate) for estimating drift,
+// before that it's as same as the linear model.
+//
+// Not threads safe.
+func EnableDriftCompensation() {
+
+	if !Supported() {
+		return
+	}
+
+	driftCompensation = 1
+	pickUnixNano()
+}
+
+// DisableDriftCompensation makes UnixNano using the linear model (default).
+//
+// Not threads safe.
+func DisableDriftCompensation() {
+
+	if !Supported() {
+		return
+	}
+
+	driftCompensation = 0
+	pickUnixNano()
+}
+
+// IsDriftCompensated returns UnixNano using the quadratic model or not.
+//
+// Not threads safe.
+func IsDriftCompensated() bool {
+	return driftCompensation == 1
+}
+
+// driftOf returns the drift estimated by p & the last fitted calibrations in History (driftHistorySize at most).
+// It must be invoked with calibrationMu held.
+func driftOf(p driftPoint) float64 {
+
+	points := make([]driftPoint, driftHistorySize)
+	i := driftHistorySize - 1
+	points[i] = p
+	for j := 0; j < history.n && i > 0; j++ {
+		r := &history.records[(history.next-1-j+2*HistorySize)%HistorySize]
+		if r.BaseTSC != 0 {
+			i--
+			points[i] = driftPoint{tsc: r.BaseTSC, coeff: r.Coeff}
+		}
+	}
+	return estimateDrift(points[i:])
+}
+
+// estimateDrift estimates the quadratic term (ns/tick²) by the change rate of coefficient:
+// if coeff = c + s * d, then ns = ∫coeff = c * d + s/2 * d².
+func estimateDrift(points []driftPoint) float64 {
+
+	if len(points) < 3 {
+		return 0
+	}
+
+	ts := make([]float64, len(points))
+	cs := make([]float64, len(points))
+	for i, p := range points {
+		ts[i] = float64(p.tsc - points[0].tsc)
+		cs[i] = p.coeff - points[0].coeff
+	}
+	slope, _ := simpleLinearRegression(ts, cs)
+	if math.IsNaN(slope) || math.IsInf(slope, 0) {
+		return 0
+	}
+	return slope / 2
+}
+
+// FromTSC converts tsc register value to Unix nanoseconds by the current calibration (linear model).
+func FromTSC(tsc int64) int64 {
+	b := loadBlock(offsetCoeffAddr())
+	return b.baseNs + int64(float64(tsc-b.baseTSC)*b.coeff)
+}
+
+// FromTSCWithDrift converts tsc register value to Unix nanoseconds by the current calibration
+// with drift compensation (quadratic model).
+func FromTSCWithDrift(tsc int64) int64 {
+	b := loadBlock(offsetCoeffAddr())
+	d := float64(tsc - b.baseTSC)
+	return b.baseNs + int64(d*b.coeff+d*d*b.drift)
+}
@@ -0,0 +1,101 @@
+package tsc
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEstimateDrift(t *testing.T) {
+
+	coeff, slope := 0.2380924250227700, 3e-22 // ~1ppm change of coeff per hour at 4.2GHz.
+	var points []driftPoint
+	for i := 0; i < driftHistorySize; i++ {
+		tsc := int64(1<<40) + int64(i)*300*4200049623
+		points = append(points, driftPoint{tsc: tsc, coeff: coeff + slope*float64(tsc-1<<40)})
+	}
+
+	if d := estimateDrift(points[:2]); d != 0 {
+		t.Fatalf("drift should be 0 with less than 3 points, got: %g", d)
+	}
+
+	act := estimateDrift(points)
+	if math.Abs(act-slope/2) > slope*1e-3 {
+		t.Fatalf("mismatched drift: exp: %g, got: %g", slope/2, act)
+	}
+}
+
+func TestDriftOf(t *testing.T) {
+
+	calibrationMu.Lock()
+	defer calibrationMu.Unlock()
+	old := history
+	defer func() { history = old }()
+	history.n, history.next = 0, 0
+
+	coeff, slope := 0.2380924250227700, 3e-22
+	at := func(i int) driftPoint {
+		tsc := int64(1<<40) + int64(i)*300*4200049623
+		return driftPoint{tsc: tsc, coeff: coeff + slope*float64(tsc-1<<40)}
+	}
+	// Only the last fitted ones are used: the early ones are far away from the line,
+	// and unfitted ones (BaseTSC is 0) are skipped.
+	for i := 0; i < HistorySize; i++ {
+		p := at(i)
+		if i < HistorySize-driftHistorySize {
+			p.coeff *= 2
+		}
+		addRecord(Record{Calibration: Calibration{Coeff: p.coeff}, BaseTSC: p.tsc})
+		addRecord(Record{Calibration: Calibration{Coeff: 1}})
+	}
+
+	act := driftOf(at(HistorySize))
+	if math.Abs(act-slope/2) > slope*1e-3 {
+		t.Fatalf("mismatched drift: exp: %g, got: %g", slope/2, act)
+	}
+
+	history.n, history.next = 0, 0
+	if d := driftOf(at(0)); d != 0 {
+		t.Fatalf("drift should be 0 without history, got: %g", d)
+	}
+}
+
+func TestDriftCompensation(t *testing.T) {
+
+	if !Supported() {
+		t.Skip("tsc is unsupported")
+	}
+
+	old := loadBlock(OffsetCoeffAddr)
+	defer func() {
+		DisableDriftCompensation()
+		storeBlock(OffsetCoeffAddr, &old)
+	}()
+
+	b := old
+	b.drift = 1e-17 // Large enough to make difference (about 3µs) out of the reading costs.
+	b.baseTSC = RDTSC() - 1<<34
+	storeBlock(OffsetCoeffAddr, &b)
+
+	EnableDriftCompensation()
+	if !IsDriftCompensated() {
+		t.Fatal("drift compensation should be enabled")
+	}
+
+	tsc := RDTSC()
+	if FromTSC(tsc) == FromTSCWithDrift(tsc) {
+		t.Fatal("quadratic term should make difference")
+	}
+
+	for i := 0; i < 1024; i++ {
+		before := FromTSCWithDrift(RDTSC())
+		ts := UnixNano()
+		ts2, _ := UnixNanoWithError()
+		after := FromTSCWithDrift(RDTSC())
+		if ts < before-1 || ts > after+1 {
+			t.Fatalf("timestamp out of range: [%d, %d], got: %d", before, after, ts)
+		}
+		if ts2 < before-1 || ts2 > after+1 {
+			t.Fatalf("timestamp with error out of range: [%d, %d], got: %d", before, after, ts2)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package tsc
+
+import (
+	"fmt"
+	"math"
+)
+
+// fitResult is the result of fitting (tsc, sys) samples.
+type fitResult struct {
+	coeff    float64
+	offset   int64
+	errBound int64   // Error bound (ns) of the fitted line in the sampling period.
+	freqErr  float64 // Relative error of the coefficient (frequency).
+	residual float64 // RMS of residuals (ns).
+	base     int64   // The center (mean tsc) of the sampling window, where coeff is measured.
+}
+
+// fit fits (tsc, sys) samples by simple linear regression with intercept:
+// sys = tsc * coeff + offset.
+//
+// Samples are centered at the first one before regression,
+// because float64 can't hold Unix nanoseconds precisely (only 256ns at present).
+//
+// window is the max gap (in tsc) between tsc & sys in sampling (see getClosestTSCSys),
+// the sys clock could be taken at any point in it.
+//
+// Error bounds are 3 sigma.
+func fit(tscs, syss []int64, window int64) fitResult {
+
+	n := len(tscs)
+	ts := make([]float64, n)
+	ws := make([]float64, n)
+	for i := range tscs {
+		ts[i] = float64(tscs[i] - tscs[0])
+		ws[i] = float64(syss[i] - syss[0])
+	}
+
+	tmean := float64(0)
+	for _, t := range ts {
+		tmean += t
+	}
+	tmean = tmean / float64(n)
+
+	coeff, intercept := simpleLinearRegression(ts, ws)
+	r := fitResult{
+		coeff:  coeff,
+		offset: syss[0] + int64(math.Round(intercept)) - int64(math.Round(float64(tscs[0])*coeff)),
+		base:   tscs[0] + int64(math.Round(tmean)),
+	}
+
+	if n <= 2 {
+		r.errBound = int64(math.Ceil(float64(window) * coeff / 2))
+		return r
+	}
+
+	sse, sxx := float64(0), float64(0)
+	for i := range ts {
+		residual := ws[i] - (ts[i]*coeff + intercept)
+		sse += residual * residual
+		sxx += (ts[i] - tmean) * (ts[i] - tmean)
+	}
+	sigma := math.Sqrt(sse / float64(n-2))
+	r.residual = math.Sqrt(sse / float64(n))
+
+	r.errBound = int64(math.Ceil(3*sigma + float64(window)*coeff/2))
+	if sxx > 0 {
+		r.freqErr = 3 * sigma / math.Sqrt(sxx) / coeff
+	}
+	return r
+}
+
+func simpleLinearRegression(tscs, syss []float64) (coeff, intercept float64) {
+
+	tmean, wmean := float64(0), float64(0)
+	for _, i := range tscs {
+		tmean += i
+	}
+	for _, i := range syss {
+		wmean += i
+	}
+	tmean = tmean / float64(len(tscs))
+	wmean = wmean / float64(len(syss))
+
+	denominator, numerator := float64(0), float64(0)
+	for i := range tscs {
+		numerator += (tscs[i] - tmean) * (syss[i] - wmean)
+		denominator += math.Pow(tscs[i]-tmean, 2)
+	}
+
+	coeff = numerator / denominator
+
+	return coeff, wmean - coeff*tmean
+}
+
+// Fit fits (tsc, sys) samples as Calibrate does, and returns the result without applying it:
+// sys = tsc * Coeff + Offset.
+//
+// window is the max gap (in tsc) between tsc & sys in sampling, it's used for ErrorBound.
+// It's for analyzing samples collected elsewhere (e.g., tools/calibrate).
+func Fit(tscs, syss []int64, window int64) (Calibration, error) {
+
+	if len(tscs) != len(syss) || len(tscs) < 2 {
+		return Calibration{}, fmt.Errorf("%w: need at least 2 (tsc, sys) pairs, got: %d tscs & %d syss",
+			ErrInvalidCalibration, len(tscs), len(syss))
+	}
+
+	r := fit(tscs, syss, window)
+	if !(r.coeff > 0) || math.IsInf(r.coeff, 0) {
+		return Calibration{}, fmt.Errorf("%w: fitted coeff: %v", ErrInvalidCalibration, r.coeff)
+	}
+	c := makeCalibration(r.offset, r.coeff, SourceCalibrate)
+	c.ErrorBound, c.FreqError = r.errBound, r.freqErr
+	return c, nil
+}
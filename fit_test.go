@@ -0,0 +1,99 @@
+package tsc
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// makeFitSamples makes samples like Calibrate does: pairs with 16ms gap,
+// the sys clock has uniform noise in [-noise, noise].
+func makeFitSamples(n int, coeff float64, offset, noise int64) (tscs, syss []int64) {
+
+	rnd := rand.New(rand.NewSource(1)) // Fixed seed for avoiding flaky test.
+
+	tscs = make([]int64, n)
+	syss = make([]int64, n)
+	tsc := int64(1 << 45)
+	for i := range tscs {
+		tsc += int64(16e6/coeff) + rnd.Int63n(1e4)
+		tscs[i] = tsc
+		syss[i] = offset + int64(math.Round(float64(tsc)*coeff)) + rnd.Int63n(2*noise+1) - noise
+	}
+	return
+}
+
+func TestFit(t *testing.T) {
+
+	coeff, offset := 0.2380924250227700, int64(1745054585295363584)
+	noise := int64(200)
+	tscs, syss := makeFitSamples(256, coeff, offset, noise)
+
+	r := fit(tscs, syss, 0)
+
+	// Drift is estimated by coefficients at the window center.
+	if mid := (tscs[0] + tscs[len(tscs)-1]) / 2; math.Abs(float64(r.base-mid)) > float64(tscs[1]-tscs[0]) {
+		t.Fatalf("base should be at the window center: exp: ~%d, got: %d", mid, r.base)
+	}
+	if math.Abs(r.coeff-coeff)/coeff > r.freqErr {
+		t.Fatalf("coeff is out of error bound: exp: %.16f, got: %.16f, freq_err: %.3g", coeff, r.coeff, r.freqErr)
+	}
+	if r.freqErr <= 0 || r.freqErr > 1e-6 {
+		t.Fatalf("unexpected freq_err: %.3g", r.freqErr)
+	}
+	// Uniform noise: sigma = noise / sqrt(3).
+	if sigma := float64(noise) / math.Sqrt(3); math.Abs(r.residual-sigma) > sigma/5 {
+		t.Fatalf("unexpected residual: %.2f, exp: %.2f", r.residual, sigma)
+	}
+	if r.errBound < noise || r.errBound > 3*noise {
+		t.Fatalf("unexpected error bound: %d, noise: %d", r.errBound, noise)
+	}
+	for _, tsc := range []int64{tscs[0], tscs[len(tscs)/2], tscs[len(tscs)-1]} {
+		exp := offset + int64(math.Round(float64(tsc)*coeff))
+		act := r.offset + int64(math.Round(float64(tsc)*r.coeff))
+		if d := act - exp; d > r.errBound || d < -r.errBound {
+			t.Fatalf("out of error bound at tsc %d: exp: %d, got: %d, bound: %d", tsc, exp, act, r.errBound)
+		}
+	}
+}
+
+func TestFitWindow(t *testing.T) {
+
+	coeff, offset := 0.5, int64(1745054585295363584)
+	tscs, syss := makeFitSamples(2, coeff, offset, 0)
+
+	r := fit(tscs, syss, 100)
+	if r.errBound != 25 && r.errBound != 26 { // Rounded up.
+		t.Fatalf("error bound should be half of window: exp: 25, got: %d", r.errBound)
+	}
+}
+
+func TestFitExported(t *testing.T) {
+
+	coeff, offset := 0.2380924250227700, int64(1745054585295363584)
+	tscs, syss := makeFitSamples(64, coeff, offset, 100)
+
+	c, err := Fit(tscs, syss, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := fit(tscs, syss, 0)
+	if c.Coeff != r.coeff || c.Offset != r.offset || c.ErrorBound != r.errBound || c.FreqError != r.freqErr {
+		t.Fatalf("mismatched fitting: calibration: %+v, fit: %+v", c, r)
+	}
+	if c.Frequency != 1e9/c.Coeff || c.Source != SourceCalibrate {
+		t.Fatalf("unexpected calibration: %+v", c)
+	}
+
+	if _, err = Fit(tscs[:1], syss[:1], 0); !errors.Is(err, ErrInvalidCalibration) {
+		t.Fatalf("should be invalid with 1 pair, but got: %v", err)
+	}
+	if _, err = Fit(tscs, syss[:2], 0); !errors.Is(err, ErrInvalidCalibration) {
+		t.Fatalf("should be invalid with mismatched length, but got: %v", err)
+	}
+	same := []int64{1, 1, 1}
+	if _, err = Fit(same, same, 0); !errors.Is(err, ErrInvalidCalibration) {
+		t.Fatalf("should be invalid with the same tsc, but got: %v", err)
+	}
+}
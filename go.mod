@@ -5,6 +5,7 @@ go 1.23.0
 require (
 	github.com/klauspost/cpuid/v2 v2.2.10
 	github.com/templexxx/cpu v0.1.1
+	golang.org/x/sys v0.32.0
 	gonum.org/v1/plot v0.16.0
 )
 
@@ -18,6 +19,5 @@ require (
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/image v0.26.0 // indirect
-	golang.org/x/sys v0.32.0 // indirect
 	golang.org/x/text v0.24.0 // indirect
 )
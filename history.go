@@ -0,0 +1,184 @@
+package tsc
+
+import (
+	"math"
+	"time"
+)
+
+// HistorySize is the max number of calibrations kept in history.
+const HistorySize = 64
+
+// Record is a calibration in history.
+type Record struct {
+	Calibration
+	// Residual is the RMS residual (ns) of fitting samples,
+	// it's 0 if the calibration isn't fitted (e.g., CalibrateWithCoeff, Apply).
+	Residual float64
+	// OffsetJump is the timestamp change (ns) applied by this calibration:
+	// new_timestamp - old_timestamp at the moment of storing.
+	// It's 0 if there was no calibration before.
+	OffsetJump int64
+	// BaseTSC is the center (mean tsc) of the sampling window where Coeff is measured,
+	// it's 0 if the calibration isn't fitted. Drift is estimated by (BaseTSC, Coeff), see EnableDriftCompensation.
+	BaseTSC int64
+}
+
+// history is a ring buffer of records, guarded by calibrationMu.
+var history struct {
+	records [HistorySize]Record
+	next    int
+	n       int
+}
+
+// addRecord adds r to history. It must be invoked with calibrationMu held.
+func addRecord(r Record) {
+	history.records[history.next] = r
+	history.next = (history.next + 1) % HistorySize
+	if history.n < HistorySize {
+		history.n++
+	}
+}
+
+// History returns the last (at most HistorySize) calibrations stored, oldest first.
+func History() []Record {
+	calibrationMu.Lock()
+	defer calibrationMu.Unlock()
+
+	rs := make([]Record, history.n)
+	start := (history.next - history.n + HistorySize) % HistorySize
+	for i := range rs {
+		rs[i] = history.records[(start+i)%HistorySize]
+	}
+	return rs
+}
+
+// lastRecord returns the last record in history.
+func lastRecord() (Record, bool) {
+	calibrationMu.Lock()
+	defer calibrationMu.Unlock()
+
+	if history.n == 0 {
+		return Record{}, false
+	}
+	return history.records[(history.next-1+HistorySize)%HistorySize], true
+}
+
+// offsetJump returns the timestamp change at nb.baseTSC if ob is replaced by nb.
+func offsetJump(ob, nb *block) int64 {
+	if !ob.isValid() {
+		return 0
+	}
+	d := float64(nb.baseTSC - ob.baseTSC)
+	old := ob.baseNs + int64(d*ob.coeff)
+	if IsDriftCompensated() {
+		old = ob.baseNs + int64(d*ob.coeff+d*d*ob.drift)
+	}
+	return nb.baseNs - old
+}
+
+// HistoryStats is the statistics of calibration history.
+type HistoryStats struct {
+	Records int           // Number of records.
+	Span    time.Duration // Time between the first & the last record.
+
+	MeanFrequency float64 // Hz.
+	// FreqStability is the standard deviation of frequency in ppm.
+	FreqStability float64
+	// FreqRange is (max - min) of frequency in ppm.
+	FreqRange float64
+
+	// MeanOffsetJump & MaxOffsetJump are the mean & max of abs(OffsetJump),
+	// which is the drift accumulated between calibrations.
+	// The first record is excluded (nothing to correct).
+	MeanOffsetJump time.Duration
+	MaxOffsetJump  time.Duration
+
+	// Allan is the Allan deviation of fractional frequency in octave intervals.
+	Allan []AllanPoint
+}
+
+// AllanPoint is the Allan deviation at averaging time Tau.
+type AllanPoint struct {
+	Tau       time.Duration
+	Deviation float64 // Fractional frequency (e.g., 1e-9 means 1ppb).
+}
+
+// StatsOf returns the statistics of records (oldest first, e.g., History()).
+//
+// Allan deviation is approximate: frequencies are taken at calibrations (not continuously),
+// and Tau is based on the mean interval of calibrations.
+// It's meaningful only if calibrations are made periodically.
+func StatsOf(records []Record) HistoryStats {
+
+	s := HistoryStats{Records: len(records)}
+	if len(records) == 0 {
+		return s
+	}
+
+	s.Span = time.Duration(records[len(records)-1].Timestamp - records[0].Timestamp)
+
+	minF, maxF := math.MaxFloat64, float64(0)
+	for _, r := range records {
+		s.MeanFrequency += r.Frequency
+		minF, maxF = min(minF, r.Frequency), max(maxF, r.Frequency)
+	}
+	s.MeanFrequency /= float64(len(records))
+	s.FreqRange = (maxF - minF) / s.MeanFrequency * 1e6
+
+	ys := make([]float64, len(records)) // Fractional frequency.
+	for i, r := range records {
+		ys[i] = (r.Frequency - s.MeanFrequency) / s.MeanFrequency
+	}
+	if len(records) > 1 {
+		sum := float64(0)
+		for _, y := range ys {
+			sum += y * y
+		}
+		s.FreqStability = math.Sqrt(sum/float64(len(ys)-1)) * 1e6
+	}
+
+	if len(records) > 1 {
+		total := int64(0)
+		for _, r := range records[1:] {
+			j := r.OffsetJump
+			if j < 0 {
+				j = -j
+			}
+			total += j
+			s.MaxOffsetJump = max(s.MaxOffsetJump, time.Duration(j))
+		}
+		s.MeanOffsetJump = time.Duration(total / int64(len(records)-1))
+
+		tau0 := s.Span / time.Duration(len(records)-1)
+		for m := 1; 2*m <= len(ys); m *= 2 {
+			s.Allan = append(s.Allan, AllanPoint{
+				Tau:       tau0 * time.Duration(m),
+				Deviation: allanDeviation(ys, m),
+			})
+		}
+	}
+	return s
+}
+
+// allanDeviation returns the (non-overlapping) Allan deviation of fractional frequency ys
+// with averaging factor m.
+func allanDeviation(ys []float64, m int) float64 {
+
+	n := len(ys) / m
+	if n < 2 {
+		return 0
+	}
+	avgs := make([]float64, n)
+	for i := range avgs {
+		for _, y := range ys[i*m : (i+1)*m] {
+			avgs[i] += y
+		}
+		avgs[i] /= float64(m)
+	}
+	sum := float64(0)
+	for i := 1; i < n; i++ {
+		d := avgs[i] - avgs[i-1]
+		sum += d * d
+	}
+	return math.Sqrt(sum / float64(2*(n-1)))
+}
@@ -0,0 +1,114 @@
+package tsc
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestHistoryRing(t *testing.T) {
+
+	calibrationMu.Lock()
+	old := history
+	history.n, history.next = 0, 0
+	calibrationMu.Unlock()
+	defer func() {
+		calibrationMu.Lock()
+		history = old
+		calibrationMu.Unlock()
+	}()
+
+	if len(History()) != 0 {
+		t.Fatal("history should be empty")
+	}
+
+	n := HistorySize + HistorySize/2
+	for i := 0; i < n; i++ {
+		calibrationMu.Lock()
+		addRecord(Record{Calibration: Calibration{Timestamp: int64(i)}})
+		calibrationMu.Unlock()
+
+		rs := History()
+		if len(rs) != min(i+1, HistorySize) {
+			t.Fatalf("mismatched history size: exp: %d, got: %d", min(i+1, HistorySize), len(rs))
+		}
+		for j, r := range rs {
+			if exp := int64(i + 1 - len(rs) + j); r.Timestamp != exp {
+				t.Fatalf("mismatched record %d: exp: %d, got: %d", j, exp, r.Timestamp)
+			}
+		}
+	}
+}
+
+func TestStatsOf(t *testing.T) {
+
+	if s := StatsOf(nil); s.Records != 0 || s.Allan != nil {
+		t.Fatalf("unexpected stats of empty history: %+v", s)
+	}
+
+	// Frequency alternates between f(1±a), offset jumps alternate ±1µs, calibrating every 5 mins.
+	f, a := 4.2e9, 1e-7
+	rs := make([]Record, 16)
+	for i := range rs {
+		rs[i].Timestamp = int64(i) * int64(5*time.Minute)
+		rs[i].Frequency = f * (1 + a)
+		rs[i].OffsetJump = 1000
+		if i%2 == 1 {
+			rs[i].Frequency = f * (1 - a)
+			rs[i].OffsetJump = -1000
+		}
+	}
+
+	s := StatsOf(rs)
+	if s.Records != len(rs) || s.Span != 75*time.Minute {
+		t.Fatalf("unexpected records & span: %d, %s", s.Records, s.Span)
+	}
+	if math.Abs(s.MeanFrequency-f) > 1e-3 {
+		t.Fatalf("mismatched mean frequency: exp: %f, got: %f", f, s.MeanFrequency)
+	}
+	if math.Abs(s.FreqRange-0.2) > 1e-6 {
+		t.Fatalf("mismatched frequency range: exp: 0.2ppm, got: %fppm", s.FreqRange)
+	}
+	if exp := 0.1 * math.Sqrt(16.0/15); math.Abs(s.FreqStability-exp) > 1e-6 {
+		t.Fatalf("mismatched frequency stability: exp: %fppm, got: %fppm", exp, s.FreqStability)
+	}
+	if s.MeanOffsetJump != time.Microsecond || s.MaxOffsetJump != time.Microsecond {
+		t.Fatalf("unexpected offset jumps: mean: %s, max: %s", s.MeanOffsetJump, s.MaxOffsetJump)
+	}
+
+	// m = 1: differences are ±2a, adev = sqrt(4a²/2); m >= 2: averages are all 0.
+	if len(s.Allan) != 4 {
+		t.Fatalf("mismatched Allan points: exp: 4, got: %d", len(s.Allan))
+	}
+	for i, p := range s.Allan {
+		exp := float64(0)
+		if i == 0 {
+			exp = math.Sqrt2 * a
+		}
+		if p.Tau != time.Duration(1<<i)*5*time.Minute || math.Abs(p.Deviation-exp) > 1e-12 {
+			t.Fatalf("unexpected Allan point %d: %+v, exp deviation: %g", i, p, exp)
+		}
+	}
+}
+
+func TestHistoryCalibrate(t *testing.T) {
+
+	if !Supported() {
+		t.Skip("tsc is unsupported")
+	}
+
+	defer restoreCalibration(t, Current())
+
+	CalibrateWithCoeff(Current().Coeff)
+	rs := History()
+	if len(rs) < 2 {
+		t.Fatalf("history should have at least 2 records (init & now), got: %d", len(rs))
+	}
+	r := rs[len(rs)-1]
+	if r.Calibration != Current() || r.Residual != 0 {
+		t.Fatalf("mismatched last record: %+v, current: %+v", r, Current())
+	}
+	if time.Duration(math.Abs(float64(r.OffsetJump))) > 100*time.Microsecond {
+		t.Fatalf("offset jump is too big: %d", r.OffsetJump)
+	}
+}
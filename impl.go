@@ -0,0 +1,20 @@
+package tsc
+
+// Implementation is an implementation of UnixNano.
+type Implementation struct {
+	Name string
+	Func func() int64
+}
+
+// Implementations returns all UnixNano implementations which could be picked on this machine,
+// (including the vDSO clock if it's enabled), it's for benchmarks & diagnostics (see tools/clockbench).
+//
+// They all read the current calibration, but only the picked one (UnixNano) is the best.
+func Implementations() []Implementation {
+
+	impls := implementations()
+	if IsVDSO() {
+		impls = append(impls, Implementation{Name: "vdsoUnixNano", Func: vdsoUnixNano})
+	}
+	return impls
+}
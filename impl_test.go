@@ -0,0 +1,32 @@
+package tsc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestImplementations(t *testing.T) {
+
+	impls := Implementations()
+	if !Supported() && !IsVDSO() {
+		if len(impls) != 0 {
+			t.Fatalf("should have no implementation, but got: %d", len(impls))
+		}
+		t.Skip("tsc is unsupported")
+	}
+	if len(impls) == 0 {
+		t.Fatal("should have implementations")
+	}
+
+	names := make(map[string]bool)
+	for _, impl := range impls {
+		if names[impl.Name] {
+			t.Fatalf("duplicated implementation: %s", impl.Name)
+		}
+		names[impl.Name] = true
+
+		if d := impl.Func() - time.Now().UnixNano(); d > int64(time.Millisecond) || d < -int64(time.Millisecond) {
+			t.Fatalf("%s is too far from system clock: %s", impl.Name, time.Duration(d))
+		}
+	}
+}
@@ -0,0 +1,7 @@
+// Package affinity pins goroutines to CPUs & finds CPU topology, it's for tools measuring per-CPU tsc.
+package affinity
+
+import "errors"
+
+// ErrUnsupported means setting CPU affinity isn't supported on this platform.
+var ErrUnsupported = errors.New("affinity: unsupported")
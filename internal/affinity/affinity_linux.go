@@ -0,0 +1,59 @@
+package affinity
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// CPUs returns the CPUs which the process is allowed to run on.
+func CPUs() ([]int, error) {
+
+	var set unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &set); err != nil {
+		return nil, err
+	}
+	var cpus []int
+	for i := 0; i < len(set)*64; i++ {
+		if set.IsSet(i) {
+			cpus = append(cpus, i)
+		}
+	}
+	return cpus, nil
+}
+
+// Pin locks the calling goroutine to its OS thread, and pins the thread to cpu.
+//
+// The goroutine should never unlock the thread, it'll be terminated when the goroutine exits,
+// so the affinity won't leak to other goroutines.
+func Pin(cpu int) error {
+
+	runtime.LockOSThread()
+
+	var set unix.CPUSet
+	set.Set(cpu)
+	return unix.SchedSetaffinity(0, &set)
+}
+
+// Topology returns the physical core ID (in the socket) & the socket ID of cpu.
+func Topology(cpu int) (core, socket int, err error) {
+
+	read := func(name string) (int, error) {
+		d, err := os.ReadFile(fmt.Sprintf("/sys/devices/system/cpu/cpu%d/topology/%s", cpu, name))
+		if err != nil {
+			return 0, err
+		}
+		return strconv.Atoi(strings.TrimSpace(string(d)))
+	}
+	if core, err = read("core_id"); err != nil {
+		return 0, 0, err
+	}
+	if socket, err = read("physical_package_id"); err != nil {
+		return 0, 0, err
+	}
+	return core, socket, nil
+}
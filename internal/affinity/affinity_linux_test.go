@@ -0,0 +1,69 @@
+package affinity
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestPin(t *testing.T) {
+
+	cpus, err := CPUs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cpus) == 0 {
+		t.Fatal("no CPU")
+	}
+
+	cpu := cpus[len(cpus)-1]
+	errs := make(chan error, 1)
+	go func() {
+		if err := Pin(cpu); err != nil {
+			errs <- err
+			return
+		}
+		var set unix.CPUSet
+		if err := unix.SchedGetaffinity(0, &set); err != nil {
+			errs <- err
+			return
+		}
+		if set.Count() != 1 || !set.IsSet(cpu) {
+			t.Errorf("should be pinned to cpu %d", cpu)
+		}
+		errs <- nil
+	}()
+	if err = <-errs; err != nil {
+		t.Fatal(err)
+	}
+
+	// The test goroutine isn't pinned.
+	after, err := CPUs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(cpus) {
+		t.Fatalf("affinity leaked: exp: %v, got: %v", cpus, after)
+	}
+}
+
+func TestTopology(t *testing.T) {
+
+	cpus, err := CPUs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cpu := range cpus {
+		core, socket, err := Topology(cpu)
+		if err != nil {
+			t.Skipf("no topology in sysfs: %v", err)
+		}
+		if core < 0 || socket < 0 {
+			t.Fatalf("cpu %d: invalid core %d or socket %d", cpu, core, socket)
+		}
+	}
+
+	if _, _, err = Topology(1 << 20); err == nil {
+		t.Fatal("should fail for nonexistent cpu")
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package affinity
+
+// CPUs returns the CPUs which the process is allowed to run on.
+func CPUs() ([]int, error) {
+	return nil, ErrUnsupported
+}
+
+// Pin locks the calling goroutine to its OS thread, and pins the thread to cpu.
+func Pin(cpu int) error {
+	return ErrUnsupported
+}
+
+// Topology returns the physical core ID (in the socket) & the socket ID of cpu.
+func Topology(cpu int) (core, socket int, err error) {
+	return 0, 0, ErrUnsupported
+}
@@ -0,0 +1,146 @@
+// Package capture reads & writes capture files of (tsc, sys) samples,
+// which are recorded by tools (-record) and replayed (-replay) for offline analysis.
+//
+// A capture file is JSON lines: the first line is Header, the others are Samples.
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/templexxx/tsc"
+)
+
+// Version is the version of capture format.
+const Version = 1
+
+// ErrInvalidCapture means the capture file can't be parsed.
+var ErrInvalidCapture = errors.New("capture: invalid capture file")
+
+// Header is the first line of a capture file.
+type Header struct {
+	Version int               `json:"version"`
+	Tool    string            `json:"tool"`
+	CPU     string            `json:"cpu"`
+	Start   int64             `json:"start"` // Unix nanoseconds.
+	Options map[string]string `json:"options"`
+	// Calibration is the calibration at the start.
+	Calibration tsc.Calibration `json:"calibration"`
+	// Topology is the location of CPUs which samples are taken on (if any Sample.CPU).
+	Topology []CPUTopology `json:"topology,omitempty"`
+}
+
+// CPUTopology is the physical core & socket of a CPU.
+type CPUTopology struct {
+	CPU    int `json:"cpu"`
+	Core   int `json:"core"` // Core ID in the socket.
+	Socket int `json:"socket"`
+}
+
+// Sample is a (tsc, sys) pair:
+// sys is the system clock, tsc is the tsc register value at the same time.
+type Sample struct {
+	Thread   int   `json:"thread"`
+	Round    int   `json:"round"`
+	TSC      int64 `json:"tsc"`
+	Sys      int64 `json:"sys"`
+	MinDelta int64 `json:"min_delta,omitempty"` // Gap (in tsc) between tsc & sys in sampling.
+	// CPU is the CPU ID (by RDTSCP) which the sample is taken on, nil if unknown.
+	CPU *int `json:"cpu,omitempty"`
+	// Calibration is the new calibration applied at TSC if not nil (e.g., periodic calibrating in longdrift),
+	// it's an event but not a sample.
+	Calibration *tsc.Calibration `json:"calibration,omitempty"`
+}
+
+// Writer writes a capture file, it's thread safe.
+type Writer struct {
+	mu  sync.Mutex
+	f   *os.File
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+// Create creates the capture file and writes h (Version is filled).
+func Create(path string, h Header) (*Writer, error) {
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &Writer{f: f, w: bufio.NewWriter(f)}
+	w.enc = json.NewEncoder(w.w)
+
+	h.Version = Version
+	if err = w.enc.Encode(h); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write writes a sample.
+func (w *Writer) Write(s Sample) error {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.enc.Encode(s)
+}
+
+// Close flushes and closes the file.
+func (w *Writer) Close() error {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.w.Flush(); err != nil {
+		_ = w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+// Read reads a capture file.
+func Read(r io.Reader) (Header, []Sample, error) {
+
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var h Header
+	if err := dec.Decode(&h); err != nil {
+		return Header{}, nil, fmt.Errorf("%w: header: %s", ErrInvalidCapture, err.Error())
+	}
+	if h.Version != Version {
+		return Header{}, nil, fmt.Errorf("%w: unknown version: %d", ErrInvalidCapture, h.Version)
+	}
+
+	var samples []Sample
+	for {
+		var s Sample
+		err := dec.Decode(&s)
+		if err == io.EOF {
+			return h, samples, nil
+		}
+		if err != nil {
+			return Header{}, nil, fmt.Errorf("%w: sample %d: %s", ErrInvalidCapture, len(samples), err.Error())
+		}
+		samples = append(samples, s)
+	}
+}
+
+// ReadFile reads the capture file in path.
+func ReadFile(path string) (Header, []Sample, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return Header{}, nil, err
+	}
+	defer f.Close()
+
+	return Read(bufio.NewReader(f))
+}
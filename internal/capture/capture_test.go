@@ -0,0 +1,105 @@
+package capture
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/templexxx/tsc"
+)
+
+func TestWriteRead(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+
+	c := tsc.Calibration{Coeff: 0.25, Offset: 1745054585295363584, Frequency: 4e9, Source: tsc.SourceCalibrate}
+	h := Header{Tool: "test", CPU: "06_CFH_2", Start: 1745054585295363584, Options: map[string]string{"sample": "2"}, Calibration: c,
+		Topology: []CPUTopology{{CPU: 0}, {CPU: 3, Core: 1, Socket: 1}}}
+	w, err := Create(path, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpu := 3
+	samples := []Sample{
+		{Round: 0, TSC: 100, Sys: 125, MinDelta: 20, CPU: &cpu},
+		{Thread: 1, Round: 0, TSC: 200, Sys: 150},
+		{Round: 1, TSC: 300, Calibration: &c},
+	}
+	for _, s := range samples {
+		if err = w.Write(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	act, actSamples, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if act.Version != Version || act.Tool != h.Tool || act.CPU != h.CPU || act.Start != h.Start ||
+		act.Options["sample"] != "2" || act.Calibration != c || len(act.Topology) != 2 || act.Topology[1] != h.Topology[1] {
+		t.Fatalf("mismatched header: exp: %+v, got: %+v", h, act)
+	}
+	if len(actSamples) != len(samples) {
+		t.Fatalf("mismatched samples count: exp: %d, got: %d", len(samples), len(actSamples))
+	}
+	for i, s := range samples {
+		a := actSamples[i]
+		if a.Thread != s.Thread || a.Round != s.Round || a.TSC != s.TSC || a.Sys != s.Sys || a.MinDelta != s.MinDelta ||
+			(a.Calibration == nil) != (s.Calibration == nil) || (a.Calibration != nil && *a.Calibration != *s.Calibration) ||
+			(a.CPU == nil) != (s.CPU == nil) || (a.CPU != nil && *a.CPU != *s.CPU) {
+			t.Fatalf("mismatched sample %d: exp: %+v, got: %+v", i, s, a)
+		}
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+
+	for _, s := range []string{
+		"",
+		`{"version":2}`,
+		`{"version":1}` + "\n" + `{"tsc":"x"}`,
+		`{"version":1}` + "\n" + `{"unknown":1}`,
+	} {
+		if _, _, err := Read(strings.NewReader(s)); !errors.Is(err, ErrInvalidCapture) {
+			t.Fatalf("should be invalid: %q, but got: %v", s, err)
+		}
+	}
+}
+
+// TestReplayFit replays a capture recorded by tools/calibrate (-record) through tsc.Fit.
+func TestReplayFit(t *testing.T) {
+
+	h, samples, err := ReadFile(filepath.Join("testdata", "calibrate-06_CFH_2.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Tool != "calibrate" || len(samples) != 64 {
+		t.Fatalf("unexpected capture: tool: %s, samples: %d", h.Tool, len(samples))
+	}
+
+	tscs := make([]int64, len(samples))
+	syss := make([]int64, len(samples))
+	window := int64(0)
+	for i, s := range samples {
+		tscs[i], syss[i] = s.TSC, s.Sys
+		window = max(window, s.MinDelta)
+	}
+	c, err := tsc.Fit(tscs, syss, window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Recorded calibration is made by tsc.Calibrate on the same machine.
+	if ppm := math.Abs(c.Frequency-h.Calibration.Frequency) / h.Calibration.Frequency * 1e6; ppm > 1 {
+		t.Fatalf("frequency mismatched: exp: %.3f, got: %.3f (%.3fppm)", h.Calibration.Frequency, c.Frequency, ppm)
+	}
+	for i := range tscs {
+		if d := c.UnixNano(tscs[i]) - syss[i]; d > c.ErrorBound+1 || d < -c.ErrorBound-1 { // 1ns: rounding in UnixNano.
+			t.Fatalf("sample %d is out of error bound: delta: %d, bound: %d", i, d, c.ErrorBound)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package tsc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// SourceKalman means the calibration is made by Kalman filter (see RunKalman).
+const SourceKalman = "kalman"
+
+// KalmanConfig is the config of Kalman filter.
+//
+// The clock model has three states:
+// phase (ns), frequency (ns/s, i.e., ppb) & frequency drift (ns/s²).
+// Noises are the spectral densities of white noise driving each state.
+type KalmanConfig struct {
+	// Interval is the sampling interval in RunKalman.
+	Interval time.Duration
+	// MeasurementNoise is the standard deviation (ns) of a single (tsc, sys) sample.
+	MeasurementNoise float64
+	PhaseNoise       float64 // ns²/s
+	FreqNoise        float64 // ns²/s³
+	DriftNoise       float64 // ns²/s⁵
+	// StepThreshold is the max innovation (ns) could be accepted,
+	// bigger one means the wall clock has been stepped and the filter will be reset.
+	StepThreshold float64
+}
+
+// DefaultKalmanConfig is good for most cases,
+// it could follow frequency wander caused by temperature (ppm per hours).
+var DefaultKalmanConfig = KalmanConfig{
+	Interval:         10 * time.Second,
+	MeasurementNoise: 50,
+	PhaseNoise:       1,
+	FreqNoise:        1e-2,
+	DriftNoise:       1e-6,
+	StepThreshold:    float64(time.Millisecond),
+}
+
+// Validate checks c is valid or not.
+func (c KalmanConfig) Validate() error {
+
+	if c.Interval <= 0 {
+		return fmt.Errorf("%w: interval must be > 0: %s", ErrInvalidConfig, c.Interval)
+	}
+	if !(c.MeasurementNoise > 0) || math.IsInf(c.MeasurementNoise, 0) {
+		return fmt.Errorf("%w: measurement noise must be > 0: %v", ErrInvalidConfig, c.MeasurementNoise)
+	}
+	for _, n := range []float64{c.PhaseNoise, c.FreqNoise, c.DriftNoise} {
+		if !(n >= 0) || math.IsInf(n, 0) {
+			return fmt.Errorf("%w: process noise must be >= 0: %v", ErrInvalidConfig, n)
+		}
+	}
+	if !(c.StepThreshold > 0) {
+		return fmt.Errorf("%w: step threshold must be > 0: %v", ErrInvalidConfig, c.StepThreshold)
+	}
+	return nil
+}
+
+// Kalman is a Kalman filter which disciplines tsc clock continuously by single samples,
+// instead of periodic batch regression.
+//
+// It's not thread safe.
+type Kalman struct {
+	cfg    KalmanConfig
+	coeff0 float64 // Nominal coefficient.
+
+	started   bool
+	anchorTSC int64 // tsc of the last sample.
+	anchorNs  int64 // Wall clock at anchorTSC without phase.
+
+	x [3]float64    // phase, freq & drift.
+	p [3][3]float64 // Covariance of x.
+}
+
+// NewKalman creates a Kalman filter with the nominal coefficient (e.g., made by Calibrate).
+// cfg must be valid (see KalmanConfig.Validate).
+func NewKalman(coeff float64, cfg KalmanConfig) *Kalman {
+	return &Kalman{cfg: cfg, coeff0: coeff}
+}
+
+// reset resets filter at the sample.
+func (k *Kalman) reset(tsc, sys int64) {
+	r := k.cfg.MeasurementNoise * k.cfg.MeasurementNoise
+	k.started = true
+	k.anchorTSC = tsc
+	k.anchorNs = sys
+	k.x = [3]float64{}
+	k.p = [3][3]float64{
+		{r, 0, 0},
+		{0, 1e6, 0}, // 1ppm.
+		{0, 0, 1},
+	}
+}
+
+// seconds returns nominal seconds from anchor to tsc.
+func (k *Kalman) seconds(tsc int64) float64 {
+	return float64(tsc-k.anchorTSC) * k.coeff0 / 1e9
+}
+
+// Update feeds a (tsc, sys) sample to the filter.
+// Samples must be in order.
+func (k *Kalman) Update(tsc, sys int64) {
+
+	if !k.started {
+		k.reset(tsc, sys)
+		return
+	}
+
+	dt := k.seconds(tsc)
+	nominal := int64(math.Round(dt * 1e9))
+
+	// Predict.
+	f := [3][3]float64{
+		{1, dt, dt * dt / 2},
+		{0, 1, dt},
+		{0, 0, 1},
+	}
+	x := [3]float64{
+		k.x[0] + k.x[1]*dt + k.x[2]*dt*dt/2,
+		k.x[1] + k.x[2]*dt,
+		k.x[2],
+	}
+	p := mat3Mul(mat3Mul(f, k.p), mat3Transpose(f))
+	q := k.processNoise(dt)
+	for i := range p {
+		for j := range p[i] {
+			p[i][j] += q[i][j]
+		}
+	}
+
+	// Update with measurement of phase.
+	innov := float64(sys-k.anchorNs-nominal) - x[0]
+	if math.Abs(innov) > k.cfg.StepThreshold {
+		k.reset(tsc, sys)
+		return
+	}
+	s := p[0][0] + k.cfg.MeasurementNoise*k.cfg.MeasurementNoise
+	var gain [3]float64
+	for i := range gain {
+		gain[i] = p[i][0] / s
+	}
+	for i := range x {
+		x[i] += gain[i] * innov
+	}
+	var np [3][3]float64
+	for i := range np {
+		for j := range np[i] {
+			np[i][j] = p[i][j] - gain[i]*p[0][j]
+		}
+	}
+
+	// Move anchor to this sample.
+	k.anchorTSC = tsc
+	k.anchorNs += nominal
+	k.x = x
+	k.p = np
+}
+
+// processNoise returns Q of the three-state clock model in dt seconds.
+func (k *Kalman) processNoise(dt float64) [3][3]float64 {
+	q1, q2, q3 := k.cfg.PhaseNoise, k.cfg.FreqNoise, k.cfg.DriftNoise
+	dt2 := dt * dt
+	dt3 := dt2 * dt
+	dt4 := dt3 * dt
+	dt5 := dt4 * dt
+	return [3][3]float64{
+		{q1*dt + q2*dt3/3 + q3*dt5/20, q2*dt2/2 + q3*dt4/8, q3 * dt3 / 6},
+		{q2*dt2/2 + q3*dt4/8, q2*dt + q3*dt3/3, q3 * dt2 / 2},
+		{q3 * dt3 / 6, q3 * dt2 / 2, q3 * dt},
+	}
+}
+
+// Predict predicts wall clock at tsc by the linear model at present.
+func (k *Kalman) Predict(tsc int64) int64 {
+	offset, coeff := k.OffsetCoeff()
+	return offset + int64(math.Round(float64(tsc)*coeff))
+}
+
+// OffsetCoeff returns offset & coefficient at the last sample.
+func (k *Kalman) OffsetCoeff() (offset int64, coeff float64) {
+	coeff = k.coeff0 * (1 + k.x[1]/1e9)
+	base := k.anchorNs + int64(math.Round(k.x[0]))
+	return base - int64(math.Round(float64(k.anchorTSC)*coeff)), coeff
+}
+
+// Frequency returns tsc frequency (Hz) & its drift (Hz/s) at the last sample.
+func (k *Kalman) Frequency() (freq, drift float64) {
+	_, coeff := k.OffsetCoeff()
+	freq = 1e9 / coeff
+	return freq, -freq * k.x[2] / 1e9
+}
+
+// Calibration returns the Calibration at the last sample.
+func (k *Kalman) Calibration() Calibration {
+	offset, coeff := k.OffsetCoeff()
+	c := makeCalibration(offset, coeff, SourceKalman)
+	c.ErrorBound = int64(math.Ceil(3 * math.Sqrt(k.p[0][0])))
+	c.FreqError = 3 * math.Sqrt(k.p[1][1]) / 1e9
+	// Phase drift is drift/2 * t², t = d * coeff / 1e9 seconds.
+	c.Drift = k.x[2] * coeff * coeff / 2e18
+	return c
+}
+
+// kalmanMaxSlew is the max rate (relative to the frequency) of slewing in RunKalman, 500ppm as NTP.
+const kalmanMaxSlew = 500e-6
+
+// RunKalman disciplines tsc clock by Kalman filter until ctx is done:
+// takes a single sample every cfg.Interval, and publishes the result smoothly.
+//
+// The published clock doesn't step to a new estimate, it slews (see slewCalibration) to meet the estimate
+// at the next sample instead, so UnixNano is continuous & monotonic between samples.
+// It steps only if the estimate is cfg.StepThreshold away (the wall clock has been stepped).
+//
+// It's an alternative of running Calibrate periodically.
+// It returns ErrInvalidConfig if cfg is invalid.
+func RunKalman(ctx context.Context, cfg KalmanConfig) error {
+
+	if !Supported() {
+		return ErrUnsupported
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	k := NewKalman(Current().Coeff, cfg)
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		_, tsc, sys := getClosestTSCSys(getClosestTSCSysRetries)
+		k.Update(tsc, sys)
+		storeCalibration(slewCalibration(Current(), k.Calibration(), tsc, cfg.Interval, cfg.StepThreshold))
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// slewCalibration returns the calibration which goes on from prev at tsc (no step),
+// and meets the estimate c after d with the slew rate limited by kalmanMaxSlew.
+// The phase error which can't be absorbed in d is left to the next slewing.
+//
+// It returns c if prev is invalid or c is more than threshold (ns) away from prev at tsc.
+func slewCalibration(prev, c Calibration, tsc int64, d time.Duration, threshold float64) Calibration {
+
+	if !(prev.Coeff > 0) {
+		return c
+	}
+	ns := prev.UnixNano(tsc)
+	e := float64(c.UnixNano(tsc) - ns)
+	if math.Abs(e) > threshold {
+		return c
+	}
+
+	ticks := float64(d) / c.Coeff
+	rate := e / ticks
+	limit := c.Coeff * kalmanMaxSlew
+	rate = math.Max(-limit, math.Min(limit, rate))
+
+	s := c
+	s.Coeff = c.Coeff + rate
+	s.Frequency = 1e9 / s.Coeff
+	s.Offset = ns - int64(math.Round(float64(tsc)*s.Coeff))
+	s.ErrorBound += int64(math.Ceil(math.Abs(e))) // Not absorbed yet.
+	return s
+}
+
+func mat3Mul(a, b [3][3]float64) (c [3][3]float64) {
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				c[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return
+}
+
+func mat3Transpose(a [3][3]float64) (t [3][3]float64) {
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			t[i][j] = a[j][i]
+		}
+	}
+	return
+}
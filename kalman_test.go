@@ -0,0 +1,207 @@
+package tsc
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// clockTrace is a synthetic trace of tsc & wall clock.
+type clockTrace struct {
+	tscs  []int64   // tsc at each sample.
+	walls []int64   // True wall clock at each sample.
+	syss  []int64   // Sampled wall clock (with measurement noise).
+	freqs []float64 // True tsc frequency at each sample.
+}
+
+// makeClockTrace makes a trace of tsc running at freq0 with temperature-induced frequency wander:
+// a daily-like sine (amplitude in ppb, period) plus random walk,
+// sampled every interval with gaussian noise (ns).
+func makeClockTrace(freq0, amplitude float64, period, duration, interval time.Duration, noise float64) clockTrace {
+
+	rnd := rand.New(rand.NewSource(1))
+
+	const step = 100 * time.Millisecond
+	var tr clockTrace
+	tsc := float64(1 << 40)
+	wall := int64(1745054585295363584)
+	walk := float64(0)
+	every := int(interval / step)
+	for i := 0; time.Duration(i)*step <= duration; i++ {
+		t := float64(time.Duration(i)*step) / float64(time.Second)
+		y := amplitude*math.Sin(2*math.Pi*t/period.Seconds()) + walk // ppb
+		freq := freq0 * (1 + y/1e9)
+		if i%every == 0 {
+			tr.tscs = append(tr.tscs, int64(tsc))
+			tr.walls = append(tr.walls, wall)
+			tr.syss = append(tr.syss, wall+int64(rnd.NormFloat64()*noise))
+			tr.freqs = append(tr.freqs, freq)
+		}
+		tsc += freq * step.Seconds()
+		wall += int64(step)
+		walk += rnd.NormFloat64() * 0.01
+	}
+	return tr
+}
+
+func TestKalmanSimulation(t *testing.T) {
+
+	freq0 := 3e9
+	tr := makeClockTrace(freq0, 500, time.Hour, 6*time.Hour, 10*time.Second, 50)
+
+	// Nominal coefficient is 1ppm away from the truth.
+	k := NewKalman(1e9/(freq0*(1+1e-6)), DefaultKalmanConfig)
+	static := NewKalman(1e9/freq0, DefaultKalmanConfig)
+	static.Update(tr.tscs[0], tr.walls[0])
+
+	warmup := 60 // 10 minutes.
+	maxErr, maxStaticErr, maxFreqErr := float64(0), float64(0), float64(0)
+	for i := range tr.tscs {
+		if i > warmup {
+			maxErr = math.Max(maxErr, math.Abs(float64(k.Predict(tr.tscs[i])-tr.walls[i])))
+			maxStaticErr = math.Max(maxStaticErr, math.Abs(float64(static.Predict(tr.tscs[i])-tr.walls[i])))
+		}
+		k.Update(tr.tscs[i], tr.syss[i])
+		if i > warmup {
+			freq, _ := k.Frequency()
+			maxFreqErr = math.Max(maxFreqErr, math.Abs(freq-tr.freqs[i])/tr.freqs[i]*1e9)
+		}
+	}
+
+	t.Logf("max prediction error: kalman: %.2fns, static: %.2fns; max frequency error: %.2fppb",
+		maxErr, maxStaticErr, maxFreqErr)
+
+	if maxErr > 1000 {
+		t.Fatalf("kalman prediction error is too big: %.2fns", maxErr)
+	}
+	if maxStaticErr < 100*maxErr {
+		t.Fatalf("static model should be much worse with frequency wander: %.2fns", maxStaticErr)
+	}
+	if maxFreqErr > 20 {
+		t.Fatalf("kalman frequency error is too big: %.2fppb", maxFreqErr)
+	}
+
+	c := k.Calibration()
+	if c.Source != SourceKalman || c.ErrorBound <= 0 || c.FreqError <= 0 {
+		t.Fatalf("unexpected calibration: %+v", c)
+	}
+}
+
+func TestKalmanStep(t *testing.T) {
+
+	freq0 := 3e9
+	tr := makeClockTrace(freq0, 0, time.Hour, 10*time.Minute, 10*time.Second, 50)
+
+	k := NewKalman(1e9/freq0, DefaultKalmanConfig)
+	for i := range tr.tscs {
+		sys := tr.syss[i]
+		if i >= len(tr.tscs)/2 {
+			sys -= int64(time.Second) // Leap second or NTP step.
+		}
+		k.Update(tr.tscs[i], sys)
+	}
+	last := len(tr.tscs) - 1
+	if d := k.Predict(tr.tscs[last]) - (tr.walls[last] - int64(time.Second)); d > 1000 || d < -1000 {
+		t.Fatalf("should follow the stepped clock: delta: %dns", d)
+	}
+}
+
+func TestKalmanConfigValidate(t *testing.T) {
+
+	if err := DefaultKalmanConfig.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, fn := range []func(c *KalmanConfig){
+		func(c *KalmanConfig) { c.Interval = 0 },
+		func(c *KalmanConfig) { c.Interval = -time.Second },
+		func(c *KalmanConfig) { c.MeasurementNoise = 0 },
+		func(c *KalmanConfig) { c.PhaseNoise = -1 },
+		func(c *KalmanConfig) { c.FreqNoise = math.NaN() },
+		func(c *KalmanConfig) { c.DriftNoise = math.Inf(1) },
+		func(c *KalmanConfig) { c.StepThreshold = 0 },
+	} {
+		cfg := DefaultKalmanConfig
+		fn(&cfg)
+		if err := cfg.Validate(); !errors.Is(err, ErrInvalidConfig) {
+			t.Fatalf("should be invalid: %+v, got: %v", cfg, err)
+		}
+		if Supported() {
+			if err := RunKalman(context.Background(), cfg); !errors.Is(err, ErrInvalidConfig) {
+				t.Fatalf("RunKalman should return invalid config: %+v, got: %v", cfg, err)
+			}
+		}
+	}
+}
+
+// TestKalmanSlew publishes the trace through slewCalibration as RunKalman,
+// the published clock must be continuous at every sample and follow the truth.
+func TestKalmanSlew(t *testing.T) {
+
+	freq0 := 3e9
+	cfg := DefaultKalmanConfig
+	tr := makeClockTrace(freq0, 500, time.Hour, 2*time.Hour, cfg.Interval, 50)
+
+	k := NewKalman(1e9/freq0, cfg)
+	var pub Calibration
+	warmup, maxErr := 60, float64(0)
+	for i := range tr.tscs {
+		tsc := tr.tscs[i]
+		if i > warmup {
+			maxErr = math.Max(maxErr, math.Abs(float64(pub.UnixNano(tsc)-tr.walls[i])))
+		}
+		k.Update(tsc, tr.syss[i])
+		next := slewCalibration(pub, k.Calibration(), tsc, cfg.Interval, cfg.StepThreshold)
+		if i > 0 {
+			if d := next.UnixNano(tsc) - pub.UnixNano(tsc); d > 1 || d < -1 {
+				t.Fatalf("published clock steps %dns at sample %d", d, i)
+			}
+			if r := math.Abs(next.Coeff/k.Calibration().Coeff - 1); r > kalmanMaxSlew*(1+1e-9) {
+				t.Fatalf("slew rate is too big: %v", r)
+			}
+		}
+		pub = next
+	}
+	t.Logf("max published error: %.2fns", maxErr)
+	if maxErr > 1000 {
+		t.Fatalf("published clock is too far away from the truth: %.2fns", maxErr)
+	}
+}
+
+func TestSlewCalibration(t *testing.T) {
+
+	coeff, tsc := 1/3.0, int64(1<<40)
+	prev := Calibration{Coeff: coeff, Offset: 1745054585295363584}
+	d := 10 * time.Second
+	ns := prev.UnixNano(tsc)
+
+	// Behind 100µs: it's within 500ppm * 10s = 5ms, so it's absorbed in d.
+	c := prev
+	c.Offset += 100000
+	s := slewCalibration(prev, c, tsc, d, float64(time.Millisecond))
+	if s.UnixNano(tsc) != ns {
+		t.Fatal("should be continuous")
+	}
+	end := tsc + int64(float64(d)/coeff)
+	if delta := s.UnixNano(end) - c.UnixNano(end); delta > 1 || delta < -1 {
+		t.Fatalf("should meet the estimate after d, delta: %d", delta)
+	}
+
+	// Ahead 10ms (but within threshold): it's limited by the max slew rate, and it's still monotonic.
+	c = prev
+	c.Offset -= 10 * int64(time.Millisecond)
+	s = slewCalibration(prev, c, tsc, d, float64(time.Second))
+	if s.Coeff <= 0 || math.Abs(s.Coeff/coeff-1-(-kalmanMaxSlew)) > 1e-9 {
+		t.Fatalf("should slew at the max rate: %v", s.Coeff/coeff-1)
+	}
+
+	// Stepped.
+	if s = slewCalibration(prev, c, tsc, d, float64(time.Millisecond)); s != c {
+		t.Fatal("should step if it's out of threshold")
+	}
+	if s = slewCalibration(Calibration{}, c, tsc, d, float64(time.Millisecond)); s != c {
+		t.Fatal("should step without previous calibration")
+	}
+}
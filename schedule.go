@@ -0,0 +1,132 @@
+package tsc
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ScheduleConfig is the config of adaptive calibration interval.
+type ScheduleConfig struct {
+	MinInterval time.Duration
+	MaxInterval time.Duration
+	// MaxDrift is the target max offset correction (abs(Record.OffsetJump)) at each calibration,
+	// which is the drift accumulated in the interval.
+	MaxDrift time.Duration
+}
+
+// DefaultScheduleConfig keeps drift within 1µs, calibrating every [1min, 1h].
+var DefaultScheduleConfig = ScheduleConfig{
+	MinInterval: time.Minute,
+	MaxInterval: time.Hour,
+	MaxDrift:    time.Microsecond,
+}
+
+// Validate checks c is valid or not: 0 < MinInterval <= MaxInterval, and MaxDrift > 0.
+func (c ScheduleConfig) Validate() error {
+
+	if c.MinInterval <= 0 {
+		return fmt.Errorf("%w: min interval must be > 0: %s", ErrInvalidConfig, c.MinInterval)
+	}
+	if c.MaxInterval < c.MinInterval {
+		return fmt.Errorf("%w: max interval %s < min interval %s", ErrInvalidConfig, c.MaxInterval, c.MinInterval)
+	}
+	if c.MaxDrift <= 0 {
+		return fmt.Errorf("%w: max drift must be > 0: %s", ErrInvalidConfig, c.MaxDrift)
+	}
+	return nil
+}
+
+const (
+	scheduleGrowth = 2   // Max growth of interval in one step.
+	scheduleShrink = 4   // Max shrink of interval in one step.
+	scheduleMargin = 0.8 // Aims at margin * MaxDrift when shrinking.
+)
+
+// Scheduler adapts calibration interval by offset corrections:
+// the drift grows (roughly) linearly with interval because of the frequency error,
+// so the interval is scaled by MaxDrift / correction.
+//
+// The interval is lengthened (at most doubled) only if two consecutive corrections are within MaxDrift,
+// and shortened once a correction is out of MaxDrift.
+//
+// It's not thread safe.
+type Scheduler struct {
+	cfg      ScheduleConfig
+	interval time.Duration
+	agreed   bool // Last correction is within MaxDrift.
+}
+
+// NewScheduler creates a Scheduler starting with cfg.MinInterval.
+// cfg must be valid (see ScheduleConfig.Validate).
+func NewScheduler(cfg ScheduleConfig) *Scheduler {
+	return &Scheduler{cfg: cfg, interval: cfg.MinInterval}
+}
+
+// Interval returns the current interval.
+func (s *Scheduler) Interval() time.Duration {
+	return s.interval
+}
+
+// Next updates interval by the offset correction (ns) made after the current interval,
+// and returns the new one.
+func (s *Scheduler) Next(correction int64) time.Duration {
+
+	if correction < 0 {
+		correction = -correction
+	}
+	drift := time.Duration(correction)
+
+	next := s.interval
+	if drift > s.cfg.MaxDrift {
+		next = time.Duration(float64(s.interval) * float64(s.cfg.MaxDrift) * scheduleMargin / float64(drift))
+		next = max(next, s.interval/scheduleShrink)
+		s.agreed = false
+	} else {
+		if s.agreed {
+			next = s.interval * scheduleGrowth
+			if drift > 0 {
+				next = min(next, time.Duration(float64(s.interval)*float64(s.cfg.MaxDrift)/float64(drift)))
+			}
+		}
+		s.agreed = true
+	}
+
+	s.interval = min(max(next, s.cfg.MinInterval), s.cfg.MaxInterval)
+	return s.interval
+}
+
+// RunCalibration runs Calibrate with adaptive interval (see Scheduler) until ctx is done.
+// It's an alternative to calling Calibrate by a ticker.
+// It returns ErrInvalidConfig if cfg is invalid.
+func RunCalibration(ctx context.Context, cfg ScheduleConfig) error {
+
+	if !Supported() {
+		return ErrUnsupported
+	}
+	if isSubscribed() {
+		return ErrShmReadOnly
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	s := NewScheduler(cfg)
+
+	timer := time.NewTimer(s.Interval())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		Calibrate()
+		if r, ok := lastRecord(); ok {
+			s.Next(r.OffsetJump)
+		}
+		timer.Reset(s.Interval())
+	}
+}
@@ -0,0 +1,108 @@
+package tsc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+
+	cfg := DefaultScheduleConfig
+	s := NewScheduler(cfg)
+	if s.Interval() != cfg.MinInterval {
+		t.Fatalf("should start with min interval, got: %s", s.Interval())
+	}
+
+	// Constant frequency error: correction = interval * freqErr.
+	run := func(freqErr float64, steps int) (maxDrift time.Duration) {
+		for i := 0; i < steps; i++ {
+			drift := time.Duration(float64(s.Interval()) * freqErr)
+			maxDrift = max(maxDrift, drift)
+			s.Next(int64(drift))
+		}
+		return
+	}
+
+	run(0, 32)
+	if s.Interval() != cfg.MaxInterval {
+		t.Fatalf("should reach max interval without drift, got: %s", s.Interval())
+	}
+
+	// 1ppb: 1µs in 1000s.
+	run(1e-9, 32)
+	if iv := s.Interval(); iv < 500*time.Second || iv > 1000*time.Second {
+		t.Fatalf("interval should be close to (but not beyond) 1000s, got: %s", iv)
+	}
+	if d := run(1e-9, 32); d > cfg.MaxDrift {
+		t.Fatalf("drift should be within %s after converging, got: %s", cfg.MaxDrift, d)
+	}
+
+	// Frequency changes: 10ppb, shrinking quickly.
+	run(1e-8, 2)
+	if iv := s.Interval(); iv > 100*time.Second {
+		t.Fatalf("interval should be shortened to 100s, got: %s", iv)
+	}
+
+	run(1e-3, 8)
+	if s.Interval() != cfg.MinInterval {
+		t.Fatalf("should be clamped by min interval, got: %s", s.Interval())
+	}
+}
+
+func TestSchedulerNegativeCorrection(t *testing.T) {
+
+	s := NewScheduler(DefaultScheduleConfig)
+	s.Next(int64(10 * time.Microsecond))
+	a := s.Interval()
+	s = NewScheduler(DefaultScheduleConfig)
+	s.Next(-int64(10 * time.Microsecond))
+	if s.Interval() != a {
+		t.Fatalf("correction should be in abs: exp: %s, got: %s", a, s.Interval())
+	}
+}
+
+func TestRunCalibration(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := RunCalibration(ctx, DefaultScheduleConfig)
+	if !Supported() {
+		if !errors.Is(err, ErrUnsupported) {
+			t.Fatalf("should be unsupported, got: %v", err)
+		}
+		return
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("should be canceled, got: %v", err)
+	}
+}
+
+func TestScheduleConfigValidate(t *testing.T) {
+
+	if err := DefaultScheduleConfig.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, cfg := range []ScheduleConfig{
+		{MinInterval: 0, MaxInterval: time.Hour, MaxDrift: time.Microsecond},
+		{MinInterval: -time.Minute, MaxInterval: time.Hour, MaxDrift: time.Microsecond},
+		{MinInterval: time.Hour, MaxInterval: time.Minute, MaxDrift: time.Microsecond}, // Inverted.
+		{MinInterval: time.Minute, MaxInterval: time.Hour, MaxDrift: 0},
+	} {
+		if err := cfg.Validate(); !errors.Is(err, ErrInvalidConfig) {
+			t.Fatalf("should be invalid: %+v, got: %v", cfg, err)
+		}
+		if Supported() {
+			if err := RunCalibration(context.Background(), cfg); !errors.Is(err, ErrInvalidConfig) {
+				t.Fatalf("RunCalibration should return invalid config: %+v, got: %v", cfg, err)
+			}
+		}
+	}
+	// Fixed interval.
+	cfg := ScheduleConfig{MinInterval: time.Minute, MaxInterval: time.Minute, MaxDrift: time.Microsecond}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
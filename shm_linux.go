@@ -0,0 +1,350 @@
+package tsc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// DefaultShmPath is the default path of the shared calibration page.
+const DefaultShmPath = "/dev/shm/tsc-calibration"
+
+// SourceShm means the calibration is loaded from the shared calibration page.
+const SourceShm = "shm"
+
+var (
+	ErrShmBusy     = errors.New("tsc: shared calibration page has been published by another publisher")
+	ErrShmInvalid  = errors.New("tsc: invalid shared calibration page")
+	ErrShmNotReady = errors.New("tsc: shared calibration page hasn't been published")
+	ErrShmReadOnly = errors.New("tsc: calibration is read-only after subscribing")
+)
+
+// Layout of the shared calibration page (version 2):
+//
+// [0, 8)     magic
+// [8, 12)    version
+// [64, 72)   seq: seqlock of the metadata, odd means writing
+// [72, 168)  metadata: coeff, offset, frequency, timestamp, cpu_signature([64]byte)
+// [256, 384) calibration block, see block
+//
+// The block is 128 Bytes aligned (the page is page aligned),
+// so readers could use it as OffsetCoeffAddr directly.
+// It's protected by its own seqlock.
+const (
+	shmMagic   uint64 = 0x6d68732e63737421 // "!tsc.shm"
+	shmVersion uint32 = 2
+	shmSize           = 4096
+
+	shmSeqOff        = 64
+	shmCoeffOff      = 72
+	shmOffsetOff     = 80
+	shmFrequencyOff  = 88
+	shmTimestampOff  = 96
+	shmSignatureOff  = 104
+	shmSignatureSize = 64
+	shmBlockOff      = 256
+)
+
+type shmPage struct {
+	f        *os.File
+	data     []byte
+	stuckSeq uint64 // The odd seq of metadata which readers have given up on, see blockMaxRetries.
+}
+
+var (
+	shmPublisher  *shmPage // Guarded by calibrationMu.
+	shmSubscriber *shmPage // Set once by Subscribe.
+)
+
+// Publisher publishes calibrations to the shared calibration page.
+type Publisher struct {
+	page *shmPage
+}
+
+// Publish creates (or reuses) the shared calibration page at path,
+// and publishes the current calibration & all the calibrations after it,
+// until the Publisher is closed.
+//
+// There could be only one Publisher on a path (it's protected by flock).
+// It repairs the page if the last publisher died in publishing.
+// Calibrate should be invoked in the publisher process periodically as usual.
+func Publish(path string) (*Publisher, error) {
+
+	if !Supported() {
+		return nil, ErrUnsupported
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrShmBusy
+		}
+		return nil, err
+	}
+	if err = f.Truncate(shmSize); err != nil {
+		f.Close()
+		return nil, err
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, shmSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	page := &shmPage{f: f, data: data}
+	if page.loadUint64(0) != shmMagic || page.loadUint32(8) != shmVersion {
+		atomic.StoreUint64(page.uint64At(shmSeqOff), 0)
+		atomic.StoreUint32(page.uint32At(8), shmVersion)
+		atomic.StoreUint64(page.uint64At(0), shmMagic)
+	}
+	for _, off := range []int{shmSeqOff, shmBlockOff} { // The last publisher died in publishing (metadata or block).
+		if page.loadUint64(off)&1 == 1 {
+			atomic.AddUint64(page.uint64At(off), 1)
+		}
+	}
+
+	calibrationMu.Lock()
+	defer calibrationMu.Unlock()
+
+	if shmSubscriber != nil {
+		page.close()
+		return nil, ErrShmReadOnly
+	}
+	if shmPublisher != nil {
+		page.close()
+		return nil, ErrShmBusy
+	}
+	shmPublisher = page
+	if calibration.Coeff > 0 {
+		b := loadBlock(offsetCoeffAddr())
+		page.publish(calibration, &b)
+	}
+	return &Publisher{page: page}, nil
+}
+
+// Close stops publishing. The page is still there for readers.
+func (p *Publisher) Close() error {
+
+	calibrationMu.Lock()
+	defer calibrationMu.Unlock()
+
+	if shmPublisher != p.page {
+		return nil
+	}
+	shmPublisher = nil
+	return p.page.close()
+}
+
+// Subscribe maps the shared calibration page at path read-only,
+// and converts tsc to timestamp by the calibration in it.
+//
+// After subscribing, OffsetCoeffAddr points to the page,
+// Calibrate & CalibrateWithCoeff do nothing, and Apply returns ErrShmReadOnly.
+//
+// It can't be undone. OffsetCoeffAddr is swapped atomically,
+// so readers running meanwhile get either the old calibration or the shared one.
+func Subscribe(path string) error {
+
+	if !Supported() {
+		return ErrUnsupported
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if fi.Size() < shmSize {
+		f.Close()
+		return ErrShmInvalid
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, shmSize, syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	page := &shmPage{f: f, data: data}
+	if page.loadUint64(0) != shmMagic {
+		page.close()
+		return ErrShmInvalid
+	}
+	if v := page.loadUint32(8); v != shmVersion {
+		page.close()
+		return fmt.Errorf("%w: unknown version: %d", ErrShmInvalid, v)
+	}
+	c, ok := page.load()
+	if !ok || !(c.Coeff > 0) {
+		page.close()
+		return ErrShmNotReady
+	}
+	if c.CPUSignature != cpuSignature() {
+		page.close()
+		return fmt.Errorf("%w: exp: %s, got: %s", ErrCPUMismatch, cpuSignature(), c.CPUSignature)
+	}
+
+	calibrationMu.Lock()
+	defer calibrationMu.Unlock()
+
+	if shmPublisher != nil || shmSubscriber != nil {
+		page.close()
+		return ErrShmBusy
+	}
+	shmSubscriber = page
+	storeOffsetCoeffAddr(&data[shmBlockOff])
+	return nil
+}
+
+// shmState is the Publisher & the subscription in using.
+type shmState struct {
+	publisher, subscriber *shmPage
+}
+
+func currentShm() shmState {
+	return shmState{publisher: shmPublisher, subscriber: shmSubscriber}
+}
+
+// attachShm makes s in using, UnixNano reads the local calibration block if there is no subscription.
+// It must be invoked with calibrationMu held.
+func attachShm(s shmState) {
+
+	shmPublisher, shmSubscriber = s.publisher, s.subscriber
+	if s.subscriber != nil {
+		storeOffsetCoeffAddr(&s.subscriber.data[shmBlockOff])
+		return
+	}
+	storeOffsetCoeffAddr(&OffsetCoeff[0])
+}
+
+// shmPublish publishes c if there is a Publisher.
+// It must be invoked with calibrationMu held.
+func shmPublish(c Calibration, b *block) {
+	if shmPublisher != nil {
+		shmPublisher.publish(c, b)
+	}
+}
+
+// shmLoad loads calibration from the subscribed page,
+// it returns false if there is no subscription or the publisher died in publishing.
+func shmLoad() (Calibration, bool) {
+	if shmSubscriber == nil {
+		return Calibration{}, false
+	}
+	return shmSubscriber.load()
+}
+
+func isSubscribed() bool {
+	return shmSubscriber != nil
+}
+
+func (p *shmPage) publish(c Calibration, b *block) {
+
+	seq := p.uint64At(shmSeqOff)
+	atomic.AddUint64(seq, 1)
+
+	atomic.StoreUint64(p.uint64At(shmCoeffOff), math.Float64bits(c.Coeff))
+	atomic.StoreUint64(p.uint64At(shmOffsetOff), uint64(c.Offset))
+	atomic.StoreUint64(p.uint64At(shmFrequencyOff), math.Float64bits(c.Frequency))
+	atomic.StoreUint64(p.uint64At(shmTimestampOff), uint64(c.Timestamp))
+	p.storeString(shmSignatureOff, shmSignatureSize, c.CPUSignature)
+
+	storeBlock(&p.data[shmBlockOff], b)
+
+	atomic.AddUint64(seq, 1)
+}
+
+// load loads metadata with retrying on a torn read (at most blockMaxRetries times),
+// it returns false if the publisher died in publishing.
+func (p *shmPage) load() (Calibration, bool) {
+
+	seq := p.uint64At(shmSeqOff)
+	for i := 0; i < blockMaxRetries; i++ {
+		s0 := atomic.LoadUint64(seq)
+		if s0&1 == 1 {
+			if s0 == atomic.LoadUint64(&p.stuckSeq) {
+				return Calibration{}, false
+			}
+			runtime.Gosched()
+			continue
+		}
+
+		c := Calibration{Source: SourceShm}
+		c.Coeff = math.Float64frombits(atomic.LoadUint64(p.uint64At(shmCoeffOff)))
+		c.Offset = int64(atomic.LoadUint64(p.uint64At(shmOffsetOff)))
+		c.Frequency = math.Float64frombits(atomic.LoadUint64(p.uint64At(shmFrequencyOff)))
+		c.Timestamp = int64(atomic.LoadUint64(p.uint64At(shmTimestampOff)))
+		c.CPUSignature = p.loadString(shmSignatureOff, shmSignatureSize)
+
+		if atomic.LoadUint64(seq) == s0 {
+			b, ok := tryLoadBlock(&p.data[shmBlockOff])
+			if !ok {
+				return Calibration{}, false
+			}
+			c.ErrorBound, c.FreqError, c.Drift = b.errBound, b.freqErr, b.drift
+			return c, true
+		}
+	}
+	if s := atomic.LoadUint64(seq); s&1 == 1 {
+		atomic.StoreUint64(&p.stuckSeq, s)
+	}
+	return Calibration{}, false
+}
+
+// storeString stores s (truncated to size) as uint64 words atomically.
+func (p *shmPage) storeString(off, size int, s string) {
+	b := make([]byte, size)
+	copy(b, s)
+	for i := 0; i < size; i += 8 {
+		atomic.StoreUint64(p.uint64At(off+i), *(*uint64)(unsafe.Pointer(&b[i])))
+	}
+}
+
+func (p *shmPage) loadString(off, size int) string {
+	b := make([]byte, size)
+	for i := 0; i < size; i += 8 {
+		*(*uint64)(unsafe.Pointer(&b[i])) = atomic.LoadUint64(p.uint64At(off + i))
+	}
+	for i, v := range b {
+		if v == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+func (p *shmPage) uint64At(off int) *uint64 {
+	return (*uint64)(unsafe.Pointer(&p.data[off]))
+}
+
+func (p *shmPage) uint32At(off int) *uint32 {
+	return (*uint32)(unsafe.Pointer(&p.data[off]))
+}
+
+func (p *shmPage) loadUint64(off int) uint64 {
+	return atomic.LoadUint64(p.uint64At(off))
+}
+
+func (p *shmPage) loadUint32(off int) uint32 {
+	return atomic.LoadUint32(p.uint32At(off))
+}
+
+func (p *shmPage) close() error {
+	err := syscall.Munmap(p.data)
+	if err2 := p.f.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
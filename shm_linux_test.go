@@ -0,0 +1,333 @@
+package tsc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPublish(t *testing.T) {
+
+	if !Supported() {
+		t.Skip("tsc is unsupported")
+	}
+
+	path := filepath.Join(t.TempDir(), "tsc-calibration")
+	p, err := Publish(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if _, err = Publish(path); !errors.Is(err, ErrShmBusy) {
+		t.Fatalf("should be busy, but got: %v", err)
+	}
+
+	c, _ := p.page.load()
+	exp := Current()
+	exp.Source = SourceShm
+	if c.ErrorBound >= exp.ErrorBound { // It's the error bound when it's published.
+		exp.ErrorBound = c.ErrorBound
+	}
+	if c != exp {
+		t.Fatalf("mismatched calibration: exp: %+v, got: %+v", exp, c)
+	}
+
+	CalibrateWithCoeff(exp.Coeff)
+	c, _ = p.page.load()
+	if c.Timestamp == exp.Timestamp || c.Offset != Current().Offset {
+		t.Fatalf("calibration should be published: %+v", c)
+	}
+	offset, coeff := LoadOffsetCoeff(&p.page.data[shmBlockOff])
+	if offset != c.Offset || coeff != c.Coeff {
+		t.Fatalf("mismatched block: exp: %d %v, got: %d %v", c.Offset, c.Coeff, offset, coeff)
+	}
+}
+
+// TestShmPageTornRead publishes & loads concurrently,
+// every loaded calibration must be the one published.
+func TestShmPageTornRead(t *testing.T) {
+
+	if !Supported() {
+		t.Skip("tsc is unsupported")
+	}
+
+	path := filepath.Join(t.TempDir(), "tsc-calibration")
+	p, err := Publish(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	publish := func(i int) {
+		coeff := float64(i)
+		b := newBlock(int64(i), coeff, 0)
+		p.page.publish(Calibration{Coeff: coeff, Offset: int64(i), Frequency: 1e9 / coeff,
+			Timestamp: int64(i), CPUSignature: strconv.Itoa(i)}, &b)
+	}
+	publish(1)
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	defer wg.Wait()
+	defer close(done)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 2; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			publish(i)
+		}
+	}()
+
+	for i := 0; i < 100000; i++ {
+		c, _ := p.page.load()
+		n := int64(c.Coeff)
+		if c.Offset != n || c.Timestamp != n || c.Frequency != 1e9/c.Coeff || c.CPUSignature != strconv.Itoa(int(n)) {
+			t.Fatalf("torn read: %+v", c)
+		}
+	}
+}
+
+const shmTestPathEnv = "TSC_SHM_TEST_PATH"
+
+// TestSubscribe subscribes the page in another process (Subscribe can't be undone).
+func TestSubscribe(t *testing.T) {
+
+	if path := os.Getenv(shmTestPathEnv); path != "" {
+		testSubscriber(t, path)
+		return
+	}
+
+	if !Supported() {
+		t.Skip("tsc is unsupported")
+	}
+
+	path := filepath.Join(t.TempDir(), "tsc-calibration")
+	p, err := Publish(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Stop publishing before subscribing, calibrations running in background (e.g., by other tests)
+	// mustn't change the page.
+	c, _ := p.page.load()
+	exp := c.Coeff
+	if err = p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSubscribe$", "-test.v")
+	cmd.Env = append(os.Environ(),
+		shmTestPathEnv+"="+path,
+		"TSC_SHM_TEST_COEFF="+strconv.FormatFloat(exp, 'g', -1, 64))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("subscriber failed: %v\n%s", err, out)
+	}
+}
+
+func testSubscriber(t *testing.T, path string) {
+
+	exp, _ := strconv.ParseFloat(os.Getenv("TSC_SHM_TEST_COEFF"), 64)
+
+	// Readers running while subscribing get either calibration.
+	stop, readerErr := make(chan struct{}), make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				readerErr <- nil
+				return
+			default:
+			}
+			delta := UnixNano() - time.Now().UnixNano()
+			if math.Abs(float64(delta)) > float64(100*time.Microsecond) {
+				readerErr <- fmt.Errorf("delta too big while subscribing: %d", delta)
+				return
+			}
+		}
+	}()
+	err := Subscribe(path)
+	close(stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = <-readerErr; err != nil {
+		t.Fatal(err)
+	}
+	if OffsetCoeffFAddr != OffsetCoeffAddr {
+		t.Fatal("OffsetCoeffFAddr should point to the shared page too")
+	}
+	c := Current()
+	if c.Source != SourceShm || c.Coeff != exp {
+		t.Fatalf("unexpected calibration: %+v, exp coeff: %v", c, exp)
+	}
+	if err := Apply(c); !errors.Is(err, ErrShmReadOnly) {
+		t.Fatalf("should be read-only, but got: %v", err)
+	}
+	Calibrate() // Must not write the read-only page.
+
+	_, coeff := LoadOffsetCoeff(OffsetCoeffAddr)
+	if coeff != exp {
+		t.Fatalf("mismatched coeff: exp: %v, got: %v", exp, coeff)
+	}
+	delta := UnixNano() - time.Now().UnixNano()
+	if math.Abs(float64(delta)) > float64(100*time.Microsecond) {
+		t.Fatalf("delta too big: %d", delta)
+	}
+}
+
+func TestSubscribeInvalid(t *testing.T) {
+
+	if !Supported() {
+		t.Skip("tsc is unsupported")
+	}
+
+	path := filepath.Join(t.TempDir(), "tsc-calibration")
+	if err := os.WriteFile(path, make([]byte, shmSize), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Subscribe(path); !errors.Is(err, ErrShmInvalid) {
+		t.Fatalf("should be invalid, but got: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("short"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Subscribe(path); !errors.Is(err, ErrShmInvalid) {
+		t.Fatalf("should be invalid, but got: %v", err)
+	}
+}
+
+func TestShmPageDeadPublisher(t *testing.T) {
+
+	if !Supported() {
+		t.Skip("tsc is unsupported")
+	}
+
+	path := filepath.Join(t.TempDir(), "tsc-calibration")
+	p, err := Publish(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	atomic.AddUint64(p.page.uint64At(shmSeqOff), 1) // Died in publishing.
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		if _, ok := p.page.load(); ok {
+			t.Fatal("should give up on a dead publisher")
+		}
+		if cost := time.Since(start); i == 1 && cost > time.Millisecond {
+			t.Fatalf("should give up at once on a stuck seq, but cost: %s", cost)
+		}
+	}
+
+	// The next publisher repairs it.
+	if err = p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	p2, err := Publish(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p2.Close()
+	if c, ok := p2.page.load(); !ok || !(c.Coeff > 0) {
+		t.Fatalf("should be repaired: %+v", c)
+	}
+}
+
+// TestShmBlockDeadPublisher tests the calibration block left odd by a dead publisher is repaired by the next one.
+func TestShmBlockDeadPublisher(t *testing.T) {
+
+	if !Supported() {
+		t.Skip("tsc is unsupported")
+	}
+	defer atomic.StoreUint64(&stuckSeq, 0)
+
+	path := filepath.Join(t.TempDir(), "tsc-calibration")
+	p, err := Publish(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	atomic.AddUint64(p.page.uint64At(shmBlockOff), 1) // Died in storeBlock.
+	if _, ok := tryLoadBlock(&p.page.data[shmBlockOff]); ok {
+		t.Fatal("should give up on a dead publisher")
+	}
+	if err = p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	p2, err := Publish(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p2.Close()
+	CalibrateWithCoeff(Current().Coeff)
+
+	b, ok := tryLoadBlock(&p2.page.data[shmBlockOff])
+	if !ok || b.seq&1 == 1 || !b.isValid() {
+		t.Fatalf("should be repaired: %+v (%t)", b, ok)
+	}
+}
+
+// TestSetSourceShm tests SetSource detaches the Publisher & the subscription, and restore brings them back.
+func TestSetSourceShm(t *testing.T) {
+
+	if !Supported() {
+		t.Skip("tsc is unsupported")
+	}
+
+	p, err := Publish(filepath.Join(t.TempDir(), "tsc-calibration"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	published, _ := p.page.load()
+	restore := SetSource(simulatedSource())
+	if currentShm() != (shmState{}) {
+		t.Fatal("publisher should be detached")
+	}
+	Calibrate()
+	if c, _ := p.page.load(); c != published {
+		t.Fatalf("simulated calibration shouldn't be published: %+v", c)
+	}
+	restore()
+	if currentShm() != (shmState{publisher: p.page}) {
+		t.Fatal("publisher should be restored")
+	}
+
+	// As a subscriber of the page.
+	calibrationMu.Lock()
+	attachShm(shmState{subscriber: p.page})
+	calibrationMu.Unlock()
+	defer func() {
+		calibrationMu.Lock()
+		attachShm(shmState{publisher: p.page})
+		calibrationMu.Unlock()
+	}()
+
+	restore = SetSource(simulatedSource())
+	if isSubscribed() || offsetCoeffAddr() != &OffsetCoeff[0] || OffsetCoeffFAddr != &OffsetCoeff[0] {
+		t.Fatal("subscription should be detached")
+	}
+	if c := Current(); c.Source != SourceCalibrate || c.Timestamp >= 1.75e18 {
+		t.Fatalf("should be calibrated by the simulated source: %+v", c)
+	}
+	restore()
+	if !isSubscribed() || offsetCoeffAddr() != &p.page.data[shmBlockOff] || OffsetCoeffFAddr != offsetCoeffAddr() {
+		t.Fatal("subscription should be restored")
+	}
+}
@@ -0,0 +1,55 @@
+//go:build !linux
+// +build !linux
+
+package tsc
+
+import "errors"
+
+// DefaultShmPath is the default path of the shared calibration page.
+const DefaultShmPath = ""
+
+// SourceShm means the calibration is loaded from the shared calibration page.
+const SourceShm = "shm"
+
+var (
+	ErrShmBusy     = errors.New("tsc: shared calibration page has been published by another publisher")
+	ErrShmInvalid  = errors.New("tsc: invalid shared calibration page")
+	ErrShmNotReady = errors.New("tsc: shared calibration page hasn't been published")
+	ErrShmReadOnly = errors.New("tsc: calibration is read-only after subscribing")
+)
+
+// Publisher publishes calibrations to the shared calibration page.
+//
+// Only Linux is supported.
+type Publisher struct{}
+
+// Publish returns ErrUnsupported on non-Linux.
+func Publish(path string) (*Publisher, error) {
+	return nil, ErrUnsupported
+}
+
+// Close does nothing on non-Linux.
+func (p *Publisher) Close() error {
+	return nil
+}
+
+// Subscribe returns ErrUnsupported on non-Linux.
+func Subscribe(path string) error {
+	return ErrUnsupported
+}
+
+type shmState struct{}
+
+func currentShm() shmState { return shmState{} }
+
+func attachShm(s shmState) {}
+
+func shmPublish(c Calibration, b *block) {}
+
+func shmLoad() (Calibration, bool) {
+	return Calibration{}, false
+}
+
+func isSubscribed() bool {
+	return false
+}
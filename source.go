@@ -0,0 +1,128 @@
+package tsc
+
+import "time"
+
+// Source is the tsc register & the system clock which the package-level functions are built on.
+// It could be replaced by a simulated one for testing, see SetSource & package tsctest.
+type Source struct {
+	TSC   func() int64        // Reads the tsc register.
+	Sys   func() int64        // Reads the system clock (Unix nanoseconds).
+	Sleep func(time.Duration) // Sleeps between calibration samples, nil means time.Sleep.
+}
+
+// The source in using, they are replaced by SetSource.
+// Hot paths (e.g., sampling in calibration, UnixNanoWithError) call RDTSC & sysClock directly
+// unless simulated is true, calls by function values are slower.
+var (
+	rdtsc     = RDTSC
+	wallClock = sysClock
+	sleep     = time.Sleep
+	simulated = false
+)
+
+// sourceUnixNano is UnixNano with the simulated source.
+func sourceUnixNano() int64 {
+
+	if IsDriftCompensated() {
+		return FromTSCWithDrift(rdtsc())
+	}
+	return FromTSC(rdtsc())
+}
+
+// sourceState is the state which is changed by SetSource (and calibrations with the simulated source).
+type sourceState struct {
+	rdtsc, wallClock func() int64
+	sleep            func(time.Duration)
+	simulated        bool
+
+	unixNano                                      func() int64
+	supported, allowOutOfOrder, driftCompensation int64
+	vdso                                          *vdsoClock
+	taiClock                                      *ReferenceClock
+	tai                                           block
+
+	block       block // The local one (OffsetCoeff), it isn't in using after Subscribe.
+	calibration Calibration
+	history     [HistorySize]Record // Drift is estimated from it too, see driftOf.
+	historyNext int
+	historyN    int
+	kernel      kernelClockState
+	shm         shmState
+}
+
+func saveSourceState() *sourceState {
+
+	s := &sourceState{
+		rdtsc: rdtsc, wallClock: wallClock, sleep: sleep, simulated: simulated,
+		unixNano: UnixNano, supported: supported, allowOutOfOrder: allowOutOfOrder, driftCompensation: driftCompensation,
+		vdso: vdso, taiClock: taiClock.Load(),
+	}
+
+	taiMu.Lock()
+	s.tai = loadBlock(taiAddr)
+	taiMu.Unlock()
+
+	calibrationMu.Lock()
+	s.block = loadBlock(&OffsetCoeff[0])
+	s.calibration = calibration
+	s.history, s.historyNext, s.historyN = history.records, history.next, history.n
+	s.kernel = kernelState
+	s.shm = currentShm()
+	calibrationMu.Unlock()
+	return s
+}
+
+func (s *sourceState) restore() {
+
+	rdtsc, wallClock, sleep, simulated = s.rdtsc, s.wallClock, s.sleep, s.simulated
+	UnixNano, supported, allowOutOfOrder, driftCompensation = s.unixNano, s.supported, s.allowOutOfOrder, s.driftCompensation
+	vdso = s.vdso
+	taiClock.Store(s.taiClock)
+	storeTAIBlock(&s.tai)
+
+	calibrationMu.Lock()
+	storeBlock(&OffsetCoeff[0], &s.block)
+	calibration = s.calibration
+	history.records, history.next, history.n = s.history, s.historyNext, s.historyN
+	kernelState = s.kernel
+	attachShm(s.shm)
+	calibrationMu.Unlock()
+}
+
+// SetSource makes the package-level functions (UnixNano, UnixNanoWithError, Calibrate, Current, History, ...)
+// using src instead of the tsc register & the system clock, and calibrates with it from scratch
+// (calibration history & the kernel clock state are cleared).
+// The vDSO mode (see EnableVDSO), TAINano & the shared calibration (see Publish & Subscribe) are detached.
+//
+// The returned restore function restores the source & the calibration state (calibration, history,
+// TAI, shared calibration, ...) before SetSource.
+//
+// It's for testing only (see package tsctest): UnixNano is much slower, and it's not thread safe.
+// Publish & Subscribe mustn't be called before restoring.
+func SetSource(src Source) (restore func()) {
+
+	s := saveSourceState()
+
+	rdtsc, wallClock = src.TSC, src.Sys
+	sleep = time.Sleep
+	if src.Sleep != nil {
+		sleep = src.Sleep
+	}
+	simulated = true
+	supported = 1
+	vdso = nil
+	taiClock.Store(nil)
+	storeTAIBlock(&block{})
+
+	calibrationMu.Lock()
+	attachShm(shmState{})
+	storeBlock(&OffsetCoeff[0], &block{})
+	calibration = Calibration{}
+	history.records, history.next, history.n = [HistorySize]Record{}, 0, 0
+	kernelState = kernelClockState{}
+	calibrationMu.Unlock()
+
+	Calibrate()
+	pickUnixNano()
+	return s.restore
+}
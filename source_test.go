@@ -0,0 +1,58 @@
+package tsc
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// simulatedSource returns a Source of a 3GHz tsc driven by a manual clock,
+// every reading takes 20ns and sleeping is instant.
+func simulatedSource() Source {
+
+	var ns atomic.Int64
+	ns.Store(1.7e18)
+	read := func() int64 { return ns.Add(20) }
+	return Source{
+		TSC:   func() int64 { return (read() - 1.7e18) * 3 },
+		Sys:   read,
+		Sleep: func(d time.Duration) { ns.Add(int64(d)) },
+	}
+}
+
+// TestSetSourceState tests SetSource detaches the kernel clock state & TAI, and restore brings them back.
+func TestSetSourceState(t *testing.T) {
+
+	if !Supported() {
+		t.Skip("tsc is unsupported")
+	}
+	defer resetTAI()
+	defer setKernelState(false, 0)
+
+	setKernelState(true, 5000)
+	calibrateTAI(func() int64 { return sysClock() + 37*int64(time.Second) })
+	tai := loadBlock(taiAddr)
+
+	restore := SetSource(simulatedSource())
+	if !Synchronized() || kernelState != (kernelClockState{}) {
+		t.Fatal("kernel clock state should be cleared")
+	}
+	if TAINano() != 0 {
+		t.Fatal("TAI should be detached")
+	}
+	if _, errNs := UnixNanoWithError(); errNs >= 5000 {
+		t.Fatalf("kernel max error shouldn't be in error bound: %d", errNs)
+	}
+	Calibrate()
+	restore()
+
+	if Synchronized() || kernelState != (kernelClockState{unsync: true, maxErr: 5000}) {
+		t.Fatalf("kernel clock state should be restored: %+v", kernelState)
+	}
+	if taiClock.Load() == nil {
+		t.Fatal("TAI clock should be restored")
+	}
+	if b := loadBlock(taiAddr); b.seq <= tai.seq || b.offset != tai.offset || b.coeff != tai.coeff || b.baseTSC != tai.baseTSC {
+		t.Fatalf("TAI block should be restored: exp: %+v, got: %+v", tai, b)
+	}
+}
@@ -0,0 +1,119 @@
+package tsc
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/templexxx/cpu"
+	"github.com/templexxx/tsc/internal/xbytes"
+)
+
+// ErrTAIOffsetUnknown means the kernel doesn't know the TAI offset (it's set by NTP/chrony),
+// CLOCK_TAI is as same as CLOCK_REALTIME then.
+var ErrTAIOffsetUnknown = errors.New("tsc: TAI offset is unknown")
+
+var (
+	// taiBlock is the calibration block of TAINano (see block for the layout).
+	taiBlock = xbytes.MakeAlignedBlock(cpu.X86FalseSharingRange, cpu.X86FalseSharingRange)
+	taiAddr  = &taiBlock[0]
+	taiMu    sync.Mutex // Serializes writers of taiBlock.
+
+	// taiClock is the reference clock of TAINano, nil means TAI hasn't been calibrated.
+	taiClock atomic.Pointer[ReferenceClock]
+)
+
+// TAINano returns International Atomic Time in nanoseconds since CLOCK_TAI's epoch
+// (1970-01-01 00:00:00 TAI), it's UnixNano + TAI offset (37s at present).
+//
+// Leap seconds:
+// The kernel steps CLOCK_REALTIME back by 1s (or NTP smears it) at a leap second,
+// and increases the TAI offset at the same moment, so CLOCK_TAI is continuous.
+// UnixNano keeps running linearly over the leap second until the next calibration,
+// which moves it back by 1s (a second is repeated, see Record.OffsetJump).
+// TAINano is calibrated against CLOCK_TAI, it has no jump.
+//
+// It returns 0 before CalibrateTAI succeeded.
+// If TSC is unsupported, it reads CLOCK_TAI directly.
+func TAINano() int64 {
+
+	if Supported() {
+		b := loadBlock(taiAddr)
+		if b.isValid() {
+			return b.baseNs + int64(float64(RDTSC()-b.baseTSC)*b.coeff)
+		}
+	}
+	if ref := taiClock.Load(); ref != nil {
+		return (*ref)()
+	}
+	return 0
+}
+
+// CalibrateTAI calibrates TAINano against CLOCK_TAI, with the TAI offset checked by adjtimex(2).
+// After that, TAINano will be recalibrated with every calibration (e.g., Calibrate).
+//
+// It's cheap (a single sample with the coefficient of the current calibration),
+// because CLOCK_TAI has the same frequency as CLOCK_REALTIME.
+//
+// Only Linux is supported.
+func CalibrateTAI() error {
+
+	kc, err := ReadKernelClock()
+	if err != nil {
+		return err
+	}
+	if kc.TAIOffset == 0 {
+		return ErrTAIOffsetUnknown
+	}
+	ref, err := Clock(ClockTAI)
+	if err != nil {
+		return err
+	}
+	calibrateTAI(ref)
+	return nil
+}
+
+// calibrateTAI calibrates TAINano against ref.
+func calibrateTAI(ref ReferenceClock) {
+	taiClock.Store(&ref)
+	if s, ok := sampleTAI(); ok {
+		c := Current()
+		storeTAI(s, c.Coeff, c.FreqError)
+	}
+}
+
+// taiSample is a (tsc, CLOCK_TAI) sample for calibrating TAINano.
+type taiSample struct {
+	minDelta, tsc, ns int64
+}
+
+// sampleTAI samples the reference clock of TAINano, ok is false if TAI hasn't been calibrated.
+//
+// It takes hundreds of clock readings, so it's taken before calibrationMu is held (see storeFitted).
+func sampleTAI() (s taiSample, ok bool) {
+
+	ref := taiClock.Load()
+	if ref == nil || !Supported() {
+		return s, false
+	}
+	s.minDelta, s.tsc, s.ns = getClosestTSCRef(getClosestTSCSysRetries, *ref)
+	return s, true
+}
+
+// storeTAIBlock stores b to taiBlock.
+func storeTAIBlock(b *block) {
+	taiMu.Lock()
+	defer taiMu.Unlock()
+
+	storeBlock(taiAddr, b)
+}
+
+// storeTAI calibrates offset by the sample s with coefficient and stores it to taiBlock.
+func storeTAI(s taiSample, coeff, freqErr float64) {
+
+	b := newBlock(s.ns-int64(float64(s.tsc)*coeff), coeff, s.tsc)
+	b.errBound = int64(math.Ceil(float64(s.minDelta) * coeff / 2))
+	b.freqErr = freqErr
+	storeTAIBlock(&b)
+}
@@ -0,0 +1,24 @@
+package tsc
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCalibrateTAI(t *testing.T) {
+
+	f := newFakeKernelClock()
+	defer f.close()
+	defer resetTAI()
+
+	f.kc.TAIOffset = 37 * time.Second
+	if err := CalibrateTAI(); err != nil {
+		t.Fatal(err)
+	}
+
+	ref, _ := Clock(ClockTAI)
+	if d := TAINano() - ref(); math.Abs(float64(d)) > float64(100*time.Microsecond) {
+		t.Fatalf("delta to CLOCK_TAI is too big: %d", d)
+	}
+}
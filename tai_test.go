@@ -0,0 +1,92 @@
+package tsc
+
+import (
+	"errors"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// resetTAI makes TAI uncalibrated.
+func resetTAI() {
+	taiClock.Store(nil)
+	var b block
+	storeBlock(taiAddr, &b)
+}
+
+func TestCalibrateTAIOffsetUnknown(t *testing.T) {
+
+	f := newFakeKernelClock()
+	defer f.close()
+
+	if err := CalibrateTAI(); !errors.Is(err, ErrTAIOffsetUnknown) {
+		t.Fatalf("TAI offset should be unknown, got: %v", err)
+	}
+	if taiClock.Load() != nil {
+		t.Fatal("TAI shouldn't be calibrated")
+	}
+}
+
+// TestLeapSecond steps the realtime reference clock by ±1s (a leap second is inserted or deleted)
+// between calibrations made by fit, while CLOCK_TAI is continuous.
+func TestLeapSecond(t *testing.T) {
+
+	if !Supported() {
+		t.Skip("tsc is unsupported")
+	}
+	defer resetTAI()
+	defer restoreCalibration(t, Current())
+
+	var step atomic.Int64
+	realtime := func() int64 {
+		return sysClock() + step.Load()
+	}
+	tai := func() int64 {
+		return sysClock() + 37*int64(time.Second)
+	}
+	// calibrate is Calibrate against realtime, it returns the recorded jump.
+	calibrate := func() int64 {
+		r := fitAgainst(realtime)
+		c := makeCalibration(r.offset, r.coeff, SourceCalibrate)
+		c.ErrorBound, c.FreqError = r.errBound, r.freqErr
+		storeFitted(c, r)
+		for _, rec := range History() {
+			if rec.Timestamp == c.Timestamp && rec.Offset == c.Offset {
+				return rec.OffsetJump
+			}
+		}
+		t.Fatal("calibration isn't recorded")
+		return 0
+	}
+
+	calibrateTAI(tai)
+	calibrate()
+
+	for _, leap := range []int64{-int64(time.Second), 0} { // Inserted (realtime steps back), then deleted.
+		exp := leap - step.Load()
+		ob := loadBlock(taiAddr)
+		before := TAINano()
+		step.Store(leap)
+
+		if jump := calibrate(); math.Abs(float64(jump-exp)) > float64(time.Millisecond) {
+			t.Fatalf("offset should jump by %d, got: %d", exp, jump)
+		}
+
+		// TAI is continuous: recalibrated with the calibration without jump.
+		nb := loadBlock(taiAddr)
+		if nb.baseTSC == ob.baseTSC {
+			t.Fatal("TAI should be recalibrated")
+		}
+		if j := offsetJump(&ob, &nb); math.Abs(float64(j)) > float64(100*time.Microsecond) {
+			t.Fatalf("TAI jumps by %d when realtime steps by %d", j, exp)
+		}
+		after := TAINano()
+		if after <= before {
+			t.Fatalf("TAI should be monotonic: %d -> %d", before, after)
+		}
+		if d := after - tai(); math.Abs(float64(d)) > float64(100*time.Microsecond) {
+			t.Fatalf("delta to TAI is too big after realtime steps by %d: %d", exp, d)
+		}
+	}
+}
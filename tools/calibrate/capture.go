@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/templexxx/tsc/internal/capture"
+)
+
+// saveRounds records rounds to the capture file in path, each round is two samples.
+func saveRounds(path string, h capture.Header, rounds []round) error {
+
+	w, err := capture.Create(path, h)
+	if err != nil {
+		return err
+	}
+	for j, r := range rounds {
+		for _, s := range []capture.Sample{
+			{Round: j, TSC: r.tsc0, Sys: r.sys0, MinDelta: r.md0},
+			{Round: j, TSC: r.tsc1, Sys: r.sys1, MinDelta: r.md1},
+		} {
+			if err = w.Write(s); err != nil {
+				_ = w.Close()
+				return err
+			}
+		}
+	}
+	return w.Close()
+}
+
+// loadRounds loads rounds from the capture file in path (recorded by saveRounds).
+func loadRounds(path string) (capture.Header, []round, error) {
+
+	h, samples, err := capture.ReadFile(path)
+	if err != nil {
+		return h, nil, err
+	}
+	if h.Tool != "calibrate" {
+		return h, nil, fmt.Errorf("%w: recorded by %s, but not calibrate", capture.ErrInvalidCapture, h.Tool)
+	}
+	if len(samples)%2 != 0 {
+		return h, nil, fmt.Errorf("%w: odd number of samples: %d", capture.ErrInvalidCapture, len(samples))
+	}
+
+	rounds := make([]round, len(samples)/2)
+	for j := range rounds {
+		s0, s1 := samples[j*2], samples[j*2+1]
+		if s0.Round != j || s1.Round != j {
+			return h, nil, fmt.Errorf("%w: round %d is broken", capture.ErrInvalidCapture, j)
+		}
+		rounds[j] = round{tsc0: s0.TSC, sys0: s0.Sys, md0: s0.MinDelta, tsc1: s1.TSC, sys1: s1.Sys, md1: s1.MinDelta}
+	}
+	return h, rounds, nil
+}
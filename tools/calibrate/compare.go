@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/templexxx/tsc"
+)
+
+// round is a round of sampling: two closest (tsc, sys) pairs with their min tsc deltas.
+type round struct {
+	tsc0, sys0, md0 int64
+	tsc1, sys1, md1 int64
+}
+
+// centered is a round centered at the base (tsc, sys),
+// because float64 can't hold Unix nanoseconds precisely.
+type centered struct {
+	x0, y0 float64
+	x1, y1 float64
+}
+
+// estimator estimates sys = tsc * coeff + intercept by training rounds.
+// rounds are the raw ones for estimators which need them (e.g., the library's fit).
+type estimator struct {
+	name     string
+	estimate func(cs []centered, rounds []round, baseTSC, baseSys int64) (coeff, intercept float64)
+}
+
+// estimators are all the estimators compared in -compare mode.
+var estimators = []estimator{
+	{name: "ols", estimate: estimateOLS},
+	{name: "through-origin", estimate: estimateThroughOrigin},
+	{name: "avg frequency", estimate: estimateAvgFreq},
+	{name: "median frequency", estimate: estimateMedianFreq},
+	{name: "theil-sen", estimate: estimateTheilSen},
+	{name: "tsc.Fit", estimate: estimateLibrary},
+}
+
+// estimatorRecord is the k-fold cross-validation result of an estimator.
+type estimatorRecord struct {
+	Rank      int     `json:"rank"`
+	Name      string  `json:"name"`
+	Frequency float64 `json:"frequency"`    // Mean of folds.
+	FreqStd   float64 `json:"freq_std_ppb"` // Stddev of frequency among folds.
+	// Held-out errors of predicting sys by tsc.
+	AvgAbsDelta float64 `json:"avg_abs_delta_ns"`
+	RMS         float64 `json:"rms_ns"`
+	MaxAbsDelta float64 `json:"max_abs_delta_ns"`
+	// Held-out errors of predicting duration of rounds (only frequency matters).
+	AvgAbsDurationDelta float64 `json:"avg_abs_duration_delta_ns"`
+}
+
+// foldsOf returns the number of folds in [2, n].
+func foldsOf(k, n int) int {
+	return min(max(k, 2), n)
+}
+
+// compareEstimators runs every estimator on rounds by k-fold cross-validation,
+// the result is ranked by held-out avg abs delta.
+func compareEstimators(rounds []round, k int, rnd *rand.Rand) []estimatorRecord {
+
+	k = foldsOf(k, len(rounds))
+	baseTSC, baseSys := rounds[0].tsc0, rounds[0].sys0
+	idx := rnd.Perm(len(rounds))
+
+	records := make([]estimatorRecord, len(estimators))
+	for ei, e := range estimators {
+		freqs := make([]float64, 0, k)
+		var absSum, sqSum, maxAbs, durSum float64
+		var cnt, durCnt int
+		for fold := 0; fold < k; fold++ {
+			var train, test []round
+			for i, ri := range idx {
+				if i%k == fold {
+					test = append(test, rounds[ri])
+				} else {
+					train = append(train, rounds[ri])
+				}
+			}
+			coeff, intercept := e.estimate(center(train, baseTSC, baseSys), train, baseTSC, baseSys)
+			freqs = append(freqs, 1e9/coeff)
+
+			for _, c := range center(test, baseTSC, baseSys) {
+				for _, p := range [][2]float64{{c.x0, c.y0}, {c.x1, c.y1}} {
+					d := math.Abs(p[0]*coeff + intercept - p[1])
+					absSum += d
+					sqSum += d * d
+					maxAbs = max(maxAbs, d)
+					cnt++
+				}
+				durSum += math.Abs((c.x1-c.x0)*coeff - (c.y1 - c.y0))
+				durCnt++
+			}
+		}
+		mean, std := meanStd(freqs)
+		records[ei] = estimatorRecord{
+			Name:                e.name,
+			Frequency:           mean,
+			FreqStd:             std / mean * 1e9,
+			AvgAbsDelta:         absSum / float64(cnt),
+			RMS:                 math.Sqrt(sqSum / float64(cnt)),
+			MaxAbsDelta:         maxAbs,
+			AvgAbsDurationDelta: durSum / float64(durCnt),
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if math.IsNaN(records[j].AvgAbsDelta) {
+			return !math.IsNaN(records[i].AvgAbsDelta)
+		}
+		return records[i].AvgAbsDelta < records[j].AvgAbsDelta
+	})
+	for i := range records {
+		records[i].Rank = i + 1
+	}
+	return records
+}
+
+func printComparison(w io.Writer, k int, records []estimatorRecord) {
+
+	fmt.Fprintf(w, "estimators ranked by held-out error (%d-fold cross-validation):\n", k)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "rank\testimator\tfreq\tfreq std(ppb)\tavg abs delta(ns)\trms(ns)\tmax abs delta(ns)\tavg abs duration delta(ns)\t")
+	for _, r := range records {
+		fmt.Fprintf(tw, "%d\t%s\t%.3f\t%.3f\t%.2f\t%.2f\t%.2f\t%.2f\t\n",
+			r.Rank, r.Name, r.Frequency, r.FreqStd, r.AvgAbsDelta, r.RMS, r.MaxAbsDelta, r.AvgAbsDurationDelta)
+	}
+	_ = tw.Flush()
+}
+
+func center(rounds []round, baseTSC, baseSys int64) []centered {
+
+	cs := make([]centered, len(rounds))
+	for i, r := range rounds {
+		cs[i] = centered{
+			x0: float64(r.tsc0 - baseTSC), y0: float64(r.sys0 - baseSys),
+			x1: float64(r.tsc1 - baseTSC), y1: float64(r.sys1 - baseSys),
+		}
+	}
+	return cs
+}
+
+// points returns all (tsc, sys) pairs in cs.
+func points(cs []centered) (xs, ys []float64) {
+
+	xs = make([]float64, 0, len(cs)*2)
+	ys = make([]float64, 0, len(cs)*2)
+	for _, c := range cs {
+		xs = append(xs, c.x0, c.x1)
+		ys = append(ys, c.y0, c.y1)
+	}
+	return
+}
+
+// anchor returns the intercept which makes the mean residual 0 with coeff,
+// it's for estimators which only estimate frequency.
+func anchor(cs []centered, coeff float64) float64 {
+
+	xs, ys := points(cs)
+	sum := float64(0)
+	for i := range xs {
+		sum += ys[i] - xs[i]*coeff
+	}
+	return sum / float64(len(xs))
+}
+
+// anchorMedian is as same as anchor but using the median residual.
+func anchorMedian(cs []centered, coeff float64) float64 {
+
+	xs, ys := points(cs)
+	rs := make([]float64, len(xs))
+	for i := range xs {
+		rs[i] = ys[i] - xs[i]*coeff
+	}
+	return median(rs)
+}
+
+func estimateOLS(cs []centered, _ []round, _, _ int64) (float64, float64) {
+
+	xs, ys := points(cs)
+	coeff, offset := simpleLinearRegressionWithIntercept(xs, ys)
+	return coeff, float64(offset)
+}
+
+func estimateThroughOrigin(cs []centered, _ []round, _, _ int64) (float64, float64) {
+
+	tds, sds := make([]float64, len(cs)), make([]float64, len(cs))
+	for i, c := range cs {
+		tds[i], sds[i] = c.x1-c.x0, c.y1-c.y0
+	}
+	coeff, _ := simpleLinearRegression(tds, sds)
+	return coeff, anchor(cs, coeff)
+}
+
+func estimateAvgFreq(cs []centered, _ []round, _, _ int64) (float64, float64) {
+
+	freq := float64(0)
+	for _, c := range cs {
+		freq += (c.x1 - c.x0) / (c.y1 - c.y0) * 1e9
+	}
+	coeff := 1e9 / (freq / float64(len(cs)))
+	return coeff, anchor(cs, coeff)
+}
+
+func estimateMedianFreq(cs []centered, _ []round, _, _ int64) (float64, float64) {
+
+	coeffs := make([]float64, len(cs))
+	for i, c := range cs {
+		coeffs[i] = (c.y1 - c.y0) / (c.x1 - c.x0)
+	}
+	coeff := median(coeffs)
+	return coeff, anchorMedian(cs, coeff)
+}
+
+// estimateTheilSen uses the median of slopes of all pairs of points.
+func estimateTheilSen(cs []centered, _ []round, _, _ int64) (float64, float64) {
+
+	xs, ys := points(cs)
+	slopes := make([]float64, 0, len(xs)*(len(xs)-1)/2)
+	for i := range xs {
+		for j := i + 1; j < len(xs); j++ {
+			if xs[j] != xs[i] {
+				slopes = append(slopes, (ys[j]-ys[i])/(xs[j]-xs[i]))
+			}
+		}
+	}
+	coeff := median(slopes)
+	return coeff, anchorMedian(cs, coeff)
+}
+
+// estimateLibrary uses tsc.Fit which is used by tsc.Calibrate.
+func estimateLibrary(_ []centered, rounds []round, baseTSC, baseSys int64) (float64, float64) {
+
+	tscs := make([]int64, 0, len(rounds)*2)
+	syss := make([]int64, 0, len(rounds)*2)
+	window := int64(0)
+	for _, r := range rounds {
+		tscs = append(tscs, r.tsc0, r.tsc1)
+		syss = append(syss, r.sys0, r.sys1)
+		window = max(window, r.md0, r.md1)
+	}
+	c, err := tsc.Fit(tscs, syss, window)
+	if err != nil {
+		return math.NaN(), math.NaN()
+	}
+	// sys - baseSys = (tsc - baseTSC) * coeff + (baseTSC * coeff + offset - baseSys).
+	return c.Coeff, float64(c.Offset-baseSys) + float64(baseTSC)*c.Coeff
+}
+
+func median(fs []float64) float64 {
+
+	if len(fs) == 0 {
+		return math.NaN()
+	}
+	s := append([]float64(nil), fs...)
+	sort.Float64s(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
+
+func meanStd(fs []float64) (mean, std float64) {
+
+	for _, f := range fs {
+		mean += f
+	}
+	mean /= float64(len(fs))
+	for _, f := range fs {
+		std += (f - mean) * (f - mean)
+	}
+	return mean, math.Sqrt(std / float64(len(fs)))
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+const testFrequency = 3e9 // Known frequency of synthetic rounds.
+
+// makeRounds makes n rounds (16ms each, every 20ms) of tsc at testFrequency with sys jitter in [-jitter, jitter],
+// every outlierEvery-th round (if > 0) has sys delayed by outlier ns at its end.
+func makeRounds(n int, jitter, outlierEvery int, outlier int64, seed int64) []round {
+
+	rnd := rand.New(rand.NewSource(seed))
+	noise := func() int64 {
+		if jitter == 0 {
+			return 0
+		}
+		return rnd.Int63n(2*int64(jitter)+1) - int64(jitter)
+	}
+
+	const baseTSC, baseSys = int64(1e12), int64(1.7e18)
+	at := func(ns int64) (tsc, sys int64) {
+		return baseTSC + int64(math.Round(float64(ns)*testFrequency/1e9)), baseSys + ns + noise()
+	}
+
+	rounds := make([]round, n)
+	for i := range rounds {
+		start := int64(i) * 20e6
+		r := round{md0: 60, md1: 60}
+		r.tsc0, r.sys0 = at(start)
+		r.tsc1, r.sys1 = at(start + 16e6)
+		if outlierEvery > 0 && i%outlierEvery == outlierEvery-1 {
+			r.sys1 += outlier
+		}
+		rounds[i] = r
+	}
+	return rounds
+}
+
+// estimate runs e on all rounds.
+func estimate(e estimator, rounds []round) (coeff, intercept float64) {
+
+	baseTSC, baseSys := rounds[0].tsc0, rounds[0].sys0
+	return e.estimate(center(rounds, baseTSC, baseSys), rounds, baseTSC, baseSys)
+}
+
+func TestFoldsOf(t *testing.T) {
+
+	for _, c := range []struct {
+		k, n, exp int
+	}{
+		{5, 100, 5},
+		{1, 100, 2},
+		{0, 100, 2},
+		{-1, 100, 2},
+		{10, 3, 3},
+		{5, 5, 5},
+	} {
+		if act := foldsOf(c.k, c.n); act != c.exp {
+			t.Fatalf("mismatched folds of k: %d, n: %d: exp: %d, got: %d", c.k, c.n, c.exp, act)
+		}
+	}
+}
+
+func TestEstimators(t *testing.T) {
+
+	rounds := makeRounds(128, 20, 0, 0, 1)
+	for _, e := range estimators {
+		coeff, intercept := estimate(e, rounds)
+		if d := math.Abs(coeff*testFrequency/1e9 - 1); d > 1e-6 {
+			t.Fatalf("%s: frequency error is too big: %.3fppm", e.name, d*1e6)
+		}
+		if math.Abs(intercept) > 1000 {
+			t.Fatalf("%s: intercept is too big: %.2f", e.name, intercept)
+		}
+	}
+}
+
+// TestRobustEstimators tests estimators on rounds with outliers (sys delayed by 50µs in 1/8 rounds):
+// the median based ones are barely affected.
+func TestRobustEstimators(t *testing.T) {
+
+	rounds := makeRounds(128, 20, 8, 50e3, 1)
+	errOf := func(name string) float64 {
+		for _, e := range estimators {
+			if e.name == name {
+				coeff, _ := estimate(e, rounds)
+				return math.Abs(coeff*testFrequency/1e9 - 1)
+			}
+		}
+		t.Fatalf("estimator %s not found", name)
+		return 0
+	}
+
+	for _, name := range []string{"median frequency", "theil-sen"} {
+		if d := errOf(name); d > 1e-6 {
+			t.Fatalf("%s should be robust to outliers: %.3fppm", name, d*1e6)
+		}
+	}
+	if robust, avg := errOf("median frequency"), errOf("avg frequency"); robust >= avg {
+		t.Fatalf("median frequency should beat avg frequency with outliers: %.3fppm vs %.3fppm", robust*1e6, avg*1e6)
+	}
+}
+
+func TestCompareEstimators(t *testing.T) {
+
+	rounds := makeRounds(64, 20, 0, 0, 1)
+	records := compareEstimators(rounds, 4, rand.New(rand.NewSource(1)))
+
+	if len(records) != len(estimators) {
+		t.Fatalf("mismatched records: exp: %d, got: %d", len(estimators), len(records))
+	}
+	names := make(map[string]bool)
+	for i, r := range records {
+		names[r.Name] = true
+		if r.Rank != i+1 {
+			t.Fatalf("mismatched rank of %s: exp: %d, got: %d", r.Name, i+1, r.Rank)
+		}
+		if i > 0 && r.AvgAbsDelta < records[i-1].AvgAbsDelta {
+			t.Fatalf("%s should be ranked before %s", r.Name, records[i-1].Name)
+		}
+		if d := math.Abs(r.Frequency/testFrequency - 1); d > 1e-6 {
+			t.Fatalf("%s: frequency error is too big: %.3fppm", r.Name, d*1e6)
+		}
+		if r.AvgAbsDelta > 1000 || r.RMS < r.AvgAbsDelta || r.MaxAbsDelta < r.RMS {
+			t.Fatalf("%s: unexpected held-out errors: avg: %.2f, rms: %.2f, max: %.2f", r.Name, r.AvgAbsDelta, r.RMS, r.MaxAbsDelta)
+		}
+	}
+	if len(names) != len(estimators) {
+		t.Fatalf("duplicated estimators in records: %v", names)
+	}
+
+	// Same seed, same folds.
+	if again := compareEstimators(rounds, 4, rand.New(rand.NewSource(1))); !reflect.DeepEqual(records, again) {
+		t.Fatal("comparison should be reproducible with the same seed")
+	}
+}
+
+// TestCompareEstimatorsNaN tests failed estimators are ranked last.
+func TestCompareEstimatorsNaN(t *testing.T) {
+
+	saved := estimators
+	defer func() { estimators = saved }()
+
+	failed := estimator{name: "failed", estimate: func(_ []centered, _ []round, _, _ int64) (float64, float64) {
+		return math.NaN(), math.NaN()
+	}}
+	estimators = append([]estimator{failed}, saved...)
+
+	records := compareEstimators(makeRounds(64, 20, 0, 0, 1), 4, rand.New(rand.NewSource(1)))
+	if last := records[len(records)-1]; last.Name != "failed" || last.Rank != len(estimators) {
+		t.Fatalf("failed estimator should be ranked last, got: %s (rank: %d)", last.Name, last.Rank)
+	}
+}
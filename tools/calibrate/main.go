@@ -6,11 +6,13 @@ import (
 	"log"
 	"math"
 	"math/rand"
+	"os"
 	"runtime"
 	"time"
 
 	"github.com/templexxx/cpu"
 	"github.com/templexxx/tsc"
+	"github.com/templexxx/tsc/internal/capture"
 )
 
 var (
@@ -18,6 +20,12 @@ var (
 	duration      = flag.Int64("duration", 16, "duration(ms) between two timestamp, we need a bit longer duration for make result better in long term")
 	printSample   = flag.Bool("print", false, "print every sample")
 	withIntercept = flag.Bool("offset", false, "using simple linear regression with intercept to get offset")
+	format        = flag.String("format", formatText, "output format: text, json or csv")
+	compare       = flag.Bool("compare", false, "compare all estimators on the same samples by k-fold cross-validation")
+	folds         = flag.Int("folds", 5, "number of folds in cross-validation (for -compare)")
+	seed          = flag.Int64("seed", 1, "seed of shuffling rounds into folds (for -compare), the same seed makes the same folds")
+	record        = flag.String("record", "", "record samples to the capture file")
+	replay        = flag.String("replay", "", "replay samples from the capture file instead of sampling (tsc isn't needed)")
 )
 
 const (
@@ -37,9 +45,10 @@ var (
 func main() {
 	flag.Parse()
 
-	if !tsc.Supported() {
-		log.Fatal("tsc unsupported")
+	if *format != formatText && *format != formatJSON && *format != formatCSV {
+		log.Fatalf("unknown format: %s", *format)
 	}
+	text := *format == formatText
 
 	cnt := *sample
 
@@ -51,62 +60,85 @@ func main() {
 		simulateFuncName = "simple linear regression with intercept"
 	}
 
-	minTSCDelta := minTSCDeltaLinux
-	if runtime.GOOS == `darwin` {
-		minTSCDelta = minTSCDeltaMac
-	} else if runtime.GOOS != `linux` {
-		log.Fatalf("sorry, haven't been well tested on: %s", runtime.GOOS)
-	}
+	var rounds []round
+	var cpuFlag string
+	var ooffset int64
+	var ocoeff float64
+	var cost time.Duration
 
-	du := time.Duration(*duration) * time.Millisecond
-	if du == 0 {
-		du = sleepDuration
-	}
+	if *replay != "" {
+		h, rs, err := loadRounds(*replay)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(rs) < minSamples {
+			log.Fatalf("too few rounds in %s, exp >= %d, but got: %d", *replay, minSamples, len(rs))
+		}
+		rounds = rs
+		cpuFlag = h.CPU
+		ooffset, ocoeff = h.Calibration.Offset, h.Calibration.Coeff
+		cost = time.Duration(rounds[len(rounds)-1].sys1 - h.Start)
+	} else {
+		if !tsc.Supported() {
+			log.Fatal("tsc unsupported")
+		}
+
+		minTSCDelta := minTSCDeltaLinux
+		if runtime.GOOS == `darwin` {
+			minTSCDelta = minTSCDeltaMac
+		} else if runtime.GOOS != `linux` {
+			log.Fatalf("sorry, haven't been well tested on: %s", runtime.GOOS)
+		}
+
+		du := time.Duration(*duration) * time.Millisecond
+		if du == 0 {
+			du = sleepDuration
+		}
 
-	start := time.Now()
+		start := time.Now()
+		rounds = collect(cnt, du, minTSCDelta)
+		cost = time.Now().Sub(start)
+
+		cpuFlag = fmt.Sprintf("%s_%d", cpu.X86.Signature, cpu.X86.SteppingID)
+		ooffset, ocoeff = tsc.LoadOffsetCoeff(tsc.OffsetCoeffAddr)
+
+		if *record != "" {
+			h := capture.Header{Tool: "calibrate", CPU: cpuFlag, Start: start.UnixNano(), Options: flagValues(), Calibration: tsc.Current()}
+			if err := saveRounds(*record, h, rounds); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	cnt = len(rounds)
 
 	freqs := make([]float64, cnt)
 	tscDeltas := make([]float64, cnt)
 	sysDeltas := make([]float64, cnt)
 	tscs := make([]float64, cnt*2)
 	syss := make([]float64, cnt*2)
+	records := make([]sampleRecord, cnt)
 
-	for j := 0; j < cnt; j++ {
-		md0, tscc0, sys0 := getClosestTSCSys(triesToFindClosest)
-		if md0 > minTSCDelta {
-			log.Fatalf("the min tsc delta too big, exp <= %d, but got: %d", minTSCDelta, md0)
-		}
-
-		time.Sleep(du)
-		md1, tscc1, sys1 := getClosestTSCSys(triesToFindClosest)
-		if md1 > minTSCDelta {
-			log.Fatalf("the min tsc delta too big, exp <= %d, but got: %d", minTSCDelta, md1)
-		}
-
-		if sys1-sys0 < int64(du) {
-			log.Fatalf("sys clock goes backwards, exp %s, but got: %.2fms", du.String(), float64(sys1-sys0)/float64(time.Millisecond))
-		}
-
-		freq := (float64(tscc1-tscc0) / float64(sys1-sys0)) * 1e9
+	for j, r := range rounds {
+		freq := (float64(r.tsc1-r.tsc0) / float64(r.sys1-r.sys0)) * 1e9
 		freqs[j] = freq
 
-		if *printSample {
+		records[j] = sampleRecord{Round: j, MinDelta0: r.md0, MinDelta1: r.md1, Frequency: freq, Duration: r.sys1 - r.sys0}
+
+		if *printSample && text {
 			fmt.Printf("round: %d freq is: %.9f, min tsc deltas are: %d, %d, duration of closest sysclock: %.2fms\n",
-				j, freq, md0, md1, float64(sys1-sys0)/1000/1000)
+				j, freq, r.md0, r.md1, float64(r.sys1-r.sys0)/1000/1000)
 		}
 
-		tscDeltas[j] = float64(tscc1 - tscc0)
-		sysDeltas[j] = float64(sys1 - sys0)
+		tscDeltas[j] = float64(r.tsc1 - r.tsc0)
+		sysDeltas[j] = float64(r.sys1 - r.sys0)
 
-		tscs[j*2] = float64(tscc0)
-		tscs[j*2+1] = float64(tscc1)
+		tscs[j*2] = float64(r.tsc0)
+		tscs[j*2+1] = float64(r.tsc1)
 
-		syss[j*2] = float64(sys0)
-		syss[j*2+1] = float64(sys1)
+		syss[j*2] = float64(r.sys0)
+		syss[j*2+1] = float64(r.sys1)
 	}
 
-	cost := time.Now().Sub(start)
-
 	avgFreq := float64(0)
 	for _, f := range freqs {
 		avgFreq += f
@@ -115,16 +147,6 @@ func main() {
 	avgCoeff := 1 / (avgFreq / 1e9)
 	avgOffset := int64(syss[cnt*2-1]) - int64(tscs[cnt*2-1]*avgCoeff)
 
-	cpuFlag := fmt.Sprintf("%s_%d", cpu.X86.Signature, cpu.X86.SteppingID)
-
-	fmt.Printf("cpu: %s, job cost: %.2fs\n", cpuFlag, cost.Seconds())
-	fmt.Println("-------")
-
-	ooffset, ocoeff := tsc.LoadOffsetCoeff(tsc.OffsetCoeffAddr)
-
-	fmt.Printf("origin coeffcient: %.16f, freq: %.16f, offset: %d(%s)\n", ocoeff, 1e9/ocoeff, ooffset, nanosFmt(ooffset))
-	fmt.Printf("avg coeffcient: %.16f, freq: %.16f\n", avgCoeff, avgFreq)
-	fmt.Println("-------")
 	var coeff float64
 	var offset int64
 
@@ -132,6 +154,9 @@ func main() {
 
 	rand.Seed(time.Now().UnixNano())
 
+	// xs & ys are the shuffled samples which are used for fitting & prediction:
+	// deltas without intercept, timestamps with intercept.
+	xs, ys := tscDeltas, sysDeltas
 	if !*withIntercept {
 		rand.Shuffle(cnt, func(i, j int) {
 			tscDeltas[i], tscDeltas[j] = tscDeltas[j], tscDeltas[i]
@@ -146,53 +171,94 @@ func main() {
 
 		trainSetCnt *= 2
 		coeff, offset = simpleLinearRegressionWithIntercept(tscs[:trainSetCnt], syss[:trainSetCnt])
+		xs, ys = tscs, syss
 	}
 
-	fmt.Printf("result of %s, coeff: %.16f, freq: %.16f, offset: %d(%s)\n", simulateFuncName, coeff, 1e9/coeff, offset, nanosFmt(offset))
-	fmt.Println("-------")
-	avgPredictDelta := float64(0)
-	totalPredictDelta := float64(0)
+	// Offsets are meaningless for deltas.
+	modelOffset := func(off int64) int64 {
+		if *withIntercept {
+			return off
+		}
+		return 0
+	}
+	makeModel := func(name string, coeff float64, offset int64) modelRecord {
+		return modelRecord{
+			Name:      name,
+			Coeff:     coeff,
+			Frequency: 1e9 / coeff,
+			Offset:    offset,
+			Train:     predict(xs[:trainSetCnt], ys[:trainSetCnt], coeff, modelOffset(offset)),
+			Test:      predict(xs[trainSetCnt:], ys[trainSetCnt:], coeff, modelOffset(offset)),
+		}
+	}
+	origin := makeModel("origin", ocoeff, ooffset)
+	avg := makeModel("avg frequency", avgCoeff, avgOffset)
+	fitted := makeModel(simulateFuncName, coeff, offset)
 
-	avgPredictDeltaAvgFreq := float64(0)
-	totalPredictDeltaAvgFreq := float64(0)
+	var comparison []estimatorRecord
+	if *compare {
+		comparison = compareEstimators(rounds, *folds, rand.New(rand.NewSource(*seed)))
+	}
 
-	if !*withIntercept {
-		for i := range tscDeltas[trainSetCnt:] {
-			predict := int64(tscDeltas[i+trainSetCnt] * coeff)
-			predictAvgFreq := int64(tscDeltas[i+trainSetCnt] * avgCoeff)
+	if !text {
+		r := &report{
+			CPU:        cpuFlag,
+			Options:    flagValues(),
+			Samples:    records,
+			Models:     []modelRecord{origin, avg, fitted},
+			Comparison: comparison,
+			JobCost:    cost.Seconds(),
+		}
+		if err := writeReport(os.Stdout, *format, r); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-			act := sysDeltas[i+trainSetCnt]
+	fmt.Printf("cpu: %s, job cost: %.2fs\n", cpuFlag, cost.Seconds())
+	fmt.Println("-------")
 
-			avgPredictDelta += math.Abs(float64(predict) - act)
-			totalPredictDelta += float64(predict) - act
+	fmt.Printf("origin coeffcient: %.16f, freq: %.16f, offset: %d(%s)\n", ocoeff, 1e9/ocoeff, ooffset, nanosFmt(ooffset))
+	fmt.Printf("avg coeffcient: %.16f, freq: %.16f\n", avgCoeff, avgFreq)
+	fmt.Println("-------")
 
-			avgPredictDeltaAvgFreq += math.Abs(float64(predictAvgFreq) - act)
-			totalPredictDeltaAvgFreq += float64(predictAvgFreq) - act
-		}
-		avgPredictDelta = avgPredictDelta / float64(len(tscDeltas)-trainSetCnt)
+	fmt.Printf("result of %s, coeff: %.16f, freq: %.16f, offset: %d(%s)\n", simulateFuncName, coeff, 1e9/coeff, offset, nanosFmt(offset))
+	fmt.Println("-------")
 
-	} else {
-		for i := range tscs[trainSetCnt:] {
-			predict := int64(tscs[i+trainSetCnt]*coeff) + offset
-			predictAvgFreq := int64(tscs[i+trainSetCnt]*avgCoeff) + avgOffset
+	fmt.Printf("prediction made by %s and system clock, avg abs delta %.2fus, total non-abs dealta: %.2fus\n",
+		simulateFuncName, fitted.Test.AvgAbsDelta/1000, fitted.Test.TotalDelta/1000)
+	fmt.Printf("prediction made by avg frequency and system clock, avg abs delta %.2fus, total non-abs dealta: %.2fus\n",
+		avg.Test.AvgAbsDelta/1000, avg.Test.TotalDelta/1000)
 
-			act := syss[i+trainSetCnt]
+	if *compare {
+		fmt.Println("-------")
+		printComparison(os.Stdout, foldsOf(*folds, cnt), comparison)
+	}
+}
 
-			avgPredictDelta += math.Abs(float64(predict) - act)
-			totalPredictDelta += float64(predict) - act
+// collect collects cnt rounds of samples, du is the duration between two samples in a round.
+func collect(cnt int, du time.Duration, minTSCDelta int64) []round {
 
-			avgPredictDeltaAvgFreq += math.Abs(float64(predictAvgFreq) - act)
-			totalPredictDeltaAvgFreq += float64(predictAvgFreq) - act
+	rounds := make([]round, cnt)
+	for j := range rounds {
+		md0, tscc0, sys0 := getClosestTSCSys(triesToFindClosest)
+		if md0 > minTSCDelta {
+			log.Fatalf("the min tsc delta too big, exp <= %d, but got: %d", minTSCDelta, md0)
 		}
-		avgPredictDelta = avgPredictDelta / float64(len(tscs)-trainSetCnt)
-	}
 
-	fmt.Printf("prediction made by %s and system clock, avg abs delta %.2fus, total non-abs dealta: %.2fus\n",
-		simulateFuncName, avgPredictDelta/1000, totalPredictDelta/1000)
+		time.Sleep(du)
+		md1, tscc1, sys1 := getClosestTSCSys(triesToFindClosest)
+		if md1 > minTSCDelta {
+			log.Fatalf("the min tsc delta too big, exp <= %d, but got: %d", minTSCDelta, md1)
+		}
 
-	avgPredictDeltaAvgFreq = avgPredictDeltaAvgFreq / float64(len(tscDeltas))
-	fmt.Printf("prediction made by avg frequency and system clock, avg abs delta %.2fus, total non-abs dealta: %.2fus\n",
-		avgPredictDeltaAvgFreq/1000, totalPredictDeltaAvgFreq/1000)
+		if sys1-sys0 < int64(du) {
+			log.Fatalf("sys clock goes backwards, exp %s, but got: %.2fms", du.String(), float64(sys1-sys0)/float64(time.Millisecond))
+		}
+
+		rounds[j] = round{tsc0: tscc0, sys0: sys0, md0: md0, tsc1: tscc1, sys1: sys1, md1: md1}
+	}
+	return rounds
 }
 
 // getClosestTSCSys tries to get the closest tsc register value nearby the system clock in a loop.
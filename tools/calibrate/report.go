@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Output formats.
+const (
+	formatText = "text"
+	formatJSON = "json"
+	formatCSV  = "csv"
+)
+
+// report is the structured result of a calibrate job (for -format json & csv).
+type report struct {
+	CPU     string            `json:"cpu"`
+	Options map[string]string `json:"options"`
+	Samples []sampleRecord    `json:"samples"`
+	Models  []modelRecord     `json:"models"`
+	// Comparison is the ranked estimators (only in -compare mode).
+	Comparison []estimatorRecord `json:"comparison,omitempty"`
+	JobCost    float64           `json:"job_cost_seconds"`
+}
+
+// sampleRecord is a round of sampling:
+// two closest (tsc, sys) pairs with duration between them.
+type sampleRecord struct {
+	Round     int     `json:"round"`
+	MinDelta0 int64   `json:"min_delta0"` // Min tsc delta of the first pair.
+	MinDelta1 int64   `json:"min_delta1"` // Min tsc delta of the second pair.
+	Frequency float64 `json:"frequency"`
+	Duration  int64   `json:"duration_ns"` // Duration of the closest system clocks.
+}
+
+// modelRecord is a model: sys = tsc * Coeff + Offset,
+// with its prediction errors on the train & test sets.
+type modelRecord struct {
+	Name      string          `json:"name"`
+	Coeff     float64         `json:"coeff"`
+	Frequency float64         `json:"frequency"`
+	Offset    int64           `json:"offset"`
+	Train     predictionError `json:"train"`
+	Test      predictionError `json:"test"`
+}
+
+// predictionError is the error of predicting system clock by a model.
+type predictionError struct {
+	Count       int     `json:"count"`
+	AvgAbsDelta float64 `json:"avg_abs_delta_ns"`
+	TotalDelta  float64 `json:"total_delta_ns"` // Sum of non-abs deltas.
+}
+
+// predict returns errors of predicting ys by xs * coeff + offset.
+func predict(xs, ys []float64, coeff float64, offset int64) predictionError {
+
+	e := predictionError{Count: len(xs)}
+	for i := range xs {
+		delta := float64(int64(xs[i]*coeff)+offset) - ys[i]
+		e.AvgAbsDelta += math.Abs(delta)
+		e.TotalDelta += delta
+	}
+	if e.Count > 0 {
+		e.AvgAbsDelta /= float64(e.Count)
+	}
+	return e
+}
+
+// flagValues returns all flags (set or default) by name.
+func flagValues() map[string]string {
+
+	opts := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		opts[f.Name] = f.Value.String()
+	})
+	return opts
+}
+
+func writeReport(w io.Writer, format string, r *report) error {
+
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case formatCSV:
+		return writeCSV(w, r)
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+// writeCSV writes r in long format, each row is: kind,name,field,value.
+// e.g.
+//
+//	kind,name,field,value
+//	meta,,cpu,06_97H_2
+//	option,sample,value,128
+//	sample,0,frequency,2995200103.2
+//	model,avg frequency,test_avg_abs_delta_ns,21.5
+func writeCSV(w io.Writer, r *report) error {
+
+	cw := csv.NewWriter(w)
+	row := func(kind, name, field, value string) {
+		_ = cw.Write([]string{kind, name, field, value})
+	}
+	f64 := func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+	i64 := func(i int64) string { return strconv.FormatInt(i, 10) }
+
+	row("kind", "name", "field", "value")
+	row("meta", "", "cpu", r.CPU)
+	row("meta", "", "job_cost_seconds", f64(r.JobCost))
+	for _, name := range sortedKeys(r.Options) {
+		row("option", name, "value", r.Options[name])
+	}
+	for _, s := range r.Samples {
+		round := strconv.Itoa(s.Round)
+		row("sample", round, "min_delta0", i64(s.MinDelta0))
+		row("sample", round, "min_delta1", i64(s.MinDelta1))
+		row("sample", round, "frequency", f64(s.Frequency))
+		row("sample", round, "duration_ns", i64(s.Duration))
+	}
+	for _, m := range r.Models {
+		row("model", m.Name, "coeff", f64(m.Coeff))
+		row("model", m.Name, "frequency", f64(m.Frequency))
+		row("model", m.Name, "offset", i64(m.Offset))
+		for _, set := range []struct {
+			name string
+			e    predictionError
+		}{{"train", m.Train}, {"test", m.Test}} {
+			row("model", m.Name, set.name+"_count", strconv.Itoa(set.e.Count))
+			row("model", m.Name, set.name+"_avg_abs_delta_ns", f64(set.e.AvgAbsDelta))
+			row("model", m.Name, set.name+"_total_delta_ns", f64(set.e.TotalDelta))
+		}
+	}
+	for _, e := range r.Comparison {
+		row("estimator", e.Name, "rank", strconv.Itoa(e.Rank))
+		row("estimator", e.Name, "frequency", f64(e.Frequency))
+		row("estimator", e.Name, "freq_std_ppb", f64(e.FreqStd))
+		row("estimator", e.Name, "avg_abs_delta_ns", f64(e.AvgAbsDelta))
+		row("estimator", e.Name, "rms_ns", f64(e.RMS))
+		row("estimator", e.Name, "max_abs_delta_ns", f64(e.MaxAbsDelta))
+		row("estimator", e.Name, "avg_abs_duration_delta_ns", f64(e.AvgAbsDurationDelta))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func sortedKeys(m map[string]string) []string {
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
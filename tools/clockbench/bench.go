@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/templexxx/cpu"
+	"github.com/templexxx/tsc"
+)
+
+// timer measures costs, it's tsc (in order) if possible.
+type timer struct {
+	name      string
+	now       func() int64
+	nsPerTick float64
+}
+
+func newTimer() timer {
+
+	if tsc.GetInOrder() == 0 { // Non-amd64.
+		return timer{name: "time.Now", now: func() int64 { return time.Now().UnixNano() }, nsPerTick: 1}
+	}
+	if tsc.Supported() {
+		return timer{name: "tsc (calibrated)", now: tsc.GetInOrder, nsPerTick: tsc.Current().Coeff}
+	}
+	// Estimate frequency roughly, it's enough for costs.
+	t0, s0 := tsc.GetInOrder(), time.Now().UnixNano()
+	time.Sleep(100 * time.Millisecond)
+	t1, s1 := tsc.GetInOrder(), time.Now().UnixNano()
+	return timer{name: "tsc (estimated)", now: tsc.GetInOrder, nsPerTick: float64(s1-s0) / float64(t1-t0)}
+}
+
+// result is the benchmark result of a path, costs are in ns.
+type result struct {
+	name                   string
+	mean                   float64
+	p50, p99, p999, max    float64
+	resolution             float64 // Min non-zero step between two calls, ns (or cycles for cycles paths).
+	cycles                 bool
+	repeats                float64 // Ratio of calls returning the same value as the last one.
+	backwards              int64   // Times of going backwards across goroutines.
+	maxBackwards           int64   // Max backwards value (ns or cycles).
+	contended              float64 // Per-call cost (ns) with all threads calling concurrently.
+	contendedThreads       int
+	monotonicityCheckCalls int64
+}
+
+var sink int64
+
+func bench(p path, tm timer) result {
+
+	r := result{name: p.name, cycles: p.cycles}
+	costs := measureCosts(p.fn, tm)
+	sort.Float64s(costs)
+	sum := float64(0)
+	for _, c := range costs {
+		sum += c
+	}
+	r.mean = sum / float64(len(costs))
+	r.p50, r.p99, r.p999 = percentile(costs, 50), percentile(costs, 99), percentile(costs, 99.9)
+	r.max = costs[len(costs)-1]
+
+	r.resolution, r.repeats = measureResolution(p.fn)
+	r.backwards, r.maxBackwards, r.monotonicityCheckCalls = checkMonotonicity(p.fn, *threads, *duration)
+	r.contended, r.contendedThreads = measureContention(p.fn, *threads, *duration), *threads
+	return r
+}
+
+// measureCosts returns per-call costs (ns) of samples, the overhead of timer is subtracted.
+func measureCosts(fn func() int64, tm timer) []float64 {
+
+	noop := func() int64 { return 0 }
+	overhead := rawCosts(noop, tm)
+	sort.Float64s(overhead)
+	base := percentile(overhead, 50)
+
+	costs := rawCosts(fn, tm)
+	for i := range costs {
+		costs[i] = math.Max(costs[i]-base, 0) / float64(*batch) * tm.nsPerTick
+	}
+	return costs
+}
+
+func rawCosts(fn func() int64, tm timer) []float64 {
+
+	costs := make([]float64, *samples)
+	s := int64(0)
+	for i := range costs {
+		t0 := tm.now()
+		for j := 0; j < *batch; j++ {
+			s += fn()
+		}
+		costs[i] = float64(tm.now() - t0)
+	}
+	sink += s
+	return costs
+}
+
+// measureResolution returns the min non-zero step between two calls,
+// and the ratio of calls returning the same value as the last one.
+func measureResolution(fn func() int64) (resolution, repeats float64) {
+
+	const calls = 100000
+
+	minStep, same := int64(math.MaxInt64), 0
+	last := fn()
+	for i := 0; i < calls; i++ {
+		v := fn()
+		if d := v - last; d == 0 {
+			same++
+		} else if d > 0 && d < minStep {
+			minStep = d
+		}
+		last = v
+	}
+	if minStep == math.MaxInt64 {
+		return math.NaN(), 1
+	}
+	return float64(minStep), float64(same) / calls
+}
+
+// checkMonotonicity checks whether fn goes backwards across goroutines:
+// every call must be >= the max value published before it's called.
+func checkMonotonicity(fn func() int64, threads int, du time.Duration) (backwards, maxBackwards, calls int64) {
+
+	var latest, bw, maxBw, total atomic.Int64
+	latest.Store(fn())
+
+	deadline := time.Now().Add(du)
+	var wg sync.WaitGroup
+	wg.Add(threads)
+	for i := 0; i < threads; i++ {
+		go func() {
+			defer wg.Done()
+			n := int64(0)
+			for ; n&1023 != 0 || time.Now().Before(deadline); n++ {
+				prev := latest.Load()
+				v := fn()
+				if d := prev - v; d > 0 {
+					bw.Add(1)
+					for m := maxBw.Load(); d > m && !maxBw.CompareAndSwap(m, d); m = maxBw.Load() {
+					}
+					continue
+				}
+				for l := latest.Load(); v > l && !latest.CompareAndSwap(l, v); l = latest.Load() {
+				}
+			}
+			total.Add(n)
+		}()
+	}
+	wg.Wait()
+	return bw.Load(), maxBw.Load(), total.Load()
+}
+
+// measureContention returns per-call cost (ns) with threads calling fn concurrently.
+func measureContention(fn func() int64, threads int, du time.Duration) float64 {
+
+	var total atomic.Int64
+	start := time.Now()
+	deadline := start.Add(du)
+	var wg sync.WaitGroup
+	wg.Add(threads)
+	for i := 0; i < threads; i++ {
+		go func() {
+			defer wg.Done()
+			n, s := int64(0), int64(0)
+			for ; n&1023 != 0 || time.Now().Before(deadline); n++ {
+				s += fn()
+			}
+			total.Add(n)
+			atomic.AddInt64(&sink, s)
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	return float64(elapsed) * float64(threads) / float64(total.Load())
+}
+
+// percentile returns the p-th percentile of sorted values (nearest-rank method).
+func percentile(sorted []float64, p float64) float64 {
+
+	i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+func printMarkdown(w io.Writer, results []result, threads int) {
+
+	fmt.Fprintf(w, "| Path | Mean (ns) | p50 (ns) | p99 (ns) | p99.9 (ns) | Max (ns) | Resolution | Repeats | Backwards | Contended %d threads (ns/call) |\n", threads)
+	fmt.Fprintln(w, "|---|---:|---:|---:|---:|---:|---:|---:|---:|---:|")
+	for _, r := range results {
+		unit := "ns"
+		if r.cycles {
+			unit = " cycles"
+		}
+		res := "-"
+		if !math.IsNaN(r.resolution) {
+			res = fmt.Sprintf("%.0f%s", r.resolution, unit)
+		}
+		bw := "0"
+		if r.backwards > 0 {
+			bw = fmt.Sprintf("%d/%d (max %d%s)", r.backwards, r.monotonicityCheckCalls, r.maxBackwards, unit)
+		}
+		fmt.Fprintf(w, "| %s | %.1f | %.1f | %.1f | %.1f | %.1f | %s | %.2f%% | %s | %.1f |\n",
+			r.name, r.mean, r.p50, r.p99, r.p999, r.max, res, r.repeats*100, bw, r.contended)
+	}
+}
+
+func cpuName() string {
+
+	if cpu.X86.Name != "" {
+		return fmt.Sprintf("%s (%s_%d)", cpu.X86.Name, cpu.X86.Signature, cpu.X86.SteppingID)
+	}
+	return "unknown"
+}
+
+func sameFunc(a, b func() int64) bool {
+	return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+}
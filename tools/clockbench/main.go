@@ -0,0 +1,82 @@
+// clockbench benchmarks all clock paths: per-call cost distribution, resolution,
+// monotonicity across goroutines & throughput under contention, and prints a markdown table.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/templexxx/tsc"
+)
+
+var (
+	samples  = flag.Int("samples", 100000, "number of cost samples for each path")
+	batch    = flag.Int("batch", 16, "calls in a cost sample, the per-call cost is the sample / batch")
+	threads  = flag.Int("threads", runtime.GOMAXPROCS(0), "goroutines for monotonicity & contention checking")
+	duration = flag.Duration("duration", 200*time.Millisecond, "duration of monotonicity & contention checking for each path")
+)
+
+// path is a clock path, cycles means it returns tsc but not nanoseconds.
+type path struct {
+	name   string
+	fn     func() int64
+	cycles bool
+}
+
+func paths() []path {
+
+	ps := []path{{name: "time.Now", fn: func() int64 { return time.Now().UnixNano() }}}
+	for _, id := range []tsc.ClockID{tsc.ClockMonotonic, tsc.ClockMonotonicRaw, tsc.ClockBoottime, tsc.ClockTAI} {
+		if c, ok := syscallClock(id); ok {
+			ps = append(ps, path{name: "unix.ClockGettime(" + id.String() + ")", fn: c})
+		}
+		// It's read from the vDSO data if possible, or it's as same as the syscall.
+		if c, err := tsc.Clock(id); err == nil {
+			ps = append(ps, path{name: "tsc.Clock(" + id.String() + ")", fn: c})
+		}
+	}
+	if tsc.RDTSC() != 0 { // 0 on non-amd64.
+		ps = append(ps,
+			path{name: "RDTSC", fn: tsc.RDTSC, cycles: true},
+			path{name: "GetInOrder", fn: tsc.GetInOrder, cycles: true})
+	}
+	for _, impl := range tsc.Implementations() {
+		ps = append(ps, path{name: impl.Name, fn: impl.Func})
+	}
+	return ps
+}
+
+func main() {
+
+	flag.Parse()
+
+	if *samples <= 0 || *batch <= 0 || *threads <= 0 {
+		log.Fatal("samples, batch & threads must be positive")
+	}
+
+	tm := newTimer()
+	ps := paths()
+	results := make([]result, len(ps))
+	for i, p := range ps {
+		results[i] = bench(p, tm)
+	}
+
+	fmt.Printf("cpu: %s, GOMAXPROCS: %d, threads: %d, current UnixNano: %s, timer: %s\n\n",
+		cpuName(), runtime.GOMAXPROCS(0), *threads, currentUnixNano(), tm.name)
+	printMarkdown(os.Stdout, results, *threads)
+}
+
+// currentUnixNano returns the name of the path which tsc.UnixNano is.
+func currentUnixNano() string {
+
+	for _, impl := range tsc.Implementations() {
+		if sameFunc(impl.Func, tsc.UnixNano) {
+			return impl.Name
+		}
+	}
+	return "system clock"
+}
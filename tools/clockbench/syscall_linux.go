@@ -0,0 +1,31 @@
+package main
+
+import (
+	"github.com/templexxx/tsc"
+	"golang.org/x/sys/unix"
+)
+
+var syscallClockIDs = map[tsc.ClockID]int32{
+	tsc.ClockMonotonic:    unix.CLOCK_MONOTONIC,
+	tsc.ClockMonotonicRaw: unix.CLOCK_MONOTONIC_RAW,
+	tsc.ClockBoottime:     unix.CLOCK_BOOTTIME,
+	tsc.ClockTAI:          unix.CLOCK_TAI,
+}
+
+// syscallClock returns the clock_gettime syscall (unix.ClockGettime doesn't go through vDSO) of id.
+func syscallClock(id tsc.ClockID) (func() int64, bool) {
+
+	cid, ok := syscallClockIDs[id]
+	if !ok {
+		return nil, false
+	}
+	var ts unix.Timespec
+	if unix.ClockGettime(cid, &ts) != nil {
+		return nil, false
+	}
+	return func() int64 {
+		var ts unix.Timespec
+		_ = unix.ClockGettime(cid, &ts) // It's checked above.
+		return ts.Nano()
+	}, true
+}
@@ -0,0 +1,16 @@
+package main
+
+import "github.com/templexxx/cpu"
+
+func checkAVX512() error {
+
+	if !cpu.X86.HasAVX512F {
+		return errLoadUnsupported
+	}
+	return nil
+}
+
+// fmaZMM runs n rounds of 512-bit FMA on 8 accumulators.
+//
+//go:noescape
+func fmaZMM(n int)
@@ -0,0 +1,32 @@
+#include "textflag.h"
+
+// func fmaZMM(n int)
+TEXT ·fmaZMM(SB), NOSPLIT, $0-8
+
+	MOVQ n+0(FP), CX
+	VPXORQ Z0, Z0, Z0
+	VPXORQ Z1, Z1, Z1
+	VPXORQ Z2, Z2, Z2
+	VPXORQ Z3, Z3, Z3
+	VPXORQ Z4, Z4, Z4
+	VPXORQ Z5, Z5, Z5
+	VPXORQ Z6, Z6, Z6
+	VPXORQ Z7, Z7, Z7
+	VPXORQ Z8, Z8, Z8
+	VPXORQ Z9, Z9, Z9
+
+loop:
+	// Independent accumulators keep FMA units busy.
+	VFMADD231PD Z8, Z9, Z0
+	VFMADD231PD Z8, Z9, Z1
+	VFMADD231PD Z8, Z9, Z2
+	VFMADD231PD Z8, Z9, Z3
+	VFMADD231PD Z8, Z9, Z4
+	VFMADD231PD Z8, Z9, Z5
+	VFMADD231PD Z8, Z9, Z6
+	VFMADD231PD Z8, Z9, Z7
+	DECQ CX
+	JNZ  loop
+
+	VZEROUPPER
+	RET
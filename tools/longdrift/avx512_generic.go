@@ -0,0 +1,10 @@
+//go:build !amd64
+// +build !amd64
+
+package main
+
+func checkAVX512() error {
+	return errLoadUnsupported
+}
+
+func fmaZMM(n int) {}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/templexxx/tsc"
+	"github.com/templexxx/tsc/internal/capture"
+)
+
+// writeSample writes s to the capture file if recording.
+func (r *runner) writeSample(s capture.Sample) {
+
+	if r.capture == nil {
+		return
+	}
+	if err := r.capture.Write(s); err != nil {
+		fatalf("%v", err)
+	}
+}
+
+// replayCapture replays the capture file in path (recorded by -record):
+// deltas are made by the recorded (tsc, sys_clock) samples with the calibration in effect at that time.
+//
+// With -cmp_drift, the quadratic model takes the tsc when the calibration is applied as the base
+// (the first sample's tsc for the calibration at the start).
+func replayCapture(path string, outs []string) (*runner, error) {
+
+	h, samples, err := capture.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if h.Tool != "longdrift" {
+		return nil, fmt.Errorf("%w: recorded by %s, but not longdrift", capture.ErrInvalidCapture, h.Tool)
+	}
+
+	threads, rounds := 0, 0
+	for _, s := range samples {
+		if s.Thread < 0 || s.Round < 0 {
+			return nil, fmt.Errorf("%w: negative thread or round: %+v", capture.ErrInvalidCapture, s)
+		}
+		if s.Calibration == nil {
+			threads, rounds = max(threads, s.Thread+1), max(rounds, s.Round+1)
+		}
+	}
+	if threads == 0 {
+		return nil, fmt.Errorf("%w: no samples", capture.ErrInvalidCapture)
+	}
+
+	fmt.Printf("replay: %s, job start at: %s\n", path, time.Unix(0, h.Start).Format(time.RFC3339Nano))
+	fmt.Printf("testing with options:%s\n", optionsString(h.Options))
+	c := h.Calibration
+	fmt.Printf("cpu: %s, begin with tsc_freq: %.16f(coeff: %.16f), offset: %d\n", h.CPU, c.Frequency, c.Coeff, c.Offset)
+
+	profiles, err := parseLoads(h.Options["load"], h.Options["idle"] != "false")
+	if err != nil || rounds < len(profiles) {
+		profiles = []string{"unknown"} // Recorded by another version.
+	}
+	cfg := Config{JobTime: int64(rounds), Print: *printDetails, Threads: threads, Loads: profiles}
+	r := &runner{cfg: &cfg, deltas: makeDeltas(threads, rounds), phases: phasesOf(profiles, rounds), outs: outs,
+		start: time.Unix(0, h.Start), options: h.Options, topology: h.Topology}
+	if *cmpDrift {
+		r.driftDeltas = makeDeltas(threads, rounds)
+	}
+
+	var history []tsc.Record
+	base := int64(0)
+	for _, s := range samples {
+		if s.Calibration != nil {
+			c, base = *s.Calibration, s.TSC
+			history = append(history, tsc.Record{Calibration: c})
+			continue
+		}
+		if base == 0 {
+			base = s.TSC
+		}
+		delta := fromTSC(c, s.TSC) - s.Sys
+		r.deltas[s.Thread][s.Round] = delta
+		if s.CPU != nil {
+			if r.cpus == nil {
+				r.cpus = makeCPUs(threads, rounds)
+			}
+			r.cpus[s.Thread][s.Round] = *s.CPU
+		}
+		if r.driftDeltas != nil {
+			d := float64(s.TSC - base)
+			r.driftDeltas[s.Thread][s.Round] = fromTSC(c, base) + int64(d*c.Coeff+d*d*c.Drift) - s.Sys
+		}
+		if r.cfg.Print {
+			fmt.Printf("thread: %d, sys_clock: %d, tsc: %d, delta: %.2fus\n",
+				s.Thread, s.Sys, s.TSC, float64(delta)/float64(time.Microsecond))
+		}
+	}
+
+	r.printSummaries()
+	r.output(r.outs)
+
+	if len(history) > 1 {
+		printHistoryStats(history)
+	}
+	return r, nil
+}
+
+// fromTSC converts tsc to Unix nanoseconds by c as the calibration block does,
+// float64 offset (in Calibration.UnixNano) loses precision.
+func fromTSC(c tsc.Calibration, t int64) int64 {
+	return c.Offset + int64(float64(t)*c.Coeff)
+}
+
+// makeCPUs makes CPU IDs of deltas, all are unknown (-1).
+func makeCPUs(threads, rounds int) [][]int {
+
+	cpus := make([][]int, threads)
+	for i := range cpus {
+		cpus[i] = make([]int, rounds)
+		for j := range cpus[i] {
+			cpus[i][j] = -1
+		}
+	}
+	return cpus
+}
+
+func makeDeltas(threads, rounds int) [][]int64 {
+
+	deltas := make([][]int64, threads)
+	for i := range deltas {
+		deltas[i] = make([]int64, rounds)
+	}
+	return deltas
+}
+
+// flagValues returns all flags (set or default) by name.
+func flagValues() map[string]string {
+
+	opts := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		opts[f.Name] = f.Value.String()
+	})
+	return opts
+}
+
+// optionsString returns options in the format of " -name value" in lexicographical order.
+func optionsString(opts map[string]string) string {
+
+	names := make([]string, 0, len(opts))
+	for name := range opts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	s := ""
+	for _, name := range names {
+		s += fmt.Sprintf(" -%s %s", name, opts[name])
+	}
+	return s
+}
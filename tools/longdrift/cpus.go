@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/cpuid/v2"
+	"github.com/templexxx/tsc"
+	"github.com/templexxx/tsc/internal/affinity"
+	"github.com/templexxx/tsc/internal/capture"
+)
+
+// pinned is the CPUs which threads are pinned to (-cpus), they won't be hot-unplugged.
+var pinned []int
+
+// parseCPUs parses CPU list, e.g., "0,4,8-15".
+// Every CPU must be in allowed (the online CPUs which the process is allowed to run on, see affinity.CPUs),
+// ranges are checked before expanding.
+func parseCPUs(s string, allowed []int) ([]int, error) {
+
+	ok := make(map[int]bool, len(allowed))
+	last := -1
+	for _, c := range allowed {
+		ok[c] = true
+		last = max(last, c)
+	}
+
+	var cpus []int
+	seen := make(map[int]bool)
+	for _, r := range strings.Split(s, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(r, "-")
+		from, err := strconv.Atoi(lo)
+		if err != nil || from < 0 {
+			return nil, fmt.Errorf("invalid cpu: %s", r)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(hi); err != nil || to < from {
+				return nil, fmt.Errorf("invalid cpu range: %s", r)
+			}
+		}
+		if to > last {
+			return nil, fmt.Errorf("cpu %d isn't allowed, allowed cpus: %v", to, allowed)
+		}
+		for c := from; c <= to; c++ {
+			if !ok[c] {
+				return nil, fmt.Errorf("cpu %d isn't allowed, allowed cpus: %v", c, allowed)
+			}
+			if seen[c] {
+				return nil, fmt.Errorf("duplicated cpu: %d", c)
+			}
+			seen[c] = true
+			cpus = append(cpus, c)
+		}
+	}
+	return cpus, nil
+}
+
+// hasCPUID is true if the CPU ID could be got by RDTSCP, Linux sets it in IA32_TSC_AUX.
+var hasCPUID = runtime.GOOS == "linux" && cpuid.CPU.Has(cpuid.RDTSCP)
+
+// currentCPU returns the CPU ID by RDTSCP, -1 if unknown.
+func currentCPU() int {
+
+	if !hasCPUID {
+		return -1
+	}
+	_, aux := tsc.RDTSCP()
+	cpu, _ := tsc.AuxCPU(aux)
+	return cpu
+}
+
+// topologyOf returns the topology of CPUs which the process is allowed to run on,
+// CPUs without topology are omitted.
+func topologyOf() []capture.CPUTopology {
+
+	cpus, err := affinity.CPUs()
+	if err != nil {
+		return nil
+	}
+	var ts []capture.CPUTopology
+	for _, c := range cpus {
+		core, socket, err := affinity.Topology(c)
+		if err != nil {
+			continue
+		}
+		ts = append(ts, capture.CPUTopology{CPU: c, Core: core, Socket: socket})
+	}
+	return ts
+}
+
+// groupSummary is the summary of deltas (ns) sampled on a group of CPUs: a physical core or a socket.
+type groupSummary struct {
+	Group    string  `json:"group"`
+	CPUs     []int   `json:"cpus"`
+	Samples  int     `json:"samples"`
+	Mean     float64 `json:"mean"` // Mean of deltas, a socket whose TSC isn't synced has a different one.
+	MaxAbs   float64 `json:"max_abs"`
+	DriftPPM float64 `json:"drift_ppm"`
+}
+
+// cpuSummaries returns summaries of deltas grouped by physical core & by socket,
+// nil if CPU IDs or topology are unknown.
+func (r *runner) cpuSummaries() []groupSummary {
+
+	if r.cpus == nil || len(r.topology) == 0 {
+		return nil
+	}
+	topo := make(map[int]capture.CPUTopology, len(r.topology))
+	for _, t := range r.topology {
+		topo[t.CPU] = t
+	}
+
+	// Core is -1 for a socket.
+	type key struct{ socket, core int }
+	type group struct {
+		cpus   map[int]bool
+		xs, ys []float64 // Second & delta.
+	}
+	groups := make(map[key]*group)
+	var keys []key
+	add := func(k key, cpu, second int, delta int64) {
+		g, ok := groups[k]
+		if !ok {
+			g = &group{cpus: make(map[int]bool)}
+			groups[k] = g
+			keys = append(keys, k)
+		}
+		g.cpus[cpu] = true
+		g.xs, g.ys = append(g.xs, float64(second)), append(g.ys, float64(delta))
+	}
+	for thread, cpus := range r.cpus {
+		for i, c := range cpus {
+			t, ok := topo[c]
+			if c < 0 || !ok {
+				continue
+			}
+			add(key{t.Socket, t.Core}, c, i+1, r.deltas[thread][i])
+			add(key{t.Socket, -1}, c, i+1, r.deltas[thread][i])
+		}
+	}
+	// Cores first, then sockets.
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if (a.core < 0) != (b.core < 0) {
+			return b.core < 0
+		}
+		if a.socket != b.socket {
+			return a.socket < b.socket
+		}
+		return a.core < b.core
+	})
+
+	sums := make([]groupSummary, 0, len(keys))
+	for _, k := range keys {
+		g := groups[k]
+		s := groupSummary{Group: fmt.Sprintf("socket %d core %d", k.socket, k.core), Samples: len(g.ys)}
+		if k.core < 0 {
+			s.Group = fmt.Sprintf("socket %d", k.socket)
+		}
+		for c := range g.cpus {
+			s.CPUs = append(s.CPUs, c)
+		}
+		sort.Ints(s.CPUs)
+		for _, y := range g.ys {
+			s.Mean += y
+			s.MaxAbs = math.Max(s.MaxAbs, math.Abs(y))
+		}
+		s.Mean /= float64(len(g.ys))
+		s.DriftPPM = fitSlope(g.xs, g.ys) / float64(time.Second) * 1e6
+		sums = append(sums, s)
+	}
+	return sums
+}
+
+func printGroupSummary(s groupSummary) {
+
+	cpus := make([]string, len(s.CPUs))
+	for i, c := range s.CPUs {
+		cpus[i] = strconv.Itoa(c)
+	}
+	us := func(ns float64) float64 { return ns / float64(time.Microsecond) }
+	fmt.Printf("[%s] cpus: %s, samples: %d, delta: mean: %.2fus, max(abs): %.2fus, drift: %.3fppm\n",
+		s.Group, strings.Join(cpus, ","), s.Samples, us(s.Mean), us(s.MaxAbs), s.DriftPPM)
+}
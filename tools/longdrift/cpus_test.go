@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCPUs(t *testing.T) {
+
+	allowed := []int{0, 1, 2, 3, 4, 8, 9, 10, 11, 12, 13, 14, 15}
+	for _, c := range []struct {
+		s   string
+		exp []int
+	}{
+		{"", nil},
+		{" , ", nil},
+		{"0", []int{0}},
+		{"0,4,8-15", []int{0, 4, 8, 9, 10, 11, 12, 13, 14, 15}},
+		{" 3 , 1-2 ", []int{3, 1, 2}},
+	} {
+		act, err := parseCPUs(c.s, allowed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(act, c.exp) {
+			t.Fatalf("mismatched cpus of %q: exp: %v, got: %v", c.s, c.exp, act)
+		}
+	}
+
+	for _, c := range []struct {
+		s, err string
+	}{
+		{"a", "invalid cpu"},
+		{"-1", "invalid cpu"},
+		{"3-1", "invalid cpu range"},
+		{"1-b", "invalid cpu range"},
+		{"0,1,0", "duplicated cpu: 0"},
+		{"0-2,2", "duplicated cpu: 2"},
+		{"5", "cpu 5 isn't allowed"},                     // Offline or not allowed.
+		{"4-8", "cpu 5 isn't allowed"},                   // Hole in the range.
+		{"16", "cpu 16 isn't allowed"},                   // Beyond the allowed CPUs.
+		{"0-2147483647", "cpu 2147483647 isn't allowed"}, // Rejected before expanding.
+	} {
+		if _, err := parseCPUs(c.s, allowed); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Fatalf("%q should be rejected by %q, got: %v", c.s, c.err, err)
+		}
+	}
+
+	if _, err := parseCPUs("0", nil); err == nil {
+		t.Fatal("nothing is allowed")
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const cpuSysPath = "/sys/devices/system/cpu"
+
+// hotplugCPUs returns online CPUs which could be taken offline (cpu0 is usually not), pinned CPUs are excluded.
+func hotplugCPUs() []int {
+
+	ms, _ := filepath.Glob(filepath.Join(cpuSysPath, "cpu[0-9]*", "online"))
+	var cpus []int
+	for _, m := range ms {
+		c, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(filepath.Dir(m)), "cpu"))
+		if err != nil || slices.Contains(pinned, c) {
+			continue
+		}
+		if v, err := os.ReadFile(m); err == nil && string(bytes.TrimSpace(v)) == "1" {
+			cpus = append(cpus, c)
+		}
+	}
+	sort.Ints(cpus)
+	return cpus
+}
+
+func setOnline(cpu int, online bool) error {
+
+	v := "0"
+	if online {
+		v = "1"
+	}
+	return os.WriteFile(filepath.Join(cpuSysPath, fmt.Sprintf("cpu%d", cpu), "online"), []byte(v), 0644)
+}
+
+func checkHotplug() error {
+
+	cpus := hotplugCPUs()
+	if len(cpus) == 0 {
+		return fmt.Errorf("%w: no hot-pluggable CPU", errLoadUnsupported)
+	}
+	// cpus[0] is online, writing the current state is a no-op, but it needs the permission (root).
+	if err := setOnline(cpus[0], true); err != nil {
+		return fmt.Errorf("%w: %v", errLoadUnsupported, err)
+	}
+	return nil
+}
+
+// hotplugInterval is the duration of a CPU being offline (and then online).
+const hotplugInterval = time.Second
+
+// offlined is the CPUs taken offline by hotplug, they're brought back online by restoreHotplug.
+var offlined struct {
+	sync.Mutex
+	cpus map[int]bool
+}
+
+// restoreHotplug brings CPUs taken offline by hotplug back online.
+// It's called when hotplug returns, on SIGINT/SIGTERM and before fatal exits (see fatalf).
+func restoreHotplug() {
+
+	offlined.Lock()
+	defer offlined.Unlock()
+
+	for c := range offlined.cpus {
+		if err := setOnline(c, true); err != nil {
+			log.Printf("hotplug: restore cpu %d: %v", c, err)
+			continue
+		}
+		delete(offlined.cpus, c)
+	}
+}
+
+func setOffline(cpu int) error {
+
+	offlined.Lock()
+	defer offlined.Unlock()
+
+	if offlined.cpus == nil {
+		offlined.cpus = make(map[int]bool)
+	}
+	offlined.cpus[cpu] = true // Recorded before writing, the state may be changed even if it fails.
+	return setOnline(cpu, false)
+}
+
+func setBackOnline(cpu int) error {
+
+	offlined.Lock()
+	defer offlined.Unlock()
+
+	if err := setOnline(cpu, true); err != nil {
+		return err
+	}
+	delete(offlined.cpus, cpu)
+	return nil
+}
+
+// hotplug takes hot-pluggable CPUs offline & back online one by one,
+// the CPU is always back online when it returns (or the process is interrupted).
+func hotplug(ctx context.Context) {
+
+	defer restoreHotplug()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	go func() {
+		select {
+		case s := <-sigs:
+			fatalf("hotplug: %s", s)
+		case <-ctx.Done():
+		}
+	}()
+
+	cpus := hotplugCPUs()
+	if len(cpus) == 0 {
+		log.Print("hotplug: no online hot-pluggable CPU")
+		return
+	}
+	for i := 0; !done(ctx); i++ {
+		c := cpus[i%len(cpus)]
+		if err := setOffline(c); err != nil {
+			log.Printf("hotplug: offline cpu %d: %v", c, err)
+			return
+		}
+		sleep(ctx, hotplugInterval)
+		if err := setBackOnline(c); err != nil {
+			log.Printf("hotplug: online cpu %d: %v", c, err)
+			return
+		}
+		sleep(ctx, hotplugInterval)
+	}
+}
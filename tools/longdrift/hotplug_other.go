@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "context"
+
+func checkHotplug() error {
+	return errLoadUnsupported
+}
+
+func hotplug(ctx context.Context) {}
+
+func restoreHotplug() {}
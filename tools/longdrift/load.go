@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/cpuid/v2"
+)
+
+// Load profiles (-load), each one runs until the context is done.
+const (
+	loadIdle    = "idle"
+	loadSpin    = "spin"
+	loadAVX512  = "avx512"
+	loadMemBW   = "membw"
+	loadSyscall = "syscall"
+	loadHotplug = "hotplug"
+)
+
+var errLoadUnsupported = errors.New("unsupported on this machine")
+
+// load is a load generator.
+type load struct {
+	// check returns error if the load can't run on this machine, nil means it's always available.
+	check func() error
+	// run blocks until ctx is done and the load is stopped.
+	run func(ctx context.Context)
+}
+
+var loads = map[string]load{
+	loadIdle:    {run: func(ctx context.Context) { <-ctx.Done() }},
+	loadSpin:    {run: spin},
+	loadAVX512:  {check: checkAVX512, run: avx512},
+	loadMemBW:   {run: memBW},
+	loadSyscall: {run: syscallStorm},
+	loadHotplug: {check: checkHotplug, run: hotplug},
+}
+
+// parseLoads parses comma-separated load profiles, empty s means idle (or spin with -idle=false).
+func parseLoads(s string, idle bool) ([]string, error) {
+
+	var ps []string
+	for _, p := range strings.Split(s, ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if _, ok := loads[p]; !ok {
+			return nil, fmt.Errorf("unknown load profile: %s", p)
+		}
+		ps = append(ps, p)
+	}
+	if len(ps) == 0 {
+		if idle {
+			return []string{loadIdle}, nil
+		}
+		return []string{loadSpin}, nil
+	}
+	return ps, nil
+}
+
+// checkLoads checks whether profiles could run on this machine.
+func checkLoads(profiles []string) error {
+
+	for _, p := range profiles {
+		if check := loads[p].check; check != nil {
+			if err := check(); err != nil {
+				return fmt.Errorf("load profile %s: %w", p, err)
+			}
+		}
+	}
+	return nil
+}
+
+// phase is the rounds [From, To) running under the load profile.
+type phase struct {
+	Load string `json:"load"`
+	From int    `json:"from"`
+	To   int    `json:"to"`
+}
+
+// phasesOf splits rounds into phases evenly in the order of profiles,
+// the last one takes the remainder.
+func phasesOf(profiles []string, rounds int) []phase {
+
+	n := rounds / len(profiles)
+	phases := make([]phase, len(profiles))
+	for i, p := range profiles {
+		phases[i] = phase{Load: p, From: i * n, To: (i + 1) * n}
+	}
+	phases[len(phases)-1].To = rounds
+	return phases
+}
+
+// workers runs fn on every CPU, and waits for all of them returning.
+func workers(ctx context.Context, fn func(ctx context.Context)) {
+
+	var wg sync.WaitGroup
+	wg.Add(runtime.NumCPU())
+	for i := 0; i < runtime.NumCPU(); i++ {
+		go func() {
+			defer wg.Done()
+			fn(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func done(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// sleep sleeps du or until ctx is done.
+func sleep(ctx context.Context, du time.Duration) {
+
+	t := time.NewTimer(du)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
+
+// spin runs empty loops for about 1/5 second then sleeps a second on every CPU.
+func spin(ctx context.Context) {
+
+	hz := cpuid.CPU.Hz
+	if hz == 0 {
+		hz = 3 * 1000 * 1000 * 1000 // Assume 3GHz.
+	}
+
+	workers(ctx, func(ctx context.Context) {
+		for !done(ctx) {
+			// Empty loop may cost about 5 uops.
+			for j := 0; j < int(hz/5); j++ {
+			}
+			sleep(ctx, time.Second)
+		}
+	})
+}
+
+// avx512 runs 512-bit FMA on every CPU, heavy AVX-512 instructions may change the frequency license of cores.
+func avx512(ctx context.Context) {
+
+	workers(ctx, func(ctx context.Context) {
+		for !done(ctx) {
+			fmaZMM(1 << 20)
+		}
+	})
+}
+
+// memBWSize is the buffer size of each membw worker, it's much bigger than LLC.
+const memBWSize = 64 << 20
+
+// memBW saturates memory bandwidth by copying buffers on every CPU.
+func memBW(ctx context.Context) {
+
+	workers(ctx, func(ctx context.Context) {
+		src, dst := make([]byte, memBWSize), make([]byte, memBWSize)
+		for i := range src {
+			src[i] = byte(i)
+		}
+		for !done(ctx) {
+			copy(dst, src)
+			src, dst = dst, src
+		}
+	})
+}
+
+// syscallStorm makes syscalls on every CPU as fast as possible,
+// kernel entries & exits hurt the timing of both vDSO & tsc reading.
+func syscallStorm(ctx context.Context) {
+
+	workers(ctx, func(ctx context.Context) {
+		for !done(ctx) {
+			for j := 0; j < 1024; j++ {
+				_ = os.Getppid()
+			}
+		}
+	})
+}
+
+// runPhase runs the load of p with job loops of all threads in p.
+func (r *runner) runPhase(p phase) {
+
+	fmt.Printf("load: %s, seconds: %d-%d\n", p.Load, p.From+1, p.To)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		loads[p.Load].run(ctx)
+		close(stopped)
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(r.cfg.Threads)
+	for i := 0; i < r.cfg.Threads; i++ {
+		go func(i int) {
+			defer wg.Done()
+			r.doJobLoop(i, p.From, p.To)
+		}(i)
+	}
+	wg.Wait()
+	cancel()
+	<-stopped
+}
+
+// phaseSummaries returns summaries of every series in each phase (named "<series> @<load>"),
+// nil if there is only one phase.
+func (r *runner) phaseSummaries() []summary {
+
+	if len(r.phases) < 2 {
+		return nil
+	}
+	var sums []summary
+	for _, p := range r.phases {
+		for _, s := range r.series() {
+			sums = append(sums, summarize(s.Name+" @"+p.Load, s.Deltas[p.From:p.To]))
+		}
+	}
+	return sums
+}
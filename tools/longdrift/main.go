@@ -7,31 +7,34 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	"math"
-	"runtime"
-	"sync"
+	"strings"
 	"time"
 
-	"gonum.org/v1/plot"
-	"gonum.org/v1/plot/plotter"
-	"gonum.org/v1/plot/plotutil"
-	"gonum.org/v1/plot/vg"
-
-	"github.com/klauspost/cpuid/v2"
 	"github.com/templexxx/cpu"
 	"github.com/templexxx/tsc"
+	"github.com/templexxx/tsc/internal/affinity"
+	"github.com/templexxx/tsc/internal/capture"
 )
 
 var (
 	jobTime           = flag.Int64("job_time", 1200, "unit: seconds")
 	enableCalibrate   = flag.Bool("enable_calibrate", false, "enable calibrate will help to catch up system clock")
 	calibrateInterval = flag.Int64("calibrate_interval", 300, "unit: seconds")
-	idle              = flag.Bool("idle", true, "if false it will run empty loops on each cores, try to simulate a busy cpu")
+	idle              = flag.Bool("idle", true, "if false it will run empty loops on each cores, try to simulate a busy cpu (same as -load=spin)")
+	loadProfiles      = flag.String("load", "", "comma-separated load profiles run in turn (job_time is split evenly): idle, spin, avx512, membw, syscall & hotplug (empty means idle, or spin with -idle=false)")
 	printDetails      = flag.Bool("print", false, "print every second delta & calibrate result")
 	threads           = flag.Int("threads", 1, "try to run comparing on multi cores")
+	cpuList           = flag.String("cpus", "", "pin threads to CPUs (Linux only), one thread for each CPU (overrides -threads), e.g., 0,4,8-15")
 	coeff             = flag.Float64("coeff", 0, "coefficient for tsc: tsc_register * coeff + offset = timestamp")
 	cmpsys            = flag.Bool("cmp_sys", false, "compare two system clock")
 	inOrder           = flag.Bool("in_order", false, "get tsc register in-order (with lfence)")
+	cmpDrift          = flag.Bool("cmp_drift", false, "compare linear & quadratic (drift compensation) model with the same tsc, "+
+		"drift is estimated from calibrations, so enable_calibrate is needed")
+	record      = flag.String("record", "", "record (tsc, sys_clock) samples & calibrations to the capture file")
+	replay      = flag.String("replay", "", "replay the capture file instead of running (tsc isn't needed)")
+	maxAbsDelta = flag.Duration("max_abs_delta", 0, "fail (exit with 1) if any abs delta is bigger than it, e.g., 10us (0 means no limit)")
+	maxP99      = flag.Duration("max_p99", 0, "fail (exit with 1) if p99 of abs deltas is bigger than it, e.g., 5us (0 means no limit)")
+	out         = flag.String("out", outPNG, "comma-separated outputs of deltas: png, svg, pdf (time series & histogram charts), csv & json (raw deltas)")
 )
 
 type Config struct {
@@ -42,6 +45,8 @@ type Config struct {
 	Print             bool
 	Threads           int
 	Coeff             float64
+	Loads             []string
+	CPUs              []int // Thread i is pinned to CPUs[i] if not empty.
 }
 
 var cmpClock func() int64
@@ -54,10 +59,44 @@ func tscClock() int64 {
 	return tsc.UnixNano()
 }
 
+// fatalf is log.Fatalf in the job, it restores the machine state (e.g., CPUs taken offline by -load=hotplug) first.
+func fatalf(format string, v ...any) {
+	restoreHotplug()
+	log.Fatalf(format, v...)
+}
+
 func main() {
 
 	flag.Parse()
 
+	outs, err := parseOuts(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *replay != "" {
+		r, err := replayCapture(*replay, outs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		exitOnViolation(r)
+		return
+	}
+
+	if *record != "" && *cmpsys {
+		log.Fatal("nothing to record with -cmp_sys")
+	}
+	if *cmpDrift {
+		switch {
+		case !*enableCalibrate:
+			log.Fatal("-cmp_drift needs -enable_calibrate (drift is estimated from calibrations)")
+		case *cmpsys:
+			log.Fatal("-cmp_drift can't work with -cmp_sys")
+		case *inOrder:
+			log.Fatal("-cmp_drift can't work with -in_order (the models convert the same tsc read by RDTSC)")
+		}
+	}
+
 	if *cmpsys {
 		cmpClock = sysClock
 	} else {
@@ -68,6 +107,32 @@ func main() {
 		tsc.ForbidOutOfOrder()
 	}
 
+	if strings.TrimSpace(*cpuList) != "" {
+		allowed, err := affinity.CPUs()
+		if err != nil {
+			log.Fatal(err)
+		}
+		cpus, err := parseCPUs(*cpuList, allowed)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(cpus) > 0 {
+			*threads = len(cpus)
+			pinned = cpus
+		}
+	}
+
+	profiles, err := parseLoads(*loadProfiles, *idle)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = checkLoads(profiles); err != nil {
+		log.Fatal(err)
+	}
+	if *jobTime < int64(len(profiles)) {
+		log.Fatal("job_time must be >= the number of load profiles")
+	}
+
 	cfg := Config{
 		JobTime:           *jobTime,
 		EnableCalibrate:   *enableCalibrate,
@@ -75,23 +140,36 @@ func main() {
 		Idle:              *idle,
 		Print:             *printDetails,
 		Threads:           *threads,
+		Loads:             profiles,
+		CPUs:              pinned,
 	}
 
-	deltas := make([][]int64, cfg.Threads)
-	for i := range deltas {
-		deltas[i] = make([]int64, cfg.JobTime)
-	}
+	r := &runner{cfg: &cfg, deltas: makeDeltas(cfg.Threads, int(cfg.JobTime)), phases: phasesOf(profiles, int(cfg.JobTime)), outs: outs}
 
-	r := &runner{cfg: &cfg, deltas: deltas}
+	if *cmpDrift {
+		r.driftDeltas = makeDeltas(cfg.Threads, int(cfg.JobTime))
+	}
+	if hasCPUID {
+		r.cpus = makeCPUs(cfg.Threads, int(cfg.JobTime))
+		r.topology = topologyOf()
+	}
 
 	r.run()
+	exitOnViolation(r)
 }
 
 type runner struct {
-	cfg    *Config
-	deltas [][]int64
-
-	wg *sync.WaitGroup
+	cfg         *Config
+	deltas      [][]int64
+	driftDeltas [][]int64 // Deltas of quadratic model, only with -cmp_drift.
+	phases      []phase
+	cpus        [][]int // CPU ID (by RDTSCP) of every delta, -1 if unknown. nil if RDTSCP is unavailable.
+	topology    []capture.CPUTopology
+	capture     *capture.Writer
+	outs        []string
+
+	start   time.Time
+	options map[string]string
 }
 
 func (r *runner) run() {
@@ -101,23 +179,37 @@ func (r *runner) run() {
 	}
 
 	start := time.Now()
+	r.start, r.options = start, flagValues()
 	fmt.Printf("job start at: %s\n", start.Format(time.RFC3339Nano))
 
 	if *coeff != 0 {
 		tsc.CalibrateWithCoeff(*coeff)
 	}
 
-	options := ""
-	flag.VisitAll(func(f *flag.Flag) {
-		options += fmt.Sprintf(" -%s %s", f.Name, f.Value)
-	})
-
-	fmt.Printf("testing with options:%s\n", options)
+	fmt.Printf("testing with options:%s\n", optionsString(r.options))
 	cpuFlag := fmt.Sprintf("%s_%d", cpu.X86.Signature, cpu.X86.SteppingID)
 
 	ooffset, ocoeff := tsc.LoadOffsetCoeff(tsc.OffsetCoeffAddr)
 
 	fmt.Printf("cpu: %s, begin with tsc_freq: %.16f(coeff: %.16f), offset: %d\n", cpuFlag, 1e9/ocoeff, ocoeff, ooffset)
+	for i, c := range r.cfg.CPUs {
+		fmt.Printf("thread-%d is pinned to cpu %d\n", i, c)
+	}
+
+	if *record != "" {
+		w, err := capture.Create(*record, capture.Header{
+			Tool:        "longdrift",
+			CPU:         cpuFlag,
+			Start:       start.UnixNano(),
+			Options:     r.options,
+			Calibration: tsc.Current(),
+			Topology:    r.topology,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		r.capture = w
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -138,6 +230,10 @@ func (r *runner) run() {
 					originFreq := 1e9 / ocoeff
 					tsc.Calibrate()
 					_, ocoeff = tsc.LoadOffsetCoeff(tsc.OffsetCoeffAddr)
+					if r.capture != nil {
+						c := tsc.Current()
+						r.writeSample(capture.Sample{TSC: tsc.RDTSC(), Calibration: &c})
+					}
 					if *printDetails {
 						fmt.Printf("origin tsc_freq: %.16f, new_tsc_freq: %.16f\n", originFreq, 1e9/ocoeff)
 					}
@@ -148,90 +244,94 @@ func (r *runner) run() {
 		}(ctx)
 	}
 
-	go takeCPU(ctx, r.cfg.Idle)
-
-	wg := new(sync.WaitGroup)
-	wg.Add(r.cfg.Threads)
-	r.wg = wg
-
-	for i := 0; i < r.cfg.Threads; i++ {
-		go func(i int) {
-			r.doJobLoop(i)
-		}(i)
+	for _, p := range r.phases {
+		r.runPhase(p)
 	}
-	wg.Wait()
 	cancel()
 
+	r.printSummaries()
+
 	cost := time.Now().Sub(start)
 	fmt.Printf("job taken: %s\n", cost.String())
 
-	r.printDeltas()
-}
-
-func takeCPU(ctx context.Context, idle bool) {
-
-	if idle {
-		return
+	if r.capture != nil {
+		if err := r.capture.Close(); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	cnt := runtime.NumCPU()
+	r.output(r.outs)
 
-	hz := cpuid.CPU.Hz
-	if hz == 0 {
-		hz = 3 * 1000 * 1000 * 1000 // Assume 3GHz.
+	if r.cfg.EnableCalibrate {
+		printHistoryStats(tsc.History())
 	}
+}
 
-	for i := 0; i < cnt; i++ {
-		go func(ctx context.Context) {
-			ctx2, cancel := context.WithCancel(ctx)
-			defer cancel()
-
-			for {
-				select {
-				case <-ctx2.Done():
-					return
-				default:
-				}
-
-				// Empty loop may cost about 5 uops.
-				for j := 0; j < int(hz/5); j++ {
-				}
-				time.Sleep(time.Second)
-			}
+func printHistoryStats(records []tsc.Record) {
 
-		}(ctx)
+	s := tsc.StatsOf(records)
+	fmt.Printf("calibrations: %d in %s, freq stability: %.4fppm, freq range: %.4fppm, offset jump(abs): mean: %.2fus, max: %.2fus\n",
+		s.Records, s.Span,
+		s.FreqStability, s.FreqRange,
+		float64(s.MeanOffsetJump)/float64(time.Microsecond), float64(s.MaxOffsetJump)/float64(time.Microsecond))
+	for _, p := range s.Allan {
+		fmt.Printf("allan deviation: tau: %s, adev: %.3g\n", p.Tau, p.Deviation)
 	}
 }
 
-func (r *runner) doJobLoop(thread int) {
-	defer r.wg.Done()
+// doJobLoop compares clocks of rounds [from, to) in thread.
+func (r *runner) doJobLoop(thread, from, to int) {
 
-	minDelta, minDeltaABS := int64(0), math.MaxFloat64
-	maxDelta, maxDeltaABS := int64(0), float64(0)
+	if len(r.cfg.CPUs) > 0 {
+		// The goroutine is locked to its thread, and the thread will be terminated after returning.
+		if err := affinity.Pin(r.cfg.CPUs[thread]); err != nil {
+			fatalf("failed to pin thread-%d to cpu %d: %v", thread, r.cfg.CPUs[thread], err)
+		}
+	}
 
 	cmpTo := "tsc"
 	if *cmpsys {
 		cmpTo = "sys_clock2"
 	}
 
-	for i := 0; i < int(r.cfg.JobTime); i++ {
+	for i := from; i < to; i++ {
 
 		time.Sleep(time.Second)
+
+		cpu0 := currentCPU()
+
+		if r.driftDeltas != nil {
+			tsc0 := tsc.RDTSC()
+			sysClock := time.Now().UnixNano()
+			tsc1 := tsc.RDTSC()
+			cpuID := r.setCPU(thread, i, cpu0)
+			raw := tsc0 + (tsc1-tsc0)/2
+			delta := tsc.FromTSC(raw) - sysClock
+			driftDelta := tsc.FromTSCWithDrift(raw) - sysClock
+			r.deltas[thread][i] = delta
+			r.driftDeltas[thread][i] = driftDelta
+			r.writeSample(capture.Sample{Thread: thread, Round: i, TSC: raw, Sys: sysClock, MinDelta: tsc1 - tsc0, CPU: cpuID})
+
+			if r.cfg.Print {
+				fmt.Printf("thread: %d, sys_clock: %d, tsc: %d, linear_delta: %.2fus, quadratic_delta: %.2fus\n",
+					thread, sysClock, raw, float64(delta)/float64(time.Microsecond), float64(driftDelta)/float64(time.Microsecond))
+			}
+			continue
+		}
+
 		clock2 := cmpClock()
 		sysClock := time.Now().UnixNano()
 		clock22 := cmpClock()
+		cpuID := r.setCPU(thread, i, cpu0)
 		delta := (clock2+clock22)/2 - sysClock
 		delta2 := clock22 - sysClock
 		r.deltas[thread][i] = delta
 
-		deltaABS := math.Abs(float64(delta))
-		if deltaABS < minDeltaABS {
-			minDeltaABS = deltaABS
-			minDelta = delta
-		}
-		if deltaABS > maxDeltaABS {
-			maxDeltaABS = deltaABS
-			maxDelta = delta
+		if r.capture != nil {
+			tsc0 := tsc.RDTSC()
+			sys := time.Now().UnixNano()
+			tsc1 := tsc.RDTSC()
+			r.writeSample(capture.Sample{Thread: thread, Round: i, TSC: tsc0 + (tsc1-tsc0)/2, Sys: sys, MinDelta: tsc1 - tsc0, CPU: cpuID})
 		}
 
 		if r.cfg.Print {
@@ -239,57 +339,30 @@ func (r *runner) doJobLoop(thread int) {
 				thread, sysClock, cmpTo, clock2, float64(delta)/float64(time.Microsecond), float64(delta2)/float64(time.Microsecond))
 		}
 	}
-
-	totalDelta := float64(0)
-	for _, delta := range r.deltas[thread] {
-		totalDelta += math.Abs(float64(delta))
-	}
-	avgDelta := totalDelta / float64(r.cfg.JobTime)
-
-	fmt.Printf("[thread-%d] delta(abs): first: %.2fus, last: %.2fus, min: %.2fus, max: %.2fus, mean: %.2fus\n",
-		thread,
-		math.Abs(float64(r.deltas[thread][0])/float64(time.Microsecond)),
-		math.Abs(float64(r.deltas[thread][r.cfg.JobTime-1])/float64(time.Microsecond)),
-		math.Abs(float64(minDelta)/float64(time.Microsecond)),
-		math.Abs(float64(maxDelta)/float64(time.Microsecond)),
-		avgDelta/1000)
 }
 
-var outTmFmt = "2006-01-02T150405"
-
-func (r *runner) printDeltas() {
+// setCPU sets the CPU of delta i in thread as cpu0 (got before sampling) if it's still on cpu0,
+// and returns it (nil if unknown).
+func (r *runner) setCPU(thread, i, cpu0 int) *int {
 
-	p := plot.New()
-
-	cmpTo := "TSC"
-	if *cmpsys {
-		cmpTo = "Syc Clock2"
+	if r.cpus == nil || cpu0 < 0 || currentCPU() != cpu0 {
+		return nil
 	}
+	r.cpus[thread][i] = cpu0
+	return &cpu0
+}
 
-	p.Title.Text = fmt.Sprintf("%s - Sys Clock", cmpTo)
-	p.X.Label.Text = "Time(s)"
-	p.Y.Label.Text = "Delta(us)"
+// printSummaries prints summaries of all series, of each load phase if there are multiple phases,
+// and of each physical core & socket if CPU IDs are known.
+func (r *runner) printSummaries() {
 
-	for i := range r.deltas {
-		err := plotutil.AddLinePoints(p,
-			fmt.Sprintf("thread: %d", i),
-			makePoints(r.deltas[i]))
-		if err != nil {
-			panic(err)
-		}
+	for _, s := range r.series() {
+		printSummary(summarize(s.Name, s.Deltas))
 	}
-
-	if err := p.Save(10*vg.Inch, 10*vg.Inch, fmt.Sprintf("longdrift_%s.PNG", time.Now().Format(outTmFmt))); err != nil {
-		panic(err)
+	for _, s := range r.phaseSummaries() {
+		printSummary(s)
 	}
-}
-
-func makePoints(deltas []int64) plotter.XYs {
-	points := make(plotter.XYs, len(deltas))
-	for i := range points {
-		points[i].X = float64(i) + 1
-		points[i].Y = float64(deltas[i]) / float64(time.Microsecond)
+	for _, s := range r.cpuSummaries() {
+		printGroupSummary(s)
 	}
-
-	return points
 }
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+)
+
+// Outputs (-out), charts are time series & histogram of deltas.
+const (
+	outPNG  = "png"
+	outSVG  = "svg"
+	outPDF  = "pdf"
+	outCSV  = "csv"
+	outJSON = "json"
+)
+
+// parseOuts parses comma-separated outputs.
+func parseOuts(s string) ([]string, error) {
+
+	var outs []string
+	for _, o := range strings.Split(s, ",") {
+		o = strings.ToLower(strings.TrimSpace(o))
+		switch o {
+		case "":
+			continue
+		case outPNG, outSVG, outPDF, outCSV, outJSON:
+			outs = append(outs, o)
+		default:
+			return nil, fmt.Errorf("unknown output: %s", o)
+		}
+	}
+	return outs, nil
+}
+
+// series is deltas (ns) of each second.
+type series struct {
+	Name   string  `json:"name"`
+	Deltas []int64 `json:"deltas"`
+	thread int
+}
+
+// series returns all series: a series for each thread (two with -cmp_drift: linear & quadratic).
+func (r *runner) series() []series {
+
+	ss := make([]series, 0, len(r.deltas)+len(r.driftDeltas))
+	for i := range r.deltas {
+		if r.driftDeltas != nil {
+			ss = append(ss, series{Name: fmt.Sprintf("thread-%d linear", i), Deltas: r.deltas[i], thread: i})
+			ss = append(ss, series{Name: fmt.Sprintf("thread-%d quadratic", i), Deltas: r.driftDeltas[i], thread: i})
+			continue
+		}
+		ss = append(ss, series{Name: fmt.Sprintf("thread-%d", i), Deltas: r.deltas[i], thread: i})
+	}
+	return ss
+}
+
+var outTmFmt = "2006-01-02T150405"
+
+// output writes deltas to files in outs: longdrift_<time>.<ext> (and longdrift_<time>_hist.<ext> for charts).
+func (r *runner) output(outs []string) {
+
+	name := fmt.Sprintf("longdrift_%s", time.Now().Format(outTmFmt))
+	for _, o := range outs {
+		var err error
+		switch o {
+		case outPNG:
+			err = r.plotDeltas(name, "PNG") // Keep the upper case for old charts.
+		case outSVG, outPDF:
+			err = r.plotDeltas(name, o)
+		case outCSV:
+			err = r.writeCSV(name + ".csv")
+		case outJSON:
+			err = r.writeJSON(name + ".json")
+		}
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (r *runner) title() string {
+
+	if r.driftDeltas != nil {
+		return "TSC(linear & quadratic) - Sys Clock"
+	}
+	cmpTo := "TSC"
+	if *cmpsys {
+		cmpTo = "Syc Clock2"
+	}
+	return fmt.Sprintf("%s - Sys Clock", cmpTo)
+}
+
+// plotDeltas plots time series & histogram of deltas.
+func (r *runner) plotDeltas(name, ext string) error {
+
+	p := plot.New()
+	p.Title.Text = r.title()
+	p.X.Label.Text = "Time(s)"
+	p.Y.Label.Text = "Delta(us)"
+
+	h := plot.New()
+	h.Title.Text = r.title() + " Distribution"
+	h.X.Label.Text = "Delta(us)"
+	h.Y.Label.Text = "Count"
+
+	for i, s := range r.series() {
+		legend := strings.Replace(s.Name, "thread-", "thread: ", 1)
+		if err := plotutil.AddLinePoints(p, legend, makePoints(s.Deltas)); err != nil {
+			return err
+		}
+
+		vs := make(plotter.Values, len(s.Deltas))
+		for j, d := range s.Deltas {
+			vs[j] = float64(d) / float64(time.Microsecond)
+		}
+		hist, err := plotter.NewHist(vs, min(histBins, len(vs)))
+		if err != nil {
+			return err
+		}
+		hist.FillColor = nil
+		hist.LineStyle.Color = plotutil.Color(i)
+		h.Add(hist)
+		h.Legend.Add(legend, hist)
+	}
+
+	if err := p.Save(10*vg.Inch, 10*vg.Inch, name+"."+ext); err != nil {
+		return err
+	}
+	return h.Save(10*vg.Inch, 10*vg.Inch, name+"_hist."+ext)
+}
+
+const histBins = 64
+
+func makePoints(deltas []int64) plotter.XYs {
+	points := make(plotter.XYs, len(deltas))
+	for i := range points {
+		points[i].X = float64(i) + 1
+		points[i].Y = float64(deltas[i]) / float64(time.Microsecond)
+	}
+
+	return points
+}
+
+// writeCSV writes deltas in long format, each row is: series,second,delta_ns,load,cpu (-1 if unknown).
+func (r *runner) writeCSV(path string) error {
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	_ = w.Write([]string{"series", "second", "delta_ns", "load", "cpu"})
+	for _, s := range r.series() {
+		for _, p := range r.phases {
+			for i := p.From; i < p.To; i++ {
+				cpu := -1
+				if r.cpus != nil {
+					cpu = r.cpus[s.thread][i]
+				}
+				_ = w.Write([]string{s.Name, strconv.Itoa(i + 1), strconv.FormatInt(s.Deltas[i], 10), p.Load, strconv.Itoa(cpu)})
+			}
+		}
+	}
+	w.Flush()
+	if err = w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// deltasOutput is the JSON output.
+type deltasOutput struct {
+	Start     int64             `json:"start"` // Unix nanoseconds.
+	Options   map[string]string `json:"options"`
+	Phases    []phase           `json:"phases"` // Rounds are seconds (from 0) in series.
+	Series    []series          `json:"series"`
+	Summaries []summary         `json:"summaries"` // In ns.
+	// PhaseSummaries are summaries of every series in each phase (named "<series> @<load>"),
+	// only if there are multiple phases.
+	PhaseSummaries []summary `json:"phase_summaries,omitempty"`
+	// CPUs is the CPU ID (by RDTSCP) of every delta of each thread, -1 if unknown.
+	CPUs [][]int `json:"cpus,omitempty"`
+	// CPUSummaries are summaries of deltas on each physical core & socket.
+	CPUSummaries []groupSummary `json:"cpu_summaries,omitempty"`
+}
+
+func (r *runner) writeJSON(path string) error {
+
+	ss := r.series()
+	out := deltasOutput{Start: r.start.UnixNano(), Options: r.options, Phases: r.phases, Series: ss,
+		Summaries: make([]summary, len(ss)), PhaseSummaries: r.phaseSummaries(), CPUs: r.cpus, CPUSummaries: r.cpuSummaries()}
+	for i, s := range ss {
+		out.Summaries[i] = summarize(s.Name, s.Deltas)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(out); err != nil {
+		return err
+	}
+	return f.Close()
+}
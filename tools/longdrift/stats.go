@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// summary is the statistics of a series of deltas (ns),
+// all fields are of abs deltas except StdDev & DriftPPM which are of deltas.
+type summary struct {
+	Name   string  `json:"name"`
+	First  float64 `json:"first"`
+	Last   float64 `json:"last"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Mean   float64 `json:"mean"`
+	P50    float64 `json:"p50"`
+	P90    float64 `json:"p90"`
+	P99    float64 `json:"p99"`
+	P999   float64 `json:"p99_9"`
+	StdDev float64 `json:"stddev"`
+	// DriftPPM is the slope of deltas (least squares), it's how fast tsc drifts away from system clock.
+	DriftPPM float64 `json:"drift_ppm"`
+}
+
+func summarize(name string, deltas []int64) summary {
+
+	s := summary{Name: name}
+	if len(deltas) == 0 {
+		return s
+	}
+
+	abs := make([]float64, len(deltas))
+	mean, absMean := float64(0), float64(0)
+	for i, d := range deltas {
+		abs[i] = math.Abs(float64(d))
+		mean += float64(d)
+		absMean += abs[i]
+	}
+	n := float64(len(deltas))
+	mean /= n
+
+	variance := float64(0)
+	for _, d := range deltas {
+		variance += (float64(d) - mean) * (float64(d) - mean)
+	}
+
+	s.First, s.Last = abs[0], abs[len(abs)-1]
+	s.Mean = absMean / n
+	s.StdDev = math.Sqrt(variance / n)
+	s.DriftPPM = slope(deltas) / float64(time.Second) * 1e6
+
+	sort.Float64s(abs)
+	s.Min, s.Max = abs[0], abs[len(abs)-1]
+	s.P50 = percentile(abs, 50)
+	s.P90 = percentile(abs, 90)
+	s.P99 = percentile(abs, 99)
+	s.P999 = percentile(abs, 99.9)
+	return s
+}
+
+// slope returns the slope (ns per second) of deltas which are sampled every second.
+func slope(deltas []int64) float64 {
+
+	xs, ys := make([]float64, len(deltas)), make([]float64, len(deltas))
+	for i, d := range deltas {
+		xs[i], ys[i] = float64(i), float64(d)
+	}
+	return fitSlope(xs, ys)
+}
+
+// fitSlope returns the slope of ys over xs (least squares), 0 if it can't be fitted.
+func fitSlope(xs, ys []float64) float64 {
+
+	n := float64(len(xs))
+	if n < 2 {
+		return 0
+	}
+	xm, ym := float64(0), float64(0)
+	for i := range xs {
+		xm += xs[i]
+		ym += ys[i]
+	}
+	xm, ym = xm/n, ym/n
+
+	num, den := float64(0), float64(0)
+	for i := range xs {
+		num += (xs[i] - xm) * (ys[i] - ym)
+		den += (xs[i] - xm) * (xs[i] - xm)
+	}
+	if den == 0 {
+		return 0
+	}
+	return num / den
+}
+
+// percentile returns the p-th percentile of sorted values (nearest-rank method).
+func percentile(sorted []float64, p float64) float64 {
+
+	// The epsilon keeps float error (e.g., 99.9 / 100 * 1000 = 999.0000000000001) from pushing the rank up.
+	i := int(math.Ceil(p/100*float64(len(sorted))-1e-9)) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+func printSummary(s summary) {
+
+	us := func(ns float64) float64 { return ns / float64(time.Microsecond) }
+
+	fmt.Printf("[%s] delta(abs): first: %.2fus, last: %.2fus, min: %.2fus, max: %.2fus, mean: %.2fus, "+
+		"p50: %.2fus, p90: %.2fus, p99: %.2fus, p99.9: %.2fus, stddev: %.2fus, drift: %.3fppm\n",
+		s.Name, us(s.First), us(s.Last), us(s.Min), us(s.Max), us(s.Mean),
+		us(s.P50), us(s.P90), us(s.P99), us(s.P999), us(s.StdDev), s.DriftPPM)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// seq returns sorted [1, n].
+func seq(n int) []float64 {
+
+	fs := make([]float64, n)
+	for i := range fs {
+		fs[i] = float64(i + 1)
+	}
+	return fs
+}
+
+func TestPercentile(t *testing.T) {
+
+	for _, c := range []struct {
+		n   int
+		p   float64
+		exp float64
+	}{
+		// Single value is every percentile.
+		{1, 0, 1},
+		{1, 50, 1},
+		{1, 99.9, 1},
+		{1, 100, 1},
+
+		{4, 0, 1},   // Rank 0 is clamped to the first.
+		{4, 25, 1},  // Rank 1.
+		{4, 26, 2},  // Rank ceil(1.04) = 2.
+		{4, 50, 2},  // Rank 2, no interpolation.
+		{4, 100, 4}, // Rank 4.
+
+		// p99.9 is the max with fewer than 1000 values.
+		{10, 99.9, 10},
+		{100, 99, 99},
+		{100, 99.9, 100},
+		{999, 99.9, 999},
+		{1000, 99.9, 999},
+		{1000, 99, 990},
+		{2000, 99.9, 1998},
+	} {
+		if act := percentile(seq(c.n), c.p); act != c.exp {
+			t.Fatalf("mismatched p%v of [1, %d]: exp: %v, got: %v", c.p, c.n, c.exp, act)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+
+	if s := summarize("empty", nil); s != (summary{Name: "empty"}) {
+		t.Fatalf("summary of empty deltas should be zero, got: %+v", s)
+	}
+
+	s := summarize("one", []int64{-7})
+	if s.First != 7 || s.Last != 7 || s.Min != 7 || s.Max != 7 || s.Mean != 7 ||
+		s.P50 != 7 || s.P90 != 7 || s.P99 != 7 || s.P999 != 7 || s.StdDev != 0 || s.DriftPPM != 0 {
+		t.Fatalf("mismatched summary of single delta: %+v", s)
+	}
+
+	s = summarize("mixed", []int64{-3, 1, 2, -4})
+	exp := summary{
+		Name:  "mixed",
+		First: 3, Last: 4, Min: 1, Max: 4, Mean: 2.5,
+		P50: 2, P90: 4, P99: 4, P999: 4,
+		StdDev: math.Sqrt(6.5), // Of deltas (mean -1), not of abs deltas.
+	}
+	s.DriftPPM = 0 // Checked below.
+	if s != exp {
+		t.Fatalf("mismatched summary:\nexp: %+v\ngot: %+v", exp, s)
+	}
+
+	// 1µs more every second is 1ppm.
+	deltas := make([]int64, 60)
+	for i := range deltas {
+		deltas[i] = int64(i)*1000 - 5000
+	}
+	if s = summarize("drift", deltas); math.Abs(s.DriftPPM-1) > 1e-9 {
+		t.Fatalf("drift should be 1ppm, got: %v", s.DriftPPM)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// violations checks summaries of all series against thresholds (-max_abs_delta & -max_p99, 0 means no limit).
+func (r *runner) violations() []string {
+
+	var vs []string
+	for _, s := range r.series() {
+		sum := summarize(s.Name, s.Deltas)
+		if *maxAbsDelta > 0 && sum.Max > float64(*maxAbsDelta) {
+			vs = append(vs, fmt.Sprintf("[%s] max abs delta: %s > %s", s.Name, time.Duration(sum.Max), *maxAbsDelta))
+		}
+		if *maxP99 > 0 && sum.P99 > float64(*maxP99) {
+			vs = append(vs, fmt.Sprintf("[%s] p99 abs delta: %s > %s", s.Name, time.Duration(sum.P99), *maxP99))
+		}
+	}
+	return vs
+}
+
+// exitOnViolation prints the verdict if there is any threshold,
+// and exits with 1 if the run violates thresholds.
+func exitOnViolation(r *runner) {
+
+	if *maxAbsDelta <= 0 && *maxP99 <= 0 {
+		return
+	}
+
+	var limits []string
+	if *maxAbsDelta > 0 {
+		limits = append(limits, fmt.Sprintf("max abs delta <= %s", *maxAbsDelta))
+	}
+	if *maxP99 > 0 {
+		limits = append(limits, fmt.Sprintf("p99 abs delta <= %s", *maxP99))
+	}
+
+	vs := r.violations()
+	if len(vs) == 0 {
+		fmt.Printf("verdict: PASS (%s)\n", strings.Join(limits, ", "))
+		return
+	}
+	fmt.Printf("verdict: FAIL (%s)\n", strings.Join(limits, ", "))
+	for _, v := range vs {
+		fmt.Printf("  %s\n", v)
+	}
+	os.Exit(1)
+}
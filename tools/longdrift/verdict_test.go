@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// setThresholds sets -max_abs_delta & -max_p99, they are restored after the test.
+func setThresholds(t *testing.T, maxAbs, p99 time.Duration) {
+
+	savedAbs, savedP99 := *maxAbsDelta, *maxP99
+	t.Cleanup(func() { *maxAbsDelta, *maxP99 = savedAbs, savedP99 })
+	*maxAbsDelta, *maxP99 = maxAbs, p99
+}
+
+func TestViolations(t *testing.T) {
+
+	// Abs deltas are [1, 100]: max is 100, p99 is 99.
+	deltas := make([]int64, 100)
+	for i := range deltas {
+		deltas[i] = int64(i + 1)
+		if i%2 == 0 {
+			deltas[i] = -deltas[i]
+		}
+	}
+	r := &runner{deltas: [][]int64{deltas, {1, -2, 3}}}
+
+	for _, c := range []struct {
+		name        string
+		maxAbs, p99 time.Duration
+		exp         []string
+	}{
+		{"no limit", 0, 0, nil},
+		{"at limits", 100, 99, nil}, // Thresholds are inclusive.
+		{"max abs", 99, 0, []string{"[thread-0] max abs delta: 100ns > 99ns"}},
+		{"p99", 0, 98, []string{"[thread-0] p99 abs delta: 99ns > 98ns"}},
+		{"both", 99, 98, []string{"[thread-0] max abs delta: 100ns > 99ns", "[thread-0] p99 abs delta: 99ns > 98ns"}},
+		{"all series", 2, 0, []string{"[thread-0] max abs delta: 100ns > 2ns", "[thread-1] max abs delta: 3ns > 2ns"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			setThresholds(t, c.maxAbs, c.p99)
+			if act := r.violations(); !reflect.DeepEqual(act, c.exp) {
+				t.Fatalf("mismatched violations:\nexp: %q\ngot: %q", c.exp, act)
+			}
+		})
+	}
+}
+
+// TestViolationsDrift tests the linear & quadratic series are checked separately (-cmp_drift).
+func TestViolationsDrift(t *testing.T) {
+
+	setThresholds(t, 10, 0)
+	r := &runner{deltas: [][]int64{{5, -20}}, driftDeltas: [][]int64{{5, -10}}}
+	exp := []string{"[thread-0 linear] max abs delta: 20ns > 10ns"}
+	if act := r.violations(); !reflect.DeepEqual(act, exp) {
+		t.Fatalf("mismatched violations:\nexp: %q\ngot: %q", exp, act)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/templexxx/tsc"
+	"github.com/templexxx/tsc/internal/affinity"
+)
+
+// driftInfo is the delta (tsc.UnixNano - system clock) at the start & the end of drift check.
+type driftInfo struct {
+	Duration   time.Duration `json:"duration"`
+	StartDelta int64         `json:"start_delta"` // ns.
+	EndDelta   int64         `json:"end_delta"`   // ns.
+	DriftPPM   float64       `json:"drift_ppm"`   // (EndDelta - StartDelta) / Duration.
+}
+
+func checkDrift(du time.Duration) *driftInfo {
+
+	d := &driftInfo{Duration: du}
+	d.StartDelta = delta()
+	time.Sleep(du)
+	d.EndDelta = delta()
+	d.DriftPPM = float64(d.EndDelta-d.StartDelta) / float64(du) * 1e6
+	return d
+}
+
+// delta returns tsc.UnixNano - system clock, the clock reading is in the middle.
+func delta() int64 {
+
+	t0 := tsc.UnixNano()
+	sys := time.Now().UnixNano()
+	t1 := tsc.UnixNano()
+	return t0 + (t1-t0)/2 - sys
+}
+
+// skewInfo is tsc skew of CPUs relative to Base.
+type skewInfo struct {
+	Base   int       `json:"base"`
+	CPUs   []cpuSkew `json:"cpus"`
+	MaxAbs float64   `json:"max_abs"` // Max abs Offset (ns).
+}
+
+// cpuSkew is the tsc offset (ns) of CPU relative to the base CPU: offset ± uncertainty.
+type cpuSkew struct {
+	CPU         int     `json:"cpu"`
+	Offset      float64 `json:"offset"`
+	Uncertainty float64 `json:"uncertainty"`
+}
+
+// measureSkews measures skews of all CPUs relative to the first one.
+func measureSkews(rounds int, freq frequencyInfo) (*skewInfo, error) {
+
+	cpus, err := affinity.CPUs()
+	if err != nil {
+		return nil, err
+	}
+	if len(cpus) < 2 {
+		return nil, errors.New("only one CPU")
+	}
+	if runtime.GOMAXPROCS(0) < 2 {
+		return nil, errors.New("GOMAXPROCS < 2")
+	}
+
+	hz := freq.Calibrated
+	if hz == 0 {
+		hz = float64(freq.Nominal)
+	}
+	if hz == 0 {
+		return nil, errors.New("unknown tsc frequency")
+	}
+	nsPerCycle := 1e9 / hz
+
+	s := &skewInfo{Base: cpus[0]}
+	for _, c := range cpus[1:] {
+		lower, upper, err := measureSkew(cpus[0], c, rounds)
+		if err != nil {
+			return nil, err
+		}
+		cs := cpuSkew{
+			CPU:         c,
+			Offset:      float64(lower+upper) / 2 * nsPerCycle,
+			Uncertainty: float64(upper-lower) / 2 * nsPerCycle,
+		}
+		s.CPUs = append(s.CPUs, cs)
+		s.MaxAbs = math.Max(s.MaxAbs, math.Abs(cs.Offset))
+	}
+	return s, nil
+}
+
+// measureSkew measures tsc offset (in cycles) of CPU b relative to a by ping-pong:
+// a reads t0, pings b; b reads tb, pongs a; a reads t1.
+// tb - offset is in [t0, t1], so offset is in [tb - t1, tb - t0] for every round,
+// the intersection of all rounds is [lower, upper].
+func measureSkew(a, b, rounds int) (lower, upper int64, err error) {
+
+	var ping, pong atomic.Int64
+	var failed atomic.Bool // Stop spinning if the other one failed.
+	lower, upper = math.MinInt64, math.MaxInt64
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	errs := make(chan error, 2)
+	pin := func(cpu int) bool {
+		if err := affinity.Pin(cpu); err != nil {
+			errs <- fmt.Errorf("pin cpu %d: %w", cpu, err)
+			failed.Store(true)
+			return false
+		}
+		return true
+	}
+
+	go func() {
+		defer wg.Done()
+		if !pin(b) {
+			return
+		}
+		for i := int64(1); i <= int64(rounds); i++ {
+			for ping.Load() != i {
+				if failed.Load() {
+					return
+				}
+			}
+			pong.Store(tsc.GetInOrder())
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		if !pin(a) {
+			return
+		}
+		for i := int64(1); i <= int64(rounds); i++ {
+			pong.Store(0)
+			t0 := tsc.GetInOrder()
+			ping.Store(i)
+			tb := int64(0)
+			for tb == 0 {
+				if failed.Load() {
+					return
+				}
+				tb = pong.Load()
+			}
+			t1 := tsc.GetInOrder()
+			lower, upper = max(lower, tb-t1), min(upper, tb-t0)
+		}
+	}()
+
+	wg.Wait()
+	close(errs)
+	if err = <-errs; err != nil {
+		return 0, 0, err
+	}
+	if lower > upper {
+		return 0, 0, fmt.Errorf("inconsistent skew of cpu %d: [%d, %d], tsc isn't in order", b, lower, upper)
+	}
+	return lower, upper, nil
+}
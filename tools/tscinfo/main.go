@@ -0,0 +1,248 @@
+// tscinfo prints whether the tsc package will use TSC on this machine and why,
+// with CPU features, clocksource, the chosen UnixNano, frequencies, a quick drift check and cross-core skew.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/klauspost/cpuid/v2"
+	"github.com/templexxx/cpu"
+	"github.com/templexxx/tsc"
+)
+
+var (
+	format     = flag.String("format", "text", "output format: text or json")
+	driftTime  = flag.Duration("drift", 2*time.Second, "duration of the drift check, 0 means skipping")
+	skewCheck  = flag.Bool("skew", true, "measure tsc skew of every CPU relative to the first one (Linux only)")
+	skewRounds = flag.Int("skew_rounds", 1000, "rounds of ping-pong between two CPUs for measuring skew")
+)
+
+const (
+	availableClockSourcePath = "/sys/devices/system/clocksource/clocksource0/available_clocksource"
+)
+
+// info is all the information, fields are omitted if unavailable.
+type info struct {
+	CPU         cpuInfo         `json:"cpu"`
+	ClockSource clockSourceInfo `json:"clocksource"`
+	Library     libraryInfo     `json:"library"`
+	Frequency   frequencyInfo   `json:"frequency"`
+	Drift       *driftInfo      `json:"drift,omitempty"`
+	Skew        *skewInfo       `json:"skew,omitempty"`
+}
+
+type cpuInfo struct {
+	Name         string `json:"name"`
+	Signature    string `json:"signature"`
+	InvariantTSC bool   `json:"invariant_tsc"`
+	AVX          bool   `json:"avx"`
+	FMA          bool   `json:"fma"`
+	RDTSCP       bool   `json:"rdtscp"`
+	Hypervisor   string `json:"hypervisor,omitempty"` // Empty if it's not in a VM (or the hypervisor is hidden).
+}
+
+type clockSourceInfo struct {
+	Current   string   `json:"current,omitempty"`
+	Available []string `json:"available,omitempty"`
+}
+
+type libraryInfo struct {
+	Supported        bool   `json:"supported"`
+	Reason           string `json:"reason"`
+	UnixNano         string `json:"unix_nano"` // The implementation of tsc.UnixNano.
+	VDSO             bool   `json:"vdso"`
+	OutOfOrder       bool   `json:"out_of_order"`
+	DriftCompensated bool   `json:"drift_compensated"`
+}
+
+type frequencyInfo struct {
+	Nominal    uint64  `json:"nominal,omitempty"`     // TSC frequency in CPUID (or frequency table).
+	CPUBase    int64   `json:"cpu_base,omitempty"`    // Base frequency of CPU.
+	Calibrated float64 `json:"calibrated,omitempty"`  // Frequency of the current calibration.
+	Source     string  `json:"source,omitempty"`      // Source of the current calibration.
+	ErrorBound int64   `json:"error_bound,omitempty"` // Error bound (ns) of the current calibration.
+}
+
+func main() {
+
+	flag.Parse()
+
+	if *format != "text" && *format != "json" {
+		log.Fatalf("unknown format: %s", *format)
+	}
+
+	in := collect()
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(in); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	printInfo(in)
+}
+
+func collect() *info {
+
+	in := &info{
+		CPU: cpuInfo{
+			Name:         cpu.X86.Name,
+			Signature:    fmt.Sprintf("%s_%d", cpu.X86.Signature, cpu.X86.SteppingID),
+			InvariantTSC: cpu.X86.HasInvariantTSC,
+			AVX:          cpu.X86.HasAVX,
+			FMA:          cpu.X86.HasFMA,
+			RDTSCP:       cpuid.CPU.Has(cpuid.RDTSCP),
+			Hypervisor:   cpuid.CPU.HypervisorVendorString,
+		},
+		ClockSource: clockSourceInfo{
+			Current:   tsc.GetCurrentClockSource(),
+			Available: availableClockSources(),
+		},
+		Library: libraryInfo{
+			Supported:        tsc.Supported(),
+			UnixNano:         funcName(tsc.UnixNano),
+			VDSO:             tsc.IsVDSO(),
+			OutOfOrder:       tsc.IsOutOfOrder(),
+			DriftCompensated: tsc.IsDriftCompensated(),
+		},
+		Frequency: frequencyInfo{
+			Nominal: cpu.X86.TSCFrequency,
+			CPUBase: cpuid.CPU.Hz,
+		},
+	}
+	if in.CPU.Hypervisor == "" && cpuid.CPU.HypervisorVendorID != cpuid.VendorUnknown {
+		in.CPU.Hypervisor = cpuid.CPU.HypervisorVendorID.String()
+	}
+	in.Library.Reason = reason(in)
+
+	if tsc.Supported() {
+		c := tsc.Current()
+		in.Frequency.Calibrated, in.Frequency.Source, in.Frequency.ErrorBound = c.Frequency, c.Source, c.ErrorBound
+	}
+
+	if *driftTime > 0 {
+		in.Drift = checkDrift(*driftTime)
+	}
+	if *skewCheck {
+		s, err := measureSkews(*skewRounds, in.Frequency)
+		if err != nil {
+			log.Printf("skipped skew: %v", err)
+		} else {
+			in.Skew = s
+		}
+	}
+	return in
+}
+
+// reason explains why tsc is used by the tsc package or not (see isHardwareSupported in the tsc package).
+func reason(in *info) string {
+
+	if runtime.GOARCH != "amd64" {
+		return fmt.Sprintf("unsupported architecture: %s", runtime.GOARCH)
+	}
+	if in.Library.Supported {
+		if in.CPU.InvariantTSC {
+			return "invariant TSC in CPUID & AVX"
+		}
+		return "clocksource is tsc & AVX"
+	}
+	r := ""
+	if !in.CPU.InvariantTSC && in.ClockSource.Current != "tsc" {
+		r = "no invariant TSC in CPUID and clocksource isn't tsc"
+	} else if !in.CPU.AVX {
+		r = "no AVX"
+	}
+	if in.Library.VDSO {
+		r += ", UnixNano reads kernel clock (" + in.ClockSource.Current + ") parameters in vDSO"
+	}
+	return r
+}
+
+func availableClockSources() []string {
+
+	d, err := os.ReadFile(availableClockSourcePath)
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(d))
+}
+
+// funcName returns the name of f without package path.
+func funcName(f func() int64) string {
+
+	name := runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+func printInfo(in *info) {
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	line := func(k string, format string, args ...interface{}) {
+		fmt.Fprintf(tw, "%s:\t%s\n", k, fmt.Sprintf(format, args...))
+	}
+	yes := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+
+	verdict := "TSC is used"
+	if !in.Library.Supported {
+		verdict = "TSC is NOT used"
+	}
+	line("verdict", "%s (%s)", verdict, in.Library.Reason)
+
+	line("cpu", "%s (%s)", in.CPU.Name, in.CPU.Signature)
+	line("invariant tsc", yes(in.CPU.InvariantTSC))
+	line("avx", yes(in.CPU.AVX))
+	line("fma", yes(in.CPU.FMA))
+	line("rdtscp", yes(in.CPU.RDTSCP))
+	hv := in.CPU.Hypervisor
+	if hv == "" {
+		hv = "none"
+	}
+	line("hypervisor", hv)
+
+	line("clocksource", "%s (available: %s)", in.ClockSource.Current, strings.Join(in.ClockSource.Available, " "))
+
+	line("unix nano", in.Library.UnixNano)
+	line("vdso mode", yes(in.Library.VDSO))
+	line("out of order", yes(in.Library.OutOfOrder))
+	line("drift compensated", yes(in.Library.DriftCompensated))
+
+	line("nominal tsc freq", hz(float64(in.Frequency.Nominal)))
+	line("cpu base freq", hz(float64(in.Frequency.CPUBase)))
+	if in.Frequency.Calibrated != 0 {
+		line("calibrated freq", "%.3f Hz (source: %s, error bound: %dns)", in.Frequency.Calibrated, in.Frequency.Source, in.Frequency.ErrorBound)
+	}
+
+	if d := in.Drift; d != nil {
+		line("drift", "%.3fppm in %s (delta: %dns -> %dns)", d.DriftPPM, d.Duration, d.StartDelta, d.EndDelta)
+	}
+	if s := in.Skew; s != nil {
+		line("cross-core skew", "max abs: %.1fns (relative to cpu %d)", s.MaxAbs, s.Base)
+		for _, c := range s.CPUs {
+			line(fmt.Sprintf("  cpu %d", c.CPU), "%.1fns ± %.1fns", c.Offset, c.Uncertainty)
+		}
+	}
+	_ = tw.Flush()
+}
+
+func hz(f float64) string {
+	if f == 0 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%.3f MHz", f/1e6)
+}
@@ -11,6 +11,14 @@ import (
 	"github.com/templexxx/tsc/internal/xbytes"
 )
 
+// Configs of calibration.
+// See tools/calibrate for details.
+const (
+	samples                 = 128
+	sampleDuration          = 16 * time.Millisecond
+	getClosestTSCSysRetries = 256
+)
+
 var (
 	supported int64 = 0 // Supported invariant TSC or not.
 	// Set it to 1 by invoke AllowOutOfOrder() if out-of-order execution is acceptable.
@@ -24,18 +32,19 @@ var (
 // for avoiding future dividing.
 // MUL gets much better performance than DIV.
 var (
-	// OffsetCoeff is offset & coefficient pair.
-	// Coefficient is in [0,64) bits.
-	// Offset is in [64, 128) bits.
+	// OffsetCoeff is the calibration block (offset, coefficient and other fields)
+	// protected by seqlock, see block for the layout.
 	// Using false sharing range as aligned size & total size for avoiding cache pollution.
 	OffsetCoeff     = xbytes.MakeAlignedBlock(cpu.X86FalseSharingRange, cpu.X86FalseSharingRange)
 	OffsetCoeffAddr = &OffsetCoeff[0]
 )
 
 var (
-	// OffsetCoeffF using float64 as offset.
-	OffsetCoeffF     = xbytes.MakeAlignedBlock(cpu.X86FalseSharingRange, cpu.X86FalseSharingRange)
-	OffsetCoeffFAddr = &OffsetCoeffF[0]
+	// OffsetCoeffF is as same as OffsetCoeff.
+	//
+	// Deprecated: float64 offset is in OffsetCoeff now.
+	OffsetCoeffF     = OffsetCoeff
+	OffsetCoeffFAddr = OffsetCoeffAddr
 )
 
 // UnixNano returns time as a Unix time, the number of nanoseconds elapsed
@@ -1,23 +1,33 @@
 package tsc
 
 import (
-	"math"
-	"time"
-
 	"github.com/templexxx/cpu"
 )
 
-// Configs of calibration.
-// See tools/calibrate for details.
-const (
-	samples                 = 128
-	sampleDuration          = 16 * time.Millisecond
-	getClosestTSCSysRetries = 256
-)
-
 func init() {
 
+	if !isHardwareSupported() {
+		_ = EnableVDSO() // Paravirtual clocks made by TSC in VMs (e.g., kvm-clock), see EnableVDSO.
+		return
+	}
+
+	path := cachePathFromEnv()
+	if path == "" {
+		_ = reset()
+		return
+	}
+
+	if LoadCache(path) == nil {
+		pickUnixNano()
+		go func() {
+			Calibrate()
+			_ = SaveCache(path)
+		}()
+		return
+	}
+
 	_ = reset()
+	_ = SaveCache(path)
 }
 
 func reset() bool {
@@ -27,6 +37,31 @@ func reset() bool {
 	}
 
 	Calibrate()
+	pickUnixNano()
+	return true
+}
+
+// pickUnixNano picks the UnixNano implementation.
+func pickUnixNano() {
+
+	if simulated {
+		UnixNano = sourceUnixNano
+		return
+	}
+
+	if IsVDSO() {
+		UnixNano = vdsoUnixNano
+		return
+	}
+
+	if IsDriftCompensated() {
+		if IsOutOfOrder() {
+			UnixNano = unixNanoTSCDrift
+			return
+		}
+		UnixNano = unixNanoTSCDriftFence
+		return
+	}
 
 	if IsOutOfOrder() {
 		if cpu.X86.HasFMA {
@@ -45,10 +80,27 @@ func reset() bool {
 			}
 		}
 		UnixNano = unixNanoTSC16B
-		return true
+		return
 	}
 	UnixNano = unixNanoTSC16Bfence
-	return true
+}
+
+func implementations() []Implementation {
+
+	if !Supported() {
+		return nil
+	}
+
+	impls := []Implementation{
+		{Name: "unixNanoTSC16B", Func: unixNanoTSC16B},
+		{Name: "unixNanoTSC16Bfence", Func: unixNanoTSC16Bfence},
+		{Name: "unixNanoTSCDrift", Func: unixNanoTSCDrift},
+		{Name: "unixNanoTSCDriftFence", Func: unixNanoTSCDriftFence},
+	}
+	if cpu.X86.HasFMA {
+		impls = append(impls, Implementation{Name: "unixNanoTSCFMA", Func: unixNanoTSCFMA})
+	}
+	return impls
 }
 
 func isHardwareSupported() bool {
@@ -68,7 +120,6 @@ func isHardwareSupported() bool {
 	}
 
 	// Some instructions need AVX, see tsc_amd64.s for details.
-	// And we need AVX support for 16 Bytes atomic store/load, see internal/xatomic for deatils.
 	// Actually, it's hard to find a CPU without AVX support at present. :)
 	// And it's unique that a CPU has invariant TSC but doesn't have AVX.
 	if !cpu.X86.HasAVX {
@@ -79,128 +130,6 @@ func isHardwareSupported() bool {
 	return true
 }
 
-// Calibrate calibrates tsc clock.
-//
-// It's a good practice that runs Calibrate periodically (e.g., 5 min is a good start).
-func Calibrate() {
-
-	if !isHardwareSupported() {
-		return
-	}
-
-	cnt := samples
-
-	tscs := make([]float64, cnt*2)
-	syss := make([]float64, cnt*2)
-
-	for j := 0; j < cnt; j++ {
-		_, tsc0, sys0 := getClosestTSCSys(getClosestTSCSysRetries)
-		time.Sleep(sampleDuration)
-		_, tsc1, sys1 := getClosestTSCSys(getClosestTSCSysRetries)
-
-		tscs[j*2] = float64(tsc0)
-		tscs[j*2+1] = float64(tsc1)
-
-		syss[j*2] = float64(sys0)
-		syss[j*2+1] = float64(sys1)
-	}
-
-	coeff, offset := simpleLinearRegression(tscs, syss)
-	storeOffsetCoeff(OffsetCoeffAddr, offset, coeff)
-	storeOffsetFCoeff(OffsetCoeffFAddr, float64(offset), coeff)
-}
-
-func simpleLinearRegression(tscs, syss []float64) (coeff float64, offset int64) {
-
-	tmean, wmean := float64(0), float64(0)
-	for _, i := range tscs {
-		tmean += i
-	}
-	for _, i := range syss {
-		wmean += i
-	}
-	tmean = tmean / float64(len(tscs))
-	wmean = wmean / float64(len(syss))
-
-	denominator, numerator := float64(0), float64(0)
-	for i := range tscs {
-		numerator += (tscs[i] - tmean) * (syss[i] - wmean)
-		denominator += math.Pow(tscs[i]-tmean, 2)
-	}
-
-	coeff = numerator / denominator
-
-	return coeff, int64(wmean - coeff*tmean)
-}
-
-// CalibrateWithCoeff calibrates coefficient to wall_clock by variables.
-//
-// Not thread safe, only for testing.
-func CalibrateWithCoeff(c float64) {
-
-	if !Supported() {
-		return
-	}
-
-	_, tsc, sys := getClosestTSCSys(getClosestTSCSysRetries)
-	off := sys - int64(float64(tsc)*c)
-	storeOffsetCoeff(OffsetCoeffAddr, off, c)
-	storeOffsetFCoeff(OffsetCoeffFAddr, float64(off), c)
-}
-
-// getClosestTSCSys tries to get the closest tsc register value nearby the system clock in a loop.
-func getClosestTSCSys(n int) (minDelta, tscClock, sys int64) {
-
-	// 256 is enough for finding the lowest sys clock cost in most cases.
-	// Although time.Now() is using VDSO to get time, but it's unstable,
-	// sometimes it will take more than 1000ns,
-	// we have to use a big loop(e.g. 256) to get the "real" clock.
-	// And it won't take a long time to finish a calibrating job, only about 20µs.
-	// [tscClock, wc, tscClock, wc, ..., tscClock]
-	timeline := make([]int64, n+n+1)
-
-	timeline[0] = RDTSC()
-	for i := 1; i < len(timeline)-1; i += 2 {
-		timeline[i] = time.Now().UnixNano()
-		timeline[i+1] = RDTSC()
-	}
-
-	// The minDelta is the smallest gap between two adjacent tscs,
-	// which means the smallest gap between sys clock and tscClock too.
-	minDelta = int64(math.MaxInt64)
-	minIndex := 1 // minIndex is sys clock index where has minDelta.
-
-	// time.Now()'s precision is only µs (on macOS),
-	// which means we will get the multi-same sys clock in timeline,
-	// and the middle one is closer to the real time in statistics.
-	// Try to find the minimum delta when sys clock is in the "middle".
-	for i := 1; i < len(timeline)-1; i += 2 {
-		last := timeline[i]
-		for j := i + 2; j < len(timeline)-1; j += 2 {
-			if timeline[j] != last {
-				mid := (i + j - 2) >> 1
-				if isEven(mid) {
-					mid++
-				}
-
-				delta := timeline[mid+1] - timeline[mid-1]
-				if delta < minDelta {
-					minDelta = delta
-					minIndex = mid
-				}
-
-				i = j
-				last = timeline[j]
-			}
-		}
-	}
-
-	tscClock = (timeline[minIndex+1] + timeline[minIndex-1]) >> 1
-	sys = timeline[minIndex]
-
-	return
-}
-
 // GetInOrder gets tsc value in strict order.
 // It's used to help calibrating to avoid out-of-order issues.
 //
@@ -212,6 +141,22 @@ func GetInOrder() int64
 //go:noescape
 func RDTSC() int64
 
+// RDTSCP gets tsc value with IA32_TSC_AUX after all previous instructions have executed,
+// aux is set by OS (see AuxCPU).
+//
+// RDTSCP must be supported by the CPU, or it'll crash.
+//
+//go:noescape
+func RDTSCP() (tsc int64, aux uint32)
+
+// unixNanoFallback is jumped to by the readers in assembly when they give up retrying on a torn read
+// (see blockMaxRetries), it returns the system clock.
+func unixNanoFallback() int64 {
+
+	markStuck(offsetCoeffAddr())
+	return sysClock()
+}
+
 //go:noescape
 func unixNanoTSC16B() int64
 
@@ -222,12 +167,15 @@ func unixNanoTSCFMA() int64
 func unixNanoTSC16Bfence() int64
 
 //go:noescape
-func storeOffsetCoeff(dst *byte, offset int64, coeff float64)
+func unixNanoTSCDrift() int64
 
 //go:noescape
-func storeOffsetFCoeff(dst *byte, offset, coeff float64)
+func unixNanoTSCDriftFence() int64
 
-// Same logic as unixNanoTSC16B for checking getting offset & coeff correctly.
+// storeBlock stores b to dst (seq in b is ignored).
+//
+// It's in assembly for avoiding being preempted between the two seq updates,
+// readers in assembly can't yield.
 //
 //go:noescape
-func LoadOffsetCoeff(src *byte) (offset int64, coeff float64)
+func storeBlock(dst *byte, b *block)
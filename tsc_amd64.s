@@ -20,9 +20,37 @@ TEXT ·RDTSC(SB), NOSPLIT, $0
 	MOVQ AX, ret+0(FP)
 	RET
 
+// func RDTSCP() (tsc int64, aux uint32)
+TEXT ·RDTSCP(SB), NOSPLIT, $0
+
+	RDTSCP
+	SALQ $32, DX
+	ORQ  DX, AX
+	MOVQ AX, tsc+0(FP)
+	MOVL CX, aux+8(FP)
+	RET
+
+// Offsets of fields in calibration block, see block in block.go for details.
+#define BLOCK_SEQ 0
+#define BLOCK_COEFF 24
+#define BLOCK_OFFSETF 40
+#define BLOCK_BASE_TSC 48
+#define BLOCK_BASE_NS 56
+#define BLOCK_DRIFT 80
+
+// Readers give up retrying after it (about several milliseconds) & jump to unixNanoFallback,
+// it won't happen unless the writer stalled or died in writing, see blockMaxRetries in block.go.
+#define BLOCK_MAX_RETRIES $65536
+
 // func unixNanoTSC16B() int64
 TEXT ·unixNanoTSC16B(SB), NOSPLIT, $0
 
+	MOVQ ·OffsetCoeffAddr(SB), BX
+	MOVQ BLOCK_MAX_RETRIES, CX
+
+retry:
+	MOVQ BLOCK_SEQ(BX), SI
+
 	// Both of RSTSC & RDTSCP are not serializing instructions.
 	// It does not necessarily wait until all previous instructions
 	// have been executed before reading the counter.
@@ -32,20 +60,44 @@ TEXT ·unixNanoTSC16B(SB), NOSPLIT, $0
 	SALQ $32, DX
 	ORQ  DX, AX  // -> [DX, tsc] (high, low)
 
-	VCVTSI2SDQ  AX, X0, X0               // ftsc = float64(tsc)
-	MOVQ        ·OffsetCoeffAddr(SB), BX
-	VMOVDQA     (BX), X3
-	VMULSD      X3, X0, X0               // ns = coeff * ftsc
-	VCVTTSD2SIQ X0, AX                   // un = int64(ns)
-	VMOVHLPS    X3, X3, X3
-	VMOVQ       X3, CX
-	ADDQ        CX, AX                   // un += offset
-	MOVQ        AX, ret+0(FP)
+	SUBQ        BLOCK_BASE_TSC(BX), AX // tsc -= base_tsc
+	VCVTSI2SDQ  AX, X0, X0             // ftsc = float64(tsc)
+	VMULSD      BLOCK_COEFF(BX), X0, X0 // ns = coeff * ftsc
+	VCVTTSD2SIQ X0, AX                 // un = int64(ns)
+	ADDQ        BLOCK_BASE_NS(BX), AX  // un += base_ns
+
+	TESTQ $1, SI
+	JNZ   torn
+	CMPQ  SI, BLOCK_SEQ(BX)
+	JNE   torn
+
+done:
+	MOVQ AX, ret+0(FP)
 	RET
 
+torn:
+	TESTQ $1, SI
+	JZ    spin
+	CMPQ  SI, ·stuckSeq(SB) // The writer has died in writing.
+	JEQ   fallback
+
+spin:
+	PAUSE
+	DECQ CX
+	JNZ  retry
+
+fallback:
+	JMP ·unixNanoFallback(SB)
+
 // func unixNanoTSCFMA() int64
 TEXT ·unixNanoTSCFMA(SB), NOSPLIT, $0
 
+	MOVQ ·OffsetCoeffAddr(SB), BX
+	MOVQ BLOCK_MAX_RETRIES, CX
+
+retry:
+	MOVQ BLOCK_SEQ(BX), SI
+
 	// Both of RSTSC & RDTSCP are not serializing instructions.
 	// It does not necessarily wait until all previous instructions
 	// have been executed before reading the counter.
@@ -56,57 +108,189 @@ TEXT ·unixNanoTSCFMA(SB), NOSPLIT, $0
 	ORQ  DX, AX  // -> [DX, tsc] (high, low)
 
 	VCVTSI2SDQ  AX, X0, X0               // ftsc = float64(tsc)
-	MOVQ        ·OffsetCoeffFAddr(SB), BX
-	VMOVDQA     (BX), X3    // get coeff
-	VMOVHLPS    X3, X3, X4 // get offset
-	VFMADD132PD X0, X4, X3  // X0 * X3 + X4 -> X3: ftsc * coeff + offset
+	VMOVSD      BLOCK_COEFF(BX), X3      // get coeff
+	VMOVSD      BLOCK_OFFSETF(BX), X4    // get offset
+	VFMADD132SD X0, X4, X3               // X0 * X3 + X4 -> X3: ftsc * coeff + offset
 	VCVTTSD2SIQ X3, AX
-	MOVQ        AX, ret+0(FP)
+
+	TESTQ $1, SI
+	JNZ   torn
+	CMPQ  SI, BLOCK_SEQ(BX)
+	JNE   torn
+
+done:
+	MOVQ AX, ret+0(FP)
 	RET
 
+torn:
+	TESTQ $1, SI
+	JZ    spin
+	CMPQ  SI, ·stuckSeq(SB) // The writer has died in writing.
+	JEQ   fallback
+
+spin:
+	PAUSE
+	DECQ CX
+	JNZ  retry
+
+fallback:
+	JMP ·unixNanoFallback(SB)
+
 // func unixNanoTSC16Bfence() int64
 TEXT ·unixNanoTSC16Bfence(SB), NOSPLIT, $0
 
+	MOVQ ·OffsetCoeffAddr(SB), BX
+	MOVQ BLOCK_MAX_RETRIES, CX
+
+retry:
+	MOVQ BLOCK_SEQ(BX), SI
+
 	LFENCE
 	RDTSC        // high 32bit in DX, low 32bit in AX (tsc).
 	LFENCE
 	SALQ $32, DX
 	ORQ  DX, AX  // -> [DX, tsc] (high, low)
 
-	VCVTSI2SDQ  AX, X0, X0               // ftsc = float64(tsc)
-	MOVQ        ·OffsetCoeffAddr(SB), BX
-	VMOVDQA     (BX), X3    // get coeff
-	VMULSD      X3, X0, X0               // ns = coeff * ftsc
-	VCVTTSD2SIQ X0, AX                   // un = int64(ns)
-	VMOVHLPS    X3, X3, X3
-	VMOVQ       X3, CX
-	ADDQ        CX, AX                   // un += offset
-	MOVQ        AX, ret+0(FP)
+	SUBQ        BLOCK_BASE_TSC(BX), AX // tsc -= base_tsc
+	VCVTSI2SDQ  AX, X0, X0             // ftsc = float64(tsc)
+	VMULSD      BLOCK_COEFF(BX), X0, X0 // ns = coeff * ftsc
+	VCVTTSD2SIQ X0, AX                 // un = int64(ns)
+	ADDQ        BLOCK_BASE_NS(BX), AX  // un += base_ns
+
+	TESTQ $1, SI
+	JNZ   torn
+	CMPQ  SI, BLOCK_SEQ(BX)
+	JNE   torn
+
+done:
+	MOVQ AX, ret+0(FP)
 	RET
 
-// func loadOffsetCoeff(src *byte) (offset int64, coeff float64)
-TEXT ·LoadOffsetCoeff(SB), NOSPLIT, $0
-	MOVQ     src+0(FP), AX
-	VMOVDQA  (AX), X0
-	VMOVQ    X0, BX
-	VMOVHLPS X0, X0, X0
-	VMOVQ    X0, CX
-	MOVQ     CX, offset+8(FP)
-	MOVQ     BX, coeff+16(FP)
+torn:
+	TESTQ $1, SI
+	JZ    spin
+	CMPQ  SI, ·stuckSeq(SB) // The writer has died in writing.
+	JEQ   fallback
+
+spin:
+	PAUSE
+	DECQ CX
+	JNZ  retry
+
+fallback:
+	JMP ·unixNanoFallback(SB)
+
+// func unixNanoTSCDrift() int64
+TEXT ·unixNanoTSCDrift(SB), NOSPLIT, $0
+
+	MOVQ ·OffsetCoeffAddr(SB), BX
+	MOVQ BLOCK_MAX_RETRIES, CX
+
+retry:
+	MOVQ BLOCK_SEQ(BX), SI
+
+	RDTSC        // high 32bit in DX, low 32bit in AX (tsc).
+	SALQ $32, DX
+	ORQ  DX, AX  // -> [DX, tsc] (high, low)
+
+	SUBQ        BLOCK_BASE_TSC(BX), AX  // d = tsc - base_tsc
+	VCVTSI2SDQ  AX, X0, X0              // fd = float64(d)
+	VMULSD      BLOCK_COEFF(BX), X0, X1 // ns = coeff * fd
+	VMULSD      X0, X0, X2              // fd²
+	VMULSD      BLOCK_DRIFT(BX), X2, X2 // drift * fd²
+	VADDSD      X2, X1, X1              // ns += drift * fd²
+	VCVTTSD2SIQ X1, AX                  // un = int64(ns)
+	ADDQ        BLOCK_BASE_NS(BX), AX   // un += base_ns
+
+	TESTQ $1, SI
+	JNZ   torn
+	CMPQ  SI, BLOCK_SEQ(BX)
+	JNE   torn
+
+done:
+	MOVQ AX, ret+0(FP)
 	RET
 
-// func storeOffsetCoeff(dst *byte, offset int64, coeff float64)
-TEXT ·storeOffsetCoeff(SB), NOSPLIT, $0
-	MOVQ    dst+0(FP), AX
-	VMOVQ   coeff+16(FP), X5
-	VMOVHPS offset+8(FP), X5, X4
-	VMOVDQA X4, (AX)
+torn:
+	TESTQ $1, SI
+	JZ    spin
+	CMPQ  SI, ·stuckSeq(SB) // The writer has died in writing.
+	JEQ   fallback
+
+spin:
+	PAUSE
+	DECQ CX
+	JNZ  retry
+
+fallback:
+	JMP ·unixNanoFallback(SB)
+
+// func unixNanoTSCDriftFence() int64
+TEXT ·unixNanoTSCDriftFence(SB), NOSPLIT, $0
+
+	MOVQ ·OffsetCoeffAddr(SB), BX
+	MOVQ BLOCK_MAX_RETRIES, CX
+
+retry:
+	MOVQ BLOCK_SEQ(BX), SI
+
+	LFENCE
+	RDTSC        // high 32bit in DX, low 32bit in AX (tsc).
+	LFENCE
+	SALQ $32, DX
+	ORQ  DX, AX  // -> [DX, tsc] (high, low)
+
+	SUBQ        BLOCK_BASE_TSC(BX), AX  // d = tsc - base_tsc
+	VCVTSI2SDQ  AX, X0, X0              // fd = float64(d)
+	VMULSD      BLOCK_COEFF(BX), X0, X1 // ns = coeff * fd
+	VMULSD      X0, X0, X2              // fd²
+	VMULSD      BLOCK_DRIFT(BX), X2, X2 // drift * fd²
+	VADDSD      X2, X1, X1              // ns += drift * fd²
+	VCVTTSD2SIQ X1, AX                  // un = int64(ns)
+	ADDQ        BLOCK_BASE_NS(BX), AX   // un += base_ns
+
+	TESTQ $1, SI
+	JNZ   torn
+	CMPQ  SI, BLOCK_SEQ(BX)
+	JNE   torn
+
+done:
+	MOVQ AX, ret+0(FP)
 	RET
 
-// func storeOffsetCoeff(dst *byte, offset, coeff float64)
-TEXT ·storeOffsetFCoeff(SB), NOSPLIT, $0
-	MOVQ    dst+0(FP), AX
-	VMOVQ   coeff+16(FP), X5
-	VMOVHPS offset+8(FP), X5, X4
-	VMOVDQA X4, (AX)
+torn:
+	TESTQ $1, SI
+	JZ    spin
+	CMPQ  SI, ·stuckSeq(SB) // The writer has died in writing.
+	JEQ   fallback
+
+spin:
+	PAUSE
+	DECQ CX
+	JNZ  retry
+
+fallback:
+	JMP ·unixNanoFallback(SB)
+
+// func storeBlock(dst *byte, b *block)
+TEXT ·storeBlock(SB), NOSPLIT, $0
+	MOVQ dst+0(FP), DI
+	MOVQ b+8(FP), SI
+
+	MOVQ BLOCK_SEQ(DI), AX
+	INCQ AX
+	MOVQ AX, BLOCK_SEQ(DI) // seq is odd now.
+
+	// Copy fields [1, 16), stores won't be reordered with other stores.
+	MOVQ $1, CX
+
+copy:
+	MOVQ (SI)(CX*8), DX
+	MOVQ DX, (DI)(CX*8)
+	INCQ CX
+	CMPQ CX, $16
+	JNE  copy
+
+	INCQ AX
+	MOVQ AX, BLOCK_SEQ(DI) // seq is even again.
 	RET
@@ -3,28 +3,28 @@
 
 package tsc
 
-func reset() bool { return false }
+import (
+	"sync/atomic"
+	"unsafe"
+)
 
-// Calibrate calibrates tsc & wall clock.
-//
-// It's a good practice that run Calibrate period (every hour) outside,
-// because the wall clock may be calibrated (e.g. NTP).
-//
-// If !enabled do nothing.
-func Calibrate() {
+func reset() bool { return false }
 
-	return
+func pickUnixNano() {
+	if simulated {
+		UnixNano = sourceUnixNano
+	}
 }
 
-func CalibrateWithCoeff(coeff float64) {
-	return
-}
+func isHardwareSupported() bool { return supported == 1 }
+
+func implementations() []Implementation { return nil }
 
 // GetInOrder gets tsc value in strictly order.
 // It's used for helping calibrate to avoid out-of-order issues.
 //
 // For non-amd64, just return 0.
-func GetInOrder() uint64 {
+func GetInOrder() int64 {
 	return 0
 }
 
@@ -32,6 +32,17 @@ func RDTSC() int64 {
 	return 0
 }
 
-func LoadOffsetCoeff(src *byte) (offset int64, coeff float64) {
+func RDTSCP() (tsc int64, aux uint32) {
 	return 0, 0
 }
+
+// storeBlock stores b to dst (seq in b is ignored).
+func storeBlock(dst *byte, b *block) {
+	words := (*[blockWords]uint64)(unsafe.Pointer(dst))
+	src := (*[blockWords]uint64)(unsafe.Pointer(b))
+	seq := atomic.AddUint64(&words[0], 1)
+	for i := 1; i < blockWords; i++ {
+		atomic.StoreUint64(&words[i], src[i])
+	}
+	atomic.StoreUint64(&words[0], seq+1)
+}
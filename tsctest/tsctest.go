@@ -0,0 +1,168 @@
+// Package tsctest provides a manual clock & a simulated TSC for testing code which uses package tsc,
+// and for testing the calibration against known ground truth.
+//
+// e.g.
+//
+//	clock := tsctest.NewClock(time.Unix(1700000000, 0))
+//	clock.SetStep(20 * time.Nanosecond) // Reading clocks takes time, calibration needs it.
+//	counter := tsctest.NewTSC(clock, tsctest.TSCConfig{Frequency: 2.5e9})
+//	tsctest.Install(t, clock, counter) // Calibrated by the simulated TSC, restored after the test.
+//
+//	start := tsc.UnixNano()
+//	clock.Advance(time.Second)
+//	cost := tsc.UnixNano() - start // About 1s.
+package tsctest
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/templexxx/tsc"
+)
+
+// Clock is a manual clock (Unix nanoseconds), it's the ground truth of a simulation.
+// It only moves by Advance, Set & Step, it's thread safe.
+type Clock struct {
+	ns   atomic.Int64
+	step atomic.Int64
+}
+
+// NewClock returns a Clock at start.
+func NewClock(start time.Time) *Clock {
+
+	c := new(Clock)
+	c.ns.Store(start.UnixNano())
+	return c
+}
+
+// Now returns the current Unix nanoseconds, and advances the clock by step (see SetStep).
+func (c *Clock) Now() int64 {
+
+	step := c.step.Load()
+	return c.ns.Add(step) - step
+}
+
+// Time returns the current time without advancing.
+func (c *Clock) Time() time.Time {
+	return time.Unix(0, c.ns.Load())
+}
+
+// Advance advances the clock by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.ns.Add(int64(d))
+}
+
+// Sleep is Advance, it makes sleeping in calibration instant.
+func (c *Clock) Sleep(d time.Duration) {
+	c.Advance(d)
+}
+
+// Set sets the clock to t, it could step backwards like the system clock.
+func (c *Clock) Set(t time.Time) {
+	c.ns.Store(t.UnixNano())
+}
+
+// SetStep sets the duration which every reading (Now, TSC.Read) advances the clock by (0 by default),
+// it simulates the cost of reading clocks.
+func (c *Clock) SetStep(d time.Duration) {
+	c.step.Store(int64(d))
+}
+
+// DefaultFrequency is the frequency of TSC if TSCConfig.Frequency is 0.
+const DefaultFrequency = 3e9
+
+// TSCConfig is the configuration of a simulated TSC.
+type TSCConfig struct {
+	Frequency float64 // Hz at the start, 0 means DefaultFrequency.
+	// Drift is the change rate of frequency in ppm per second (e.g., caused by temperature):
+	// frequency(t) = Frequency * (1 + Drift * 1e-6 * t).
+	Drift float64
+	// Jitter is the max noise (in time) of every reading, the noise is uniform in [-Jitter, Jitter].
+	// Readings may go backwards with jitter (like out-of-order RDTSC).
+	Jitter time.Duration
+	Start  int64 // Counter value at the start (when NewTSC is called).
+	Seed   int64 // Seed of jitter.
+}
+
+// TSC is a simulated TSC counter driven by a Clock.
+type TSC struct {
+	clock *Clock
+	cfg   TSCConfig
+	start int64 // Unix nanoseconds of the clock at the start.
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// NewTSC returns a TSC which starts at clock's current time (without advancing it).
+func NewTSC(clock *Clock, cfg TSCConfig) *TSC {
+
+	if cfg.Frequency == 0 {
+		cfg.Frequency = DefaultFrequency
+	}
+	return &TSC{
+		clock: clock,
+		cfg:   cfg,
+		start: clock.Time().UnixNano(),
+		rnd:   rand.New(rand.NewSource(cfg.Seed)),
+	}
+}
+
+// Read reads the counter at clock.Now() with jitter.
+func (t *TSC) Read() int64 {
+
+	ns := t.clock.Now()
+	if t.cfg.Jitter > 0 {
+		t.mu.Lock()
+		ns += t.rnd.Int63n(2*int64(t.cfg.Jitter)+1) - int64(t.cfg.Jitter)
+		t.mu.Unlock()
+	}
+	return t.At(ns)
+}
+
+// At returns the counter at Unix nanoseconds ns (without jitter).
+func (t *TSC) At(ns int64) int64 {
+
+	s := float64(ns-t.start) / 1e9
+	k := t.cfg.Drift * 1e-6
+	return t.cfg.Start + int64(math.Round(t.cfg.Frequency*(s+k*s*s/2)))
+}
+
+// UnixNano returns the Unix nanoseconds when the counter is tsc (without jitter), it's the inverse of At.
+func (t *TSC) UnixNano(tsc int64) int64 {
+
+	c := float64(tsc - t.cfg.Start)
+	f, k := t.cfg.Frequency, t.cfg.Drift*1e-6
+	s := c / f
+	if k != 0 {
+		// f*k/2 * s² + f * s - c = 0.
+		s = 2 * c / (f + math.Sqrt(f*f+2*f*k*c))
+	}
+	return t.start + int64(math.Round(s*1e9))
+}
+
+// Frequency returns the frequency (Hz) at Unix nanoseconds ns.
+func (t *TSC) Frequency(ns int64) float64 {
+	return t.cfg.Frequency * (1 + t.cfg.Drift*1e-6*float64(ns-t.start)/1e9)
+}
+
+// Source returns the tsc.Source made by clock & t.
+func Source(clock *Clock, t *TSC) tsc.Source {
+	return tsc.Source{TSC: t.Read, Sys: clock.Now, Sleep: clock.Sleep}
+}
+
+// Install makes the package-level functions of package tsc using clock (as the system clock) & t
+// (as the tsc register), and calibrates with them (see tsc.SetSource).
+// Everything is restored when tb and all its subtests complete.
+//
+// Tests which call Install must not be run in parallel.
+func Install(tb testing.TB, clock *Clock, t *TSC) {
+
+	tb.Helper()
+	restore := tsc.SetSource(Source(clock, t))
+	tb.Cleanup(restore)
+}
@@ -0,0 +1,168 @@
+package tsctest
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/templexxx/tsc"
+)
+
+var epoch = time.Unix(1700000000, 0)
+
+func TestClock(t *testing.T) {
+
+	c := NewClock(epoch)
+	if c.Now() != epoch.UnixNano() || c.Now() != epoch.UnixNano() {
+		t.Fatal("clock should not move without step")
+	}
+
+	c.Advance(time.Second)
+	if !c.Time().Equal(epoch.Add(time.Second)) {
+		t.Fatalf("mismatched time after advancing: %s", c.Time())
+	}
+	c.Sleep(time.Second)
+	if !c.Time().Equal(epoch.Add(2 * time.Second)) {
+		t.Fatalf("mismatched time after sleeping: %s", c.Time())
+	}
+
+	c.Set(epoch)
+	c.SetStep(10)
+	for i := int64(0); i < 3; i++ {
+		if got := c.Now(); got != epoch.UnixNano()+i*10 {
+			t.Fatalf("mismatched reading %d: exp: %d, got: %d", i, epoch.UnixNano()+i*10, got)
+		}
+	}
+}
+
+func TestTSC(t *testing.T) {
+
+	c := NewClock(epoch)
+	for _, cfg := range []TSCConfig{
+		{Frequency: 2.5e9, Start: 1 << 40},
+		{Drift: 0.01},
+		{Frequency: 1e9, Drift: -0.05, Start: 12345},
+	} {
+		counter := NewTSC(c, cfg)
+		if counter.Read() != counter.At(c.Now()) {
+			t.Fatal("mismatched reading")
+		}
+		for _, d := range []time.Duration{0, time.Microsecond, time.Second, time.Hour} {
+			ns := epoch.UnixNano() + int64(d)
+			if got := counter.UnixNano(counter.At(ns)); math.Abs(float64(got-ns)) > 1 {
+				t.Fatalf("%+v: UnixNano isn't the inverse of At at %s: got: %d", cfg, d, got-ns)
+			}
+		}
+
+		ns := epoch.UnixNano() + int64(time.Second)
+		exp := counter.Frequency(ns)
+		got := float64(counter.At(ns+int64(time.Millisecond))-counter.At(ns)) * 1e3
+		if math.Abs(got-exp)/exp > 1e-6 {
+			t.Fatalf("%+v: mismatched frequency: exp: %.3f, got: %.3f", cfg, exp, got)
+		}
+	}
+}
+
+func TestTSCJitter(t *testing.T) {
+
+	c := NewClock(epoch)
+	counter := NewTSC(c, TSCConfig{Frequency: 1e9, Jitter: 100, Seed: 1})
+	for i := 0; i < 1000; i++ {
+		if d := counter.Read() - counter.At(c.Now()); d < -100 || d > 100 {
+			t.Fatalf("jitter out of range: %d", d)
+		}
+	}
+}
+
+func TestInstall(t *testing.T) {
+
+	unixNano, current := reflect.ValueOf(tsc.UnixNano).Pointer(), tsc.Current()
+
+	t.Run("installed", func(t *testing.T) {
+		c := NewClock(epoch)
+		c.SetStep(20)
+		counter := NewTSC(c, TSCConfig{Frequency: 2.5e9})
+		Install(t, c, counter)
+
+		if !tsc.Supported() {
+			t.Fatal("should be supported with simulated source")
+		}
+		cur := tsc.Current()
+		if math.Abs(cur.Frequency-2.5e9)/2.5e9 > 1e-6 {
+			t.Fatalf("mismatched frequency: %.3f", cur.Frequency)
+		}
+		if len(tsc.History()) != 1 {
+			t.Fatalf("history should only have the calibration of installing, but got: %d", len(tsc.History()))
+		}
+
+		start := tsc.UnixNano()
+		c.Advance(time.Second)
+		if cost := tsc.UnixNano() - start; math.Abs(float64(cost-int64(time.Second))) > 1000 {
+			t.Fatalf("cost should be about 1s, but got: %s", time.Duration(cost))
+		}
+	})
+
+	if reflect.ValueOf(tsc.UnixNano).Pointer() != unixNano {
+		t.Fatal("UnixNano isn't restored")
+	}
+	if tsc.Current() != current {
+		t.Fatalf("calibration isn't restored: exp: %+v, got: %+v", current, tsc.Current())
+	}
+}
+
+// TestCalibrateGroundTruth tests calibration of package tsc against the simulated ground truth.
+func TestCalibrateGroundTruth(t *testing.T) {
+
+	c := NewClock(epoch)
+	c.SetStep(20)
+	counter := NewTSC(c, TSCConfig{Frequency: 2.1e9, Jitter: 10, Start: 1 << 40, Seed: 1})
+	Install(t, c, counter)
+
+	for i := 0; i < 3; i++ {
+		c.Advance(5 * time.Minute)
+		tsc.Calibrate()
+
+		now := c.Time().UnixNano()
+		cur := tsc.Current()
+		if e := math.Abs(cur.Frequency-counter.Frequency(now)) / counter.Frequency(now); e > 1e-7 {
+			t.Fatalf("round %d: frequency error is too big: %.3gppm", i, e*1e6)
+		}
+
+		for _, d := range []time.Duration{0, time.Second, time.Minute} {
+			c.Advance(d)
+			truth := c.Time().UnixNano() // The tsc is read at it.
+			ns, errNs := tsc.UnixNanoWithError()
+			if math.Abs(float64(ns-truth)) > float64(errNs) {
+				t.Fatalf("round %d: +%s: truth is out of the error bound: delta: %dns, error bound: %dns", i, d, ns-truth, errNs)
+			}
+		}
+	}
+}
+
+// TestDriftCompensationGroundTruth tests that the quadratic model follows the simulated frequency drift.
+func TestDriftCompensationGroundTruth(t *testing.T) {
+
+	c := NewClock(epoch)
+	c.SetStep(20)
+	counter := NewTSC(c, TSCConfig{Frequency: 2.1e9, Drift: 0.001})
+	Install(t, c, counter)
+
+	for i := 0; i < 4; i++ {
+		c.Advance(5 * time.Minute)
+		tsc.Calibrate()
+	}
+	tsc.EnableDriftCompensation()
+
+	c.Advance(5 * time.Minute)
+	raw := counter.Read()
+	truth := counter.UnixNano(raw)
+	linear, quadratic := tsc.FromTSC(raw)-truth, tsc.FromTSCWithDrift(raw)-truth
+	if math.Abs(float64(quadratic)) >= math.Abs(float64(linear)) {
+		t.Fatalf("quadratic model should be better: linear delta: %dns, quadratic delta: %dns", linear, quadratic)
+	}
+	truth = c.Time().UnixNano()
+	if d := tsc.UnixNano() - truth; math.Abs(float64(d)) > math.Abs(float64(linear)) {
+		t.Fatalf("UnixNano should use the quadratic model: delta: %dns, linear delta: %dns", d, linear)
+	}
+}
@@ -0,0 +1,56 @@
+package tsc
+
+import (
+	"math"
+	"time"
+)
+
+// UnixNanoWithError returns Unix nanoseconds with its error bound:
+// the reference clock (the system clock) is in [ns-errNs, ns+errNs] with high probability.
+//
+// errNs = error_bound_at_calibration + frequency_error * age_of_calibration (+ kernel_max_error, see RunKernelWatch).
+// It's like the interval of TrueTime: two timestamps could be ordered
+// only if their intervals don't overlap.
+//
+// It's slower than UnixNano. ns may be a bit different from the value returned by UnixNano
+// because of the different floating-point math (less than 1µs).
+// ns follows the quadratic model too if drift compensation is enabled (see EnableDriftCompensation),
+// but errNs doesn't count the error of drift.
+//
+// If TSC is unsupported (or hasn't been calibrated), it returns the system clock with 0 errNs.
+func UnixNanoWithError() (ns int64, errNs int64) {
+
+	if !Supported() {
+		return sysClock(), 0
+	}
+
+	b := loadBlock(offsetCoeffAddr())
+	if !b.isValid() {
+		return sysClock(), 0
+	}
+
+	var tsc int64
+	switch {
+	case simulated:
+		tsc = rdtsc()
+	case IsOutOfOrder():
+		tsc = RDTSC()
+	default:
+		tsc = GetInOrder()
+	}
+	d := float64(tsc - b.baseTSC)
+	age := d * b.coeff
+	ns = b.baseNs + int64(age)
+	if driftCompensation == 1 {
+		ns = b.baseNs + int64(age+d*d*b.drift)
+	}
+	errNs = b.errBound + int64(math.Ceil(math.Abs(age)*b.freqErr)) + b.kernelErr
+	return ns, errNs
+}
+
+// Uncertainty returns the error bound of the timestamp at present.
+// See UnixNanoWithError for details.
+func Uncertainty() time.Duration {
+	_, errNs := UnixNanoWithError()
+	return time.Duration(errNs)
+}
@@ -0,0 +1,45 @@
+package tsc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUnixNanoWithError(t *testing.T) {
+
+	ns, errNs := UnixNanoWithError()
+	if !Supported() {
+		if errNs != 0 {
+			t.Fatal("error bound should be 0 if tsc is unsupported")
+		}
+		t.Skip("tsc is unsupported")
+	}
+
+	if errNs <= 0 {
+		t.Fatalf("error bound should be > 0, but got: %d", errNs)
+	}
+	sys := time.Now().UnixNano()
+	// The system clock & tsc aren't read at the same time, give it 10µs more.
+	if d := ns - sys; d > errNs+10000 || d < -errNs-10000 {
+		t.Fatalf("delta is out of error bound: delta: %d, error bound: %d", d, errNs)
+	}
+
+	origin := Current()
+	defer func() {
+		origin.Timestamp = time.Now().UnixNano()
+		if err := Apply(origin); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	c := origin
+	c.FreqError = 1e-6
+	c.Timestamp = time.Now().Add(-MaxCalibrationAge / 2).UnixNano()
+	if err := Apply(c); err != nil {
+		t.Fatal(err)
+	}
+	exp := c.ErrorBound + int64(float64(MaxCalibrationAge/2)*c.FreqError)
+	if u := Uncertainty(); int64(u) < exp {
+		t.Fatalf("error bound should grow with age: exp >= %d, got: %d", exp, u)
+	}
+}
@@ -0,0 +1,93 @@
+package tsc
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"unsafe"
+)
+
+// pvclockTSCStableBit means pvclock is synchronized among vCPUs,
+// the vDSO uses the pvclock of vCPU 0 only with it.
+const pvclockTSCStableBit = 1 << 0
+
+// pvclockPage is the KVM pvclock page (pvclock_vcpu_time_info of vCPU 0 at the beginning):
+//
+//	u32 version; u32 pad0; u64 tsc_timestamp; u64 system_time;
+//	u32 tsc_to_system_mul; s8 tsc_shift; u8 flags; u8 pad[2];
+//
+// kvm-clock ns = system_time + (scaled(tsc - tsc_timestamp) * tsc_to_system_mul) >> 32,
+// scaled(d) is d << tsc_shift (or d >> -tsc_shift).
+type pvclockPage struct {
+	page  []byte
+	rdtsc func() int64
+}
+
+// read returns kvm-clock nanoseconds (the cycles of kvm-clock clocksource),
+// ok is false if pvclock isn't stable.
+func (p *pvclockPage) read() (cycles uint64, ok bool) {
+
+	for {
+		version := load32(p.page, 0)
+		if version&1 == 1 {
+			continue // Hypervisor is updating.
+		}
+		w := load32(p.page, 28)
+		if (w>>8)&pvclockTSCStableBit == 0 {
+			return 0, false
+		}
+		tsc := uint64(p.rdtsc())
+		tscTimestamp := load64(p.page, 8)
+		systemTime := load64(p.page, 16)
+		mul := load32(p.page, 24)
+		if load32(p.page, 0) != version {
+			continue
+		}
+
+		delta := tsc - tscTimestamp
+		if shift := int8(w); shift < 0 {
+			delta >>= -shift
+		} else {
+			delta <<= shift
+		}
+		hi, lo := bits.Mul64(delta, uint64(mul))
+		return systemTime + (hi<<32 | lo>>32), true
+	}
+}
+
+// hvclockPage is the Hyper-V reference TSC page:
+//
+//	u32 tsc_sequence; u32 reserved; u64 tsc_scale; s64 tsc_offset;
+//
+// reference time (100ns) = (tsc * tsc_scale) >> 64 + tsc_offset.
+type hvclockPage struct {
+	page  []byte
+	rdtsc func() int64
+}
+
+// read returns the reference time in 100ns (the cycles of hyperv_clocksource_tsc_page clocksource),
+// ok is false if the page is invalid (tsc_sequence is 0).
+func (h *hvclockPage) read() (cycles uint64, ok bool) {
+
+	for {
+		seq := load32(h.page, 0)
+		if seq == 0 {
+			return 0, false
+		}
+		scale := load64(h.page, 8)
+		offset := load64(h.page, 16)
+		tsc := uint64(h.rdtsc())
+		if load32(h.page, 0) != seq {
+			continue
+		}
+		hi, _ := bits.Mul64(tsc, scale)
+		return hi + offset, true
+	}
+}
+
+func load32(b []byte, off int) uint32 {
+	return atomic.LoadUint32((*uint32)(unsafe.Pointer(&b[off])))
+}
+
+func load64(b []byte, off int) uint64 {
+	return atomic.LoadUint64((*uint64)(unsafe.Pointer(&b[off])))
+}
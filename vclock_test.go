@@ -0,0 +1,149 @@
+package tsc
+
+import (
+	"encoding/binary"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// pvclockMul2100MHz is tsc_to_system_mul of 2.1GHz with tsc_shift 1: round(2^32 * 1e9 / 4.2e9).
+const pvclockMul2100MHz = 1022611261
+
+func makePVClockPage(version uint32, tscTimestamp, systemTime uint64, mul uint32, shift int8, flags uint8) []byte {
+	page := make([]byte, 4096)
+	binary.LittleEndian.PutUint32(page[0:], version)
+	binary.LittleEndian.PutUint64(page[8:], tscTimestamp)
+	binary.LittleEndian.PutUint64(page[16:], systemTime)
+	binary.LittleEndian.PutUint32(page[24:], mul)
+	page[28] = byte(shift)
+	page[29] = flags
+	return page
+}
+
+func TestPVClock(t *testing.T) {
+
+	// 2.1GHz: tsc_to_system_mul = 2^32 * 1e9 / (2.1e9 * 2^shift), shift = 1.
+	mul := uint32(pvclockMul2100MHz)
+	for _, shift := range []int8{1, -1} {
+		var tsc int64
+		pv := &pvclockPage{
+			page:  makePVClockPage(2, 1<<40, 5e15, mul, shift, pvclockTSCStableBit),
+			rdtsc: func() int64 { return tsc },
+		}
+		for _, delta := range []int64{0, 2100, 21e8, 1 << 36} {
+			tsc = 1<<40 + delta
+			d := new(big.Int).SetInt64(delta)
+			if shift > 0 {
+				d.Lsh(d, uint(shift))
+			} else {
+				d.Rsh(d, uint(-shift))
+			}
+			exp := d.Mul(d, big.NewInt(int64(mul)))
+			exp.Rsh(exp, 32)
+			exp.Add(exp, big.NewInt(5e15))
+
+			ns, ok := pv.read()
+			if !ok || ns != exp.Uint64() {
+				t.Fatalf("mismatched pvclock at delta %d (shift: %d): exp: %d, got: %d (%t)", delta, shift, exp.Uint64(), ns, ok)
+			}
+		}
+	}
+
+	unstable := &pvclockPage{page: makePVClockPage(2, 0, 0, mul, 1, 0), rdtsc: func() int64 { return 0 }}
+	if _, ok := unstable.read(); ok {
+		t.Fatal("unstable pvclock shouldn't be used")
+	}
+}
+
+func TestPVClockVersion(t *testing.T) {
+
+	pv := &pvclockPage{
+		page:  makePVClockPage(3, 0, 1000, 1<<31, 0, pvclockTSCStableBit),
+		rdtsc: func() int64 { return 2 },
+	}
+	done := make(chan uint64)
+	go func() {
+		ns, _ := pv.read()
+		done <- ns
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("shouldn't read while version is odd")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	atomic.StoreUint32((*uint32)(unsafe.Pointer(&pv.page[0])), 4)
+	if ns := <-done; ns != 1001 {
+		t.Fatalf("mismatched pvclock: exp: 1001, got: %d", ns)
+	}
+}
+
+func makeHVClockPage(seq uint32, scale, offset uint64) []byte {
+	page := make([]byte, 4096)
+	binary.LittleEndian.PutUint32(page[0:], seq)
+	binary.LittleEndian.PutUint64(page[8:], scale)
+	binary.LittleEndian.PutUint64(page[16:], offset)
+	return page
+}
+
+func TestHVClock(t *testing.T) {
+
+	// 2.1GHz tsc to 10MHz reference time: scale = 2^64 * 1e7 / 2.1e9.
+	scale, _ := new(big.Float).Quo(new(big.Float).SetInt(new(big.Int).Lsh(big.NewInt(1e7), 64)), big.NewFloat(2.1e9)).Uint64()
+	offset := uint64(1 << 50)
+
+	var tsc int64
+	hv := &hvclockPage{page: makeHVClockPage(1, scale, offset), rdtsc: func() int64 { return tsc }}
+	for _, v := range []int64{0, 2100, 21e8, 1 << 50} {
+		tsc = v
+		exp := new(big.Int).Mul(big.NewInt(v), new(big.Int).SetUint64(scale))
+		exp.Rsh(exp, 64)
+		exp.Add(exp, new(big.Int).SetUint64(offset))
+
+		ref, ok := hv.read()
+		if !ok || ref != exp.Uint64() {
+			t.Fatalf("mismatched reference time at tsc %d: exp: %d, got: %d (%t)", v, exp.Uint64(), ref, ok)
+		}
+	}
+	tsc = 21e8
+	if ref, _ := hv.read(); ref-offset != 1e7 && ref-offset != 1e7-1 { // Scale is truncated.
+		t.Fatalf("1s should be 1e7 * 100ns, got: %d", ref-offset)
+	}
+
+	invalid := &hvclockPage{page: makeHVClockPage(0, scale, offset), rdtsc: func() int64 { return 0 }}
+	if _, ok := invalid.read(); ok {
+		t.Fatal("invalid page shouldn't be used")
+	}
+}
+
+// TestVDSOClockPV tests vdso_data in pvclock mode, the cycles are kvm-clock nanoseconds.
+func TestVDSOClockPV(t *testing.T) {
+
+	now := time.Now().UnixNano()
+	l := vdsoLayouts[0]
+	page := makeVvarPage(vvarFixtures[0], vdsoClockModePVClock, now/int64(time.Second))
+	binary.LittleEndian.PutUint32(page[l.multOff():], 1<<24) // 1 cycle = 1ns.
+
+	tsc := int64(1<<40 + 21e8)
+	pv := &pvclockPage{
+		page:  makePVClockPage(2, 1<<40, 1<<40, pvclockMul2100MHz, 1, pvclockTSCStableBit),
+		rdtsc: func() int64 { return tsc },
+	}
+	c := &vdsoClock{page: page, layout: l, mode: vdsoClockModePVClock, cycles: pv.read}
+
+	ns, ok := c.unixNano()
+	exp := (now/int64(time.Second))*int64(time.Second) + 123 + int64(time.Second)
+	if !ok || ns < exp-1 || ns > exp {
+		t.Fatalf("mismatched timestamp: exp: %d, got: %d (%t)", exp, ns, ok)
+	}
+
+	page = makeVvarPage(vvarFixtures[0], vdsoClockModeTSC, now/int64(time.Second)) // Clocksource has been changed.
+	c.page = page
+	if _, ok = c.unixNano(); ok {
+		t.Fatal("should fall back when clock mode is changed")
+	}
+}
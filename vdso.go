@@ -0,0 +1,250 @@
+package tsc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrVDSOUnsupported means the vDSO clock data (in the vvar page) isn't recognized.
+var ErrVDSOUnsupported = errors.New("tsc: vDSO clock data is unsupported")
+
+// Clock modes (of x86) in vdso_data.
+const (
+	vdsoClockModeTSC     = 1
+	vdsoClockModePVClock = 2 // KVM pvclock, see pvclockPage.
+	vdsoClockModeHVClock = 3 // Hyper-V reference TSC page, see hvclockPage.
+	vdsoClockModeTimens  = math.MaxInt32
+)
+
+// vdsoLayout is a layout of the kernel's vdso_data (vdso_clock since Linux 6.13) in the vvar page:
+//
+//	u32 seq; s32 clock_mode; u64 cycle_last; [u64 max_cycles;] u64 mask; u32 mult; u32 shift;
+//	struct { u64 sec; u64 nsec; } basetime[12]; // Indexed by clock ID, nsec is shifted.
+//	[s32 tz_minuteswest; s32 tz_dsttime; u32 hrtimer_res; u32 __unused;] // Before Linux 6.13.
+//
+// There are two of them: CS_HRES_COARSE (CLOCK_REALTIME, MONOTONIC, BOOTTIME & TAI)
+// and CS_RAW (CLOCK_MONOTONIC_RAW), see vdsoBases.
+type vdsoLayout struct {
+	name   string
+	offset int  // Offset of vdso_data in the vvar page.
+	maxCyc bool // Has max_cycles (CONFIG_GENERIC_VDSO_OVERFLOW_PROTECT, since Linux 6.8).
+	stride int  // Size of vdso_data, the offset between CS_HRES_COARSE & CS_RAW.
+}
+
+// vdsoLayouts are the known layouts on x86-64.
+var vdsoLayouts = []vdsoLayout{
+	{name: "6.13+", offset: 0, maxCyc: true, stride: 232},      // Generic vDSO datastore.
+	{name: "6.8-6.12", offset: 128, maxCyc: true, stride: 248}, // DECLARE_VVAR(128, struct vdso_data, _vdso_data).
+	{name: "5.3-6.7", offset: 128, maxCyc: false, stride: 240},
+}
+
+// Offsets of fields in vdso_data.
+func (l vdsoLayout) seqOff() int          { return l.offset }
+func (l vdsoLayout) modeOff() int         { return l.offset + 4 }
+func (l vdsoLayout) cycleLastOff() int    { return l.offset + 8 }
+func (l vdsoLayout) maskOff() int         { return l.offset + 16 + l.extra() }
+func (l vdsoLayout) multOff() int         { return l.offset + 24 + l.extra() }
+func (l vdsoLayout) shiftOff() int        { return l.offset + 28 + l.extra() }
+func (l vdsoLayout) secOff(base int) int  { return l.offset + 32 + l.extra() + 16*base }
+func (l vdsoLayout) nsecOff(base int) int { return l.secOff(base) + 8 }
+func (l vdsoLayout) size() int            { return l.nsecOff(0) + 8 - l.offset }
+func (l vdsoLayout) at(cs int) vdsoLayout { l.offset += cs * l.stride; return l }
+
+func (l vdsoLayout) extra() int {
+	if l.maxCyc {
+		return 8
+	}
+	return 0
+}
+
+// vdsoBase is the position of a clock's base time: vdso_data[cs].basetime[base].
+type vdsoBase struct {
+	cs, base int
+}
+
+// vdsoBases are the positions of clocks (except CLOCK_REALTIME, it's {0, 0}).
+var vdsoBases = map[ClockID]vdsoBase{
+	ClockMonotonic:    {0, 1},
+	ClockMonotonicRaw: {1, 4},
+	ClockBoottime:     {0, 7},
+	ClockTAI:          {0, 11},
+}
+
+// detectVDSOLayout detects the layout of page (the first page of vvar) by checking fields,
+// now is the current Unix nanoseconds. It returns the clock mode too.
+func detectVDSOLayout(page []byte, now int64) (vdsoLayout, int32, error) {
+
+	for _, l := range vdsoLayouts {
+		if len(page) < l.offset+l.size() {
+			continue
+		}
+		mode := int32(binary.LittleEndian.Uint32(page[l.modeOff():]))
+		if mode == vdsoClockModeTimens {
+			return vdsoLayout{}, 0, fmt.Errorf("%w: in time namespace", ErrVDSOUnsupported)
+		}
+		if mode < vdsoClockModeTSC || mode > vdsoClockModeHVClock || binary.LittleEndian.Uint64(page[l.maskOff():]) != math.MaxUint64 {
+			continue
+		}
+		mult, shift := binary.LittleEndian.Uint32(page[l.multOff():]), binary.LittleEndian.Uint32(page[l.shiftOff():])
+		if mult == 0 || shift == 0 || shift > 32 {
+			continue
+		}
+		sec := int64(binary.LittleEndian.Uint64(page[l.secOff(0):]))
+		if d := sec - now/int64(time.Second); d < -3600 || d > 3600 {
+			continue
+		}
+		return l, mode, nil
+	}
+	return vdsoLayout{}, 0, fmt.Errorf("%w: unknown layout", ErrVDSOUnsupported)
+}
+
+// vdsoClock reads CLOCK_REALTIME (or the clock at base) from vdso_data as the vDSO does.
+type vdsoClock struct {
+	page   []byte
+	layout vdsoLayout // At vdso_data[cs] of the clock.
+	base   int        // Index of basetime, 0 is CLOCK_REALTIME.
+	mode   int32
+	// cycles reads the clocksource: tsc, or the paravirtual clock made by tsc (see pvclockPage & hvclockPage).
+	cycles func() (uint64, bool)
+}
+
+// vdsoParams is a consistent snapshot of vdso_data.
+type vdsoParams struct {
+	mode      int32
+	cycleLast uint64
+	mask      uint64
+	mult      uint32
+	shift     uint32
+	sec       uint64
+	nsec      uint64
+}
+
+func (c *vdsoClock) load32(off int) uint32 {
+	return load32(c.page, off)
+}
+
+func (c *vdsoClock) load64(off int) uint64 {
+	return load64(c.page, off)
+}
+
+// snapshot loads params & cycles under the seqcount.
+func (c *vdsoClock) snapshot() (p vdsoParams, cycles uint64, ok bool) {
+
+	l := c.layout
+	for {
+		seq := c.load32(l.seqOff())
+		if seq&1 == 1 {
+			continue // Kernel is updating.
+		}
+		p = vdsoParams{
+			mode:      int32(c.load32(l.modeOff())),
+			cycleLast: c.load64(l.cycleLastOff()),
+			mask:      c.load64(l.maskOff()),
+			mult:      c.load32(l.multOff()),
+			shift:     c.load32(l.shiftOff()),
+			sec:       c.load64(l.secOff(c.base)),
+			nsec:      c.load64(l.nsecOff(c.base)),
+		}
+		cycles, ok = c.cycles()
+		if c.load32(l.seqOff()) == seq {
+			return p, cycles, ok
+		}
+	}
+}
+
+// unixNano returns CLOCK_REALTIME (or the clock at base), ok is false if the kernel clocksource has been changed
+// (or the paravirtual clock is unstable).
+func (c *vdsoClock) unixNano() (ns int64, ok bool) {
+	p, cycles, ok := c.snapshot()
+	if !ok || p.mode != c.mode {
+		return 0, false
+	}
+	return p.unixNano(cycles), true
+}
+
+// unixNano returns Unix nanoseconds at cycles (of the clocksource):
+// sec * 1e9 + (nsec + ((cycles - cycle_last) & mask) * mult) >> shift.
+func (p vdsoParams) unixNano(cycles uint64) int64 {
+	delta := uint64(0)
+	if cycles > p.cycleLast {
+		delta = (cycles - p.cycleLast) & p.mask
+	}
+	hi, lo := bits.Mul64(delta, uint64(p.mult))
+	lo, carry := bits.Add64(lo, p.nsec, 0)
+	hi += carry
+	ns := lo>>p.shift | hi<<(64-p.shift)
+	return int64(p.sec)*int64(time.Second) + int64(ns)
+}
+
+// vdso is the vDSO clock in using (see EnableVDSO), nil means disabled.
+var vdso *vdsoClock
+
+func vdsoUnixNano() int64 {
+	if ns, ok := vdso.unixNano(); ok {
+		return ns
+	}
+	return sysClock()
+}
+
+// DisableVDSO makes UnixNano using the calibrated TSC clock again.
+//
+// Not threads safe.
+func DisableVDSO() {
+	vdso = nil
+	if Supported() {
+		pickUnixNano()
+	} else {
+		UnixNano = sysClock
+	}
+}
+
+// IsVDSO returns UnixNano is reading the kernel's vDSO clock data or not (see EnableVDSO).
+//
+// Not threads safe.
+func IsVDSO() bool {
+	return vdso != nil
+}
+
+const linuxMapsPath = "/proc/self/maps"
+
+// findMapping finds the start address of the mapping named name in maps file.
+func findMapping(path, name string) (uintptr, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrVDSOUnsupported, err.Error())
+	}
+	defer f.Close()
+
+	return parseMapping(bufio.NewScanner(f), name)
+}
+
+// parseMapping parses lines like:
+// 7fc18ca9e000-7fc18caa2000 r--p 00000000 00:00 0                          [vvar]
+func parseMapping(sc *bufio.Scanner, name string) (uintptr, error) {
+
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 6 || fields[5] != name {
+			continue
+		}
+		addr, _, ok := strings.Cut(fields[0], "-")
+		if !ok {
+			break
+		}
+		start, err := strconv.ParseUint(addr, 16, 64)
+		if err != nil {
+			break
+		}
+		return uintptr(start), nil
+	}
+	return 0, fmt.Errorf("%w: %s not found", ErrVDSOUnsupported, name)
+}
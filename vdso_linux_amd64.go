@@ -0,0 +1,145 @@
+package tsc
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+	"time"
+	"unsafe"
+)
+
+// EnableVDSO makes UnixNano reading the kernel's CLOCK_REALTIME parameters
+// (mult, shift, cycle_last & base time in the vvar page) under its seqcount,
+// so the timestamp matches clock_gettime exactly without independent calibration,
+// and it's disciplined by NTP as the system clock.
+//
+// In VMs, the kernel clocksource may be a paravirtual clock made by TSC
+// (KVM pvclock or Hyper-V reference TSC page), their scale & offset are read from the vvar pages too.
+// It's enabled in init automatically if TSC is unsupported (e.g., clocksource is kvm-clock).
+//
+// It's slower than the calibrated UnixNano (but still faster than time.Now, no vDSO call),
+// and it falls back to time.Now when the kernel clocksource has been changed.
+//
+// It returns ErrVDSOUnsupported if the layout isn't recognized (nothing changes).
+//
+// Not threads safe.
+func EnableVDSO() error {
+
+	c, err := newVDSOClock()
+	if err != nil {
+		return err
+	}
+	vdso = c
+	UnixNano = vdsoUnixNano
+	return nil
+}
+
+func newVDSOClock() (*vdsoClock, error) {
+
+	data, pv, hv, err := vvarPages()
+	if err != nil {
+		return nil, err
+	}
+	l, mode, err := detectVDSOLayout(data, sysClock())
+	if err != nil {
+		return nil, err
+	}
+
+	c := &vdsoClock{page: data, layout: l, mode: mode}
+	switch mode {
+	case vdsoClockModeTSC:
+		c.cycles = func() (uint64, bool) { return uint64(vdsoRDTSC()), true }
+	case vdsoClockModePVClock:
+		c.cycles = (&pvclockPage{page: pv, rdtsc: vdsoRDTSC}).read
+	case vdsoClockModeHVClock:
+		c.cycles = (&hvclockPage{page: hv, rdtsc: vdsoRDTSC}).read
+	}
+	if err = probeVClock(c.cycles); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// vdsoClockDeviation is the max deviation between a vDSO reference clock & clock_gettime(2) in probing.
+const vdsoClockDeviation = int64(time.Millisecond)
+
+// vdsoReferenceClock returns the reference clock id read from the vvar page as the vDSO does,
+// sys is the same clock by clock_gettime(2) which is used for probing & falling back.
+//
+// It's as fast as time.Now, a system call is several times slower (wider sampling window in CalibrateAgainst).
+func vdsoReferenceClock(id ClockID, sys ReferenceClock) (ReferenceClock, error) {
+
+	b, ok := vdsoBases[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: clock %s isn't in vDSO", ErrVDSOUnsupported, id)
+	}
+	c, err := newVDSOClock()
+	if err != nil {
+		return nil, err
+	}
+	c.layout, c.base = c.layout.at(b.cs), b.base
+
+	// The base time may be missing (e.g., CLOCK_TAI before Linux 5.11 is read by system call).
+	before := sys()
+	ns, ok := c.unixNano()
+	after := sys()
+	if !ok || ns < before-vdsoClockDeviation || ns > after+vdsoClockDeviation {
+		return nil, fmt.Errorf("%w: clock %s mismatched: %d not in [%d, %d]", ErrVDSOUnsupported, id, ns, before, after)
+	}
+
+	return func() int64 {
+		if ns, ok := c.unixNano(); ok {
+			return ns
+		}
+		return sys()
+	}, nil
+}
+
+// probeVClock reads cycles once, the page may be not accessible (SIGBUS).
+func probeVClock(cycles func() (uint64, bool)) (err error) {
+
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: failed to read clock page: %v", ErrVDSOUnsupported, r)
+		}
+	}()
+
+	if _, ok := cycles(); !ok {
+		return fmt.Errorf("%w: paravirtual clock is unstable", ErrVDSOUnsupported)
+	}
+	return nil
+}
+
+// vdsoRDTSC reads tsc in order if ForbidOutOfOrder has been invoked.
+func vdsoRDTSC() int64 {
+	if IsOutOfOrder() {
+		return RDTSC()
+	}
+	return GetInOrder()
+}
+
+// vvarPages returns the pages of vvar mapping in this process:
+// data: the first page of vvar (vdso_data), pv: pvclock page, hv: Hyper-V TSC page.
+//
+// Since Linux 6.13, pvclock & Hyper-V TSC pages are in [vvar_vclock].
+// Before that, they are the 2nd & 3rd pages of [vvar].
+func vvarPages() (data, pv, hv []byte, err error) {
+
+	ps := uintptr(os.Getpagesize())
+
+	start, err := findMapping(linuxMapsPath, "[vvar]")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	vclock, err := findMapping(linuxMapsPath, "[vvar_vclock]")
+	if err != nil {
+		vclock = start + ps
+	}
+	return mapped(start, ps), mapped(vclock, ps), mapped(vclock+ps, ps), nil
+}
+
+// mapped returns the memory mapped at addr.
+func mapped(addr, size uintptr) []byte {
+	return unsafe.Slice(*(**byte)(unsafe.Pointer(&addr)), size)
+}
@@ -0,0 +1,106 @@
+package tsc
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestEnableVDSO(t *testing.T) {
+
+	if err := EnableVDSO(); err != nil {
+		t.Skipf("vDSO is unsupported: %v", err)
+	}
+	defer DisableVDSO()
+
+	if !IsVDSO() {
+		t.Fatal("vDSO should be enabled")
+	}
+	for i := 0; i < 1024; i++ {
+		before := time.Now().UnixNano()
+		ns := UnixNano()
+		after := time.Now().UnixNano()
+		// tsc is read out-of-order by default, it could be a bit earlier/later.
+		if ns < before-int64(time.Microsecond) || ns > after+int64(time.Microsecond) {
+			t.Fatalf("timestamp out of range: [%d, %d], got: %d", before, after, ns)
+		}
+	}
+
+	DisableVDSO()
+	if IsVDSO() {
+		t.Fatal("vDSO should be disabled")
+	}
+	if Supported() && UnixNano() == 0 {
+		t.Fatal("UnixNano should be restored")
+	}
+}
+
+func TestVDSOReferenceClock(t *testing.T) {
+
+	if _, err := newVDSOClock(); err != nil {
+		t.Skipf("vDSO is unsupported: %v", err)
+	}
+
+	for id, cid := range clockIDs {
+		sys := func() int64 {
+			var ts unix.Timespec
+			_ = unix.ClockGettime(cid, &ts)
+			return ts.Nano()
+		}
+		ref, err := vdsoReferenceClock(id, sys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 1024; i++ {
+			before := sys()
+			ns := ref()
+			after := sys()
+			if ns < before-int64(time.Microsecond) || ns > after+int64(time.Microsecond) {
+				t.Fatalf("clock %s out of range: [%d, %d], got: %d", id, before, after, ns)
+			}
+		}
+
+		// Base time mismatched (e.g., missing).
+		if _, err = vdsoReferenceClock(id, func() int64 { return sys() + int64(time.Second) }); !errors.Is(err, ErrVDSOUnsupported) {
+			t.Fatalf("mismatched clock %s should be unsupported, got: %v", id, err)
+		}
+	}
+
+	if _, err := vdsoReferenceClock(ClockRealtime, sysClock); !errors.Is(err, ErrVDSOUnsupported) {
+		t.Fatalf("realtime isn't a reference clock in vDSO, got: %v", err)
+	}
+}
+
+func TestParseMapping(t *testing.T) {
+
+	maps := `55d0c1a4a000-55d0c1a4c000 r--p 00000000 103:02 1234                     /usr/bin/cat
+7fc18ca9e000-7fc18caa2000 r--p 00000000 00:00 0                          [vvar]
+7fc18caa2000-7fc18caa4000 r--p 00000000 00:00 0                          [vvar_vclock]
+7fc18caa4000-7fc18caa6000 r-xp 00000000 00:00 0                          [vdso]
+7ffd5d0f1000-7ffd5d112000 rw-p 00000000 00:00 0
+`
+	for _, c := range []struct {
+		name string
+		exp  uintptr
+	}{
+		{"[vvar]", 0x7fc18ca9e000},
+		{"[vvar_vclock]", 0x7fc18caa2000},
+		{"[vdso]", 0x7fc18caa4000},
+	} {
+		start, err := parseMapping(bufio.NewScanner(strings.NewReader(maps)), c.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if start != c.exp {
+			t.Fatalf("mismatched start of %s: exp: %x, got: %x", c.name, c.exp, start)
+		}
+	}
+
+	if _, err := parseMapping(bufio.NewScanner(strings.NewReader(maps)), "[heap]"); !errors.Is(err, ErrVDSOUnsupported) {
+		t.Fatalf("should be not found, got: %v", err)
+	}
+}
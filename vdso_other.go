@@ -0,0 +1,14 @@
+//go:build !linux || !amd64
+// +build !linux !amd64
+
+package tsc
+
+// vdsoReferenceClock returns ErrVDSOUnsupported on non-Linux or non-amd64.
+func vdsoReferenceClock(id ClockID, sys ReferenceClock) (ReferenceClock, error) {
+	return nil, ErrVDSOUnsupported
+}
+
+// EnableVDSO returns ErrVDSOUnsupported on non-Linux or non-amd64.
+func EnableVDSO() error {
+	return ErrVDSOUnsupported
+}
@@ -0,0 +1,227 @@
+package tsc
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/big"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// vdsoRecordedPages are the first pages of vvar dumped on real machines, with the time of dumping.
+var vdsoRecordedPages = []struct {
+	file   string
+	now    int64 // Unix seconds.
+	layout string
+	mode   int32
+	raw    int64 // Seconds of CLOCK_MONOTONIC_RAW base time.
+}{
+	{"testdata/vvar/linux-6.18-x86_64.bin", 1792358473, "6.13+", vdsoClockModeTSC, 2650},
+}
+
+func TestDetectVDSOLayoutRecorded(t *testing.T) {
+
+	for _, r := range vdsoRecordedPages {
+		page, err := os.ReadFile(r.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l, mode, err := detectVDSOLayout(page, r.now*int64(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l.name != r.layout || mode != r.mode {
+			t.Fatalf("mismatched layout of %s: exp: %s (mode: %d), got: %s (mode: %d)", r.file, r.layout, r.mode, l.name, mode)
+		}
+
+		raw := &vdsoClock{page: page, layout: l.at(vdsoBases[ClockMonotonicRaw].cs), base: vdsoBases[ClockMonotonicRaw].base,
+			cycles: func() (uint64, bool) { return 0, true }}
+		if p, _, _ := raw.snapshot(); p.mode != mode || p.mask != math.MaxUint64 || int64(p.sec) != r.raw {
+			t.Fatalf("mismatched CLOCK_MONOTONIC_RAW of %s: mode: %d, mask: %x, sec: %d", r.file, p.mode, p.mask, p.sec)
+		}
+
+		// Base time is too old.
+		if _, _, err = detectVDSOLayout(page, (r.now+86400)*int64(time.Second)); !errors.Is(err, ErrVDSOUnsupported) {
+			t.Fatalf("should be unsupported, got: %v", err)
+		}
+	}
+}
+
+// vvarFixture is the vvar page layout of a kernel version in byte offsets (from the kernel headers),
+// it's independent of vdsoLayouts.
+type vvarFixture struct {
+	layout string
+	data   [2]int // Offsets of vdso_data[CS_HRES_COARSE] & vdso_data[CS_RAW] in the page.
+	// Offsets in vdso_data (seq: 0, clock_mode: 4, cycle_last: 8), maxCycles is 0 if there is no max_cycles.
+	maxCycles, mask, mult, shift, basetime int
+}
+
+var vvarFixtures = []vvarFixture{
+	// vdso_time_data is at the start of the page (x86 has no arch data),
+	// clock_data[CS_BASES] (232 bytes each, no tz fields) are its first field.
+	{"6.13+", [2]int{0, 232}, 16, 24, 32, 36, 40},
+	// DECLARE_VVAR(128, struct vdso_data, _vdso_data), vdso_data is 248 bytes with max_cycles.
+	{"6.8-6.12", [2]int{128, 376}, 16, 24, 32, 36, 40},
+	// vdso_data is 240 bytes without max_cycles.
+	{"5.3-6.7", [2]int{128, 368}, 0, 16, 24, 28, 32},
+}
+
+// vvarBaseSec returns seconds of basetime[base] in vdso_data[cs] of the page made by makeVvarPage.
+func vvarBaseSec(cs, base int, sec int64) int64 {
+	if cs == 0 && base == 0 {
+		return sec
+	}
+	return int64(cs*100+base) * 1000
+}
+
+// makeVvarPage makes a vvar page of f with CLOCK_REALTIME at sec (+123ns), other base times are vvarBaseSec.
+func makeVvarPage(f vvarFixture, mode int32, sec int64) []byte {
+	page := make([]byte, 4096)
+	for cs, off := range f.data {
+		binary.LittleEndian.PutUint32(page[off:], 2)
+		binary.LittleEndian.PutUint32(page[off+4:], uint32(mode))
+		binary.LittleEndian.PutUint64(page[off+8:], 1<<40)
+		if f.maxCycles != 0 {
+			binary.LittleEndian.PutUint64(page[off+f.maxCycles:], 1<<41)
+		}
+		binary.LittleEndian.PutUint64(page[off+f.mask:], math.MaxUint64)
+		binary.LittleEndian.PutUint32(page[off+f.mult:], 7989150)
+		binary.LittleEndian.PutUint32(page[off+f.shift:], 24)
+		for base := 0; base < 12; base++ {
+			binary.LittleEndian.PutUint64(page[off+f.basetime+16*base:], uint64(vvarBaseSec(cs, base, sec)))
+			binary.LittleEndian.PutUint64(page[off+f.basetime+16*base+8:], 123<<24)
+		}
+	}
+	return page
+}
+
+// TestDetectVDSOLayoutSynthesized tests layouts which have no recorded pages.
+func TestDetectVDSOLayoutSynthesized(t *testing.T) {
+
+	now := time.Now().UnixNano()
+	sec := now / int64(time.Second)
+	for _, f := range vvarFixtures {
+		for _, mode := range []int32{vdsoClockModeTSC, vdsoClockModePVClock, vdsoClockModeHVClock} {
+			act, actMode, err := detectVDSOLayout(makeVvarPage(f, mode, sec), now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if act.name != f.layout || actMode != mode {
+				t.Fatalf("mismatched layout: exp: %s (mode: %d), got: %s (mode: %d)", f.layout, mode, act.name, actMode)
+			}
+		}
+
+		_, _, err := detectVDSOLayout(makeVvarPage(f, vdsoClockModeTimens, sec), now)
+		if !errors.Is(err, ErrVDSOUnsupported) || !strings.Contains(err.Error(), "time namespace") {
+			t.Fatalf("time namespace should be unsupported, got: %v", err)
+		}
+		if _, _, err = detectVDSOLayout(makeVvarPage(f, 0, sec), now); !errors.Is(err, ErrVDSOUnsupported) {
+			t.Fatalf("clock mode none should be unsupported, got: %v", err)
+		}
+	}
+
+	for _, page := range [][]byte{make([]byte, 4096), make([]byte, 64), nil} {
+		if _, _, err := detectVDSOLayout(page, now); !errors.Is(err, ErrVDSOUnsupported) {
+			t.Fatalf("should be unsupported, got: %v", err)
+		}
+	}
+}
+
+func TestVDSOClock(t *testing.T) {
+
+	page, err := os.ReadFile(vdsoRecordedPages[0].file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, mode, err := detectVDSOLayout(page, vdsoRecordedPages[0].now*int64(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tsc int64
+	c := &vdsoClock{page: page, layout: l, mode: mode, cycles: func() (uint64, bool) { return uint64(tsc), true }}
+
+	p, _, _ := c.snapshot()
+	for _, delta := range []int64{0, 3e6, 1 << 40} {
+		tsc = int64(p.cycleLast) + delta
+		// sec * 1e9 + (nsec + delta * mult) >> shift
+		exp := new(big.Int).Mul(big.NewInt(delta), big.NewInt(int64(p.mult)))
+		exp.Add(exp, new(big.Int).SetUint64(p.nsec))
+		exp.Rsh(exp, uint(p.shift))
+		exp.Add(exp, big.NewInt(int64(p.sec)*int64(time.Second)))
+
+		ns, ok := c.unixNano()
+		if !ok || ns != exp.Int64() {
+			t.Fatalf("mismatched timestamp at delta %d: exp: %d, got: %d (%t)", delta, exp.Int64(), ns, ok)
+		}
+	}
+
+	tsc = int64(p.cycleLast) - 1000 // Before cycle_last (on another core): no going back.
+	if ns, _ := c.unixNano(); ns != p.unixNano(p.cycleLast) {
+		t.Fatalf("timestamp should be the base time before cycle_last, got: %d", ns)
+	}
+
+	// Kernel switches clocksource away from TSC.
+	binary.LittleEndian.PutUint32(page[l.modeOff():], 0)
+	if _, ok := c.unixNano(); ok {
+		t.Fatal("should fall back when clock mode isn't TSC")
+	}
+}
+
+// TestVDSOClockBases reads every clock of synthesized pages.
+func TestVDSOClockBases(t *testing.T) {
+
+	now := time.Now().UnixNano()
+	sec := now / int64(time.Second)
+	for _, f := range vvarFixtures {
+		page := makeVvarPage(f, vdsoClockModeTSC, sec)
+		l, _, err := detectVDSOLayout(page, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bases := map[ClockID]vdsoBase{ClockRealtime: {}}
+		for id, b := range vdsoBases {
+			bases[id] = b
+		}
+		for id, b := range bases {
+			c := &vdsoClock{page: page, layout: l.at(b.cs), base: b.base, mode: vdsoClockModeTSC,
+				cycles: func() (uint64, bool) { return 1 << 40, true }}
+			exp := vvarBaseSec(b.cs, b.base, sec)*int64(time.Second) + 123
+			if ns, ok := c.unixNano(); !ok || ns != exp {
+				t.Fatalf("mismatched clock %s of %s: exp: %d, got: %d (%t)", id, f.layout, exp, ns, ok)
+			}
+		}
+	}
+}
+
+func TestVDSOClockSeq(t *testing.T) {
+
+	now := time.Now().UnixNano()
+	l := vdsoLayouts[0]
+	page := makeVvarPage(vvarFixtures[0], vdsoClockModeTSC, now/int64(time.Second))
+	c := &vdsoClock{page: page, layout: l, mode: vdsoClockModeTSC, cycles: func() (uint64, bool) { return 1 << 40, true }}
+	seq := (*uint32)(unsafe.Pointer(&page[l.seqOff()]))
+
+	atomic.StoreUint32(seq, 3) // Kernel is updating.
+	done := make(chan int64)
+	go func() {
+		ns, _ := c.unixNano()
+		done <- ns
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("shouldn't read while seq is odd")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	atomic.StoreUint32(seq, 4)
+	if ns := <-done; ns != (now/int64(time.Second))*int64(time.Second)+123 {
+		t.Fatalf("mismatched timestamp: %d", ns)
+	}
+}